@@ -0,0 +1,52 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/app"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/app/surveyor"
+)
+
+const (
+	FLAG_FULL = "full"
+)
+
+// backupCmd represents the backup command
+var backupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Backup Salesforce metadata and records",
+	Long: `Starts a backup session. The Surveyor discovers object metadata and records,
+and the Siphon drains them from the cache into the Cistern's Restic repository.
+Every org listed in the orgs config is backed up, each with its own Surveyor and cache namespace.
+Backups are incremental, only records changed since each object's last backup are stored.
+Use --full to back up every record, regardless of the last backup.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if cmd.Flags().Changed(FLAG_FULL) {
+			full, _ := cmd.Flags().GetBool(FLAG_FULL)
+			viper.Set(surveyor.CONFIG_KEY_FORCE_FULL, full)
+		}
+		app.Start()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(backupCmd)
+
+	backupCmd.Flags().Bool(FLAG_FULL, false, "back up every record, ignoring the watermarks of previous backups")
+}
@@ -0,0 +1,79 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/config"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/logger"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/tools"
+)
+
+const (
+	FLAG_FORCE = "force"
+)
+
+// configCmd represents the config command
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage the config file",
+	// Config commands work on the config file itself, so skip loading it
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		logger.InitLogger()
+		return nil
+	},
+}
+
+// configInitCmd represents the config init command
+var configInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Create a config file with default values",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		force, _ := cmd.Flags().GetBool(FLAG_FORCE)
+
+		configFile, err := configFileFromFlag()
+		if err != nil {
+			return err
+		}
+
+		path := configFile.AbsolutePath()
+		if exists, _ := tools.FilePathExists(path); exists && !force {
+			return fmt.Errorf("config file already exists, use --%s to overwrite: %s", FLAG_FORCE, path)
+		}
+
+		if err := os.MkdirAll(configFile.Dir, 0777); err != nil {
+			return err
+		}
+
+		if err := config.CreateConfig(configFile); err != nil {
+			return err
+		}
+
+		fmt.Fprintln(cmd.OutOrStdout(), "Config file created:", path)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configInitCmd)
+
+	configInitCmd.Flags().Bool(FLAG_FORCE, false, "overwrite an existing config file")
+}
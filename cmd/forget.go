@@ -0,0 +1,93 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/app"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/app/cistern"
+)
+
+const (
+	FLAG_DRY_RUN = "dry-run"
+	FLAG_PRUNE   = "prune"
+)
+
+// forgetCmd represents the forget command
+var forgetCmd = &cobra.Command{
+	Use:   "forget",
+	Short: "Remove snapshots according to the retention policies",
+	Long: `Applies the retention policies in cistern.retention.policies to the snapshots in storage.
+Each policy is applied to the runs that backed up each object of an org, so an object's latest runs are
+kept even when later runs didn't back it up. A snapshot is kept if any policy keeps an object it holds,
+snapshots holding only objects no policy keeps are removed and snapshots no policy matches are left alone.
+Every org's snapshots are forgotten, use --org to only apply the policies to one org's snapshots.
+Use --dry-run to show which snapshots would be removed without removing them.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dryRun, _ := cmd.Flags().GetBool(FLAG_DRY_RUN)
+		org, _ := cmd.Flags().GetString(FLAG_ORG)
+		if cmd.Flags().Changed(FLAG_PRUNE) {
+			prune, _ := cmd.Flags().GetBool(FLAG_PRUNE)
+			viper.Set(cistern.CONFIG_KEY_RETENTION_PRUNE, prune)
+		}
+
+		results, err := app.Forget(org, dryRun)
+		if err != nil {
+			return err
+		}
+
+		action := "remove"
+		if dryRun {
+			action = "would remove"
+		}
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "TAGS\tSNAPSHOT\tTIME\tACTION")
+		removed := 0
+		for _, r := range results {
+			tags := strings.Join(r.Tags, ",")
+			for _, s := range r.Keep {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", tags, s.ID, s.Time.Format("2006-01-02 15:04:05"), "keep")
+			}
+			for _, s := range r.Remove {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", tags, s.ID, s.Time.Format("2006-01-02 15:04:05"), action)
+			}
+			removed += len(r.Remove)
+		}
+		w.Flush()
+
+		if dryRun {
+			fmt.Fprintf(cmd.OutOrStdout(), "\n%d snapshots would be removed (dry run)\n", removed)
+		} else {
+			fmt.Fprintf(cmd.OutOrStdout(), "\n%d snapshots removed\n", removed)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(forgetCmd)
+
+	forgetCmd.Flags().Bool(FLAG_DRY_RUN, false, "show which snapshots would be removed without removing them")
+	forgetCmd.Flags().String(FLAG_ORG, "", "only forget the snapshots of the org in orgs")
+	forgetCmd.Flags().Bool(FLAG_PRUNE, cistern.RETENTION_PRUNE, "remove data no longer referenced by any snapshot (restic storage only)")
+}
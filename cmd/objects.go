@@ -0,0 +1,76 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/app"
+)
+
+const (
+	FLAG_QUERYABLE = "queryable"
+	FLAG_SELECTED  = "selected"
+)
+
+// objectsCmd represents the objects command
+var objectsCmd = &cobra.Command{
+	Use:   "objects",
+	Short: "Inspect Salesforce objects",
+}
+
+// objectsListCmd represents the objects list command
+var objectsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the objects in the Salesforce org",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		queryable, _ := cmd.Flags().GetBool(FLAG_QUERYABLE)
+		selected, _ := cmd.Flags().GetBool(FLAG_SELECTED)
+		org, _ := cmd.Flags().GetString(FLAG_ORG)
+
+		list := app.ListObjects
+		if selected {
+			list = app.SelectedObjects
+		}
+		sobjects, err := list(org)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tLABEL\tQUERYABLE\tCUSTOM")
+		for _, sobj := range sobjects {
+			if queryable && !sobj.Queryable {
+				continue
+			}
+			fmt.Fprintf(w, "%s\t%s\t%t\t%t\n", sobj.Name, sobj.Label, sobj.Queryable, sobj.Custom)
+		}
+
+		return w.Flush()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(objectsCmd)
+	objectsCmd.AddCommand(objectsListCmd)
+
+	objectsListCmd.Flags().Bool(FLAG_QUERYABLE, false, "only list queryable objects")
+	objectsListCmd.Flags().Bool(FLAG_SELECTED, false, "only list objects selected for backup by surveyor.objects")
+	objectsListCmd.Flags().String(FLAG_ORG, "", "org in orgs to list the objects of")
+}
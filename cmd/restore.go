@@ -0,0 +1,88 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/app"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/restic"
+)
+
+const (
+	FLAG_SNAPSHOT    = "snapshot"
+	FLAG_TARGET      = "target"
+	FLAG_INCLUDE     = "include"
+	FLAG_TO_ORG      = "to-org"
+	FLAG_OBJECT      = "object"
+	FLAG_EXTERNAL_ID = "external-id"
+	FLAG_REMAP_IDS   = "remap-ids"
+)
+
+// restoreCmd represents the restore command
+var restoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Restore a backup snapshot",
+	Long: `Restores a snapshot from the Restic repository into a local target directory.
+Use --include to only restore matching paths, e.g. --include "Account/*".
+
+With --to-org, the records in the snapshot are upserted back into the Salesforce org
+using BulkV2 Ingest Jobs. Records are matched by Id, or by the field set with
+--external-id, e.g. --external-id Account=Legacy_Id__c. Each object's records come from
+the latest run that backed it up, merging every snapshot the run was stored as, or from
+the run or snapshot given with --snapshot.
+
+Objects are restored in dependency order using their lookup fields. When restoring into
+a different org, --remap-ids creates new records and rewrites lookups to the new Ids.
+Lookups in a cycle, like Account.ParentId, are set in a second update pass.
+
+When several orgs are set in orgs, --org chooses the org whose snapshots are restored,
+and the org its records are restored into.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		snapshot, _ := cmd.Flags().GetString(FLAG_SNAPSHOT)
+		target, _ := cmd.Flags().GetString(FLAG_TARGET)
+		include, _ := cmd.Flags().GetStringSlice(FLAG_INCLUDE)
+		toOrg, _ := cmd.Flags().GetBool(FLAG_TO_ORG)
+		objects, _ := cmd.Flags().GetStringSlice(FLAG_OBJECT)
+		externalIDs, _ := cmd.Flags().GetStringToString(FLAG_EXTERNAL_ID)
+		remapIDs, _ := cmd.Flags().GetBool(FLAG_REMAP_IDS)
+		org, _ := cmd.Flags().GetString(FLAG_ORG)
+
+		if toOrg {
+			return app.RestoreRecords(org, snapshot, objects, externalIDs, remapIDs)
+		}
+
+		if target == "" {
+			return fmt.Errorf("--%s is required unless restoring --%s", FLAG_TARGET, FLAG_TO_ORG)
+		}
+		return app.Restore(org, snapshot, target, include...)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(restoreCmd)
+
+	restoreCmd.Flags().String(FLAG_SNAPSHOT, restic.SNAPSHOT_LATEST, "snapshot ID to restore")
+	restoreCmd.Flags().String(FLAG_TARGET, "", "directory to restore the snapshot into")
+	restoreCmd.Flags().StringSlice(FLAG_INCLUDE, nil, "only restore paths matching the pattern (repeatable)")
+	restoreCmd.Flags().Bool(FLAG_TO_ORG, false, "restore records into the Salesforce org")
+	restoreCmd.Flags().StringSlice(FLAG_OBJECT, nil, "only restore records of the object into the org (repeatable)")
+	restoreCmd.Flags().StringToString(FLAG_EXTERNAL_ID, nil, "field used to match existing records of an object, as Object=Field")
+	restoreCmd.Flags().String(FLAG_ORG, "", "org in orgs to restore the snapshots of")
+	restoreCmd.Flags().Bool(FLAG_REMAP_IDS, false, "create records with new Ids and remap lookups, when restoring into a different org")
+}
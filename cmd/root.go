@@ -0,0 +1,115 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/app"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/config"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	FLAG_CONFIG    = "config"
+	FLAG_BASE_DIR  = "base-dir"
+	FLAG_LOG_LEVEL = "log-level"
+)
+
+var cfgFile string
+
+// rootCmd represents the base command when called without any subcommands
+var rootCmd = &cobra.Command{
+	Use:   "salesforce-backups",
+	Short: "Securely backup Salesforce records to cloud services using Restic",
+	Long: `Backs up Salesforce object metadata and records using the REST and BulkV2 APIs,
+storing them in a Restic repository.`,
+	SilenceUsage:      true,
+	SilenceErrors:     true,
+	PersistentPreRunE: initConfig,
+}
+
+// Execute adds all child commands to the root command and sets flags appropriately.
+// This is called by main.main(). It only needs to happen once to the rootCmd.
+func Execute() {
+	cobra.CheckErr(rootCmd.Execute())
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&cfgFile, FLAG_CONFIG, "", fmt.Sprintf("config file (default is %s)", defaultConfigPath()))
+	rootCmd.PersistentFlags().String(FLAG_BASE_DIR, app.BASE_DIR, "base directory for the backup cache")
+	rootCmd.PersistentFlags().String(FLAG_LOG_LEVEL, logger.LOG_LEVEL, "log level (debug, info, warn, error)")
+
+	viper.BindPFlag(app.CONFIG_KEY_BASE_DIR, rootCmd.PersistentFlags().Lookup(FLAG_BASE_DIR))
+	viper.BindPFlag(logger.CONFIG_KEY_LOG+"."+logger.CONFIG_KEY_LOG_LEVEL, rootCmd.PersistentFlags().Lookup(FLAG_LOG_LEVEL))
+}
+
+// initConfig reads in the config file, initializes the global logger and resolves secrets in config
+func initConfig(cmd *cobra.Command, args []string) error {
+	if err := loadConfig(cmd, args); err != nil {
+		return err
+	}
+
+	return config.ResolveSecrets()
+}
+
+// loadConfig reads in the config file and initializes the global logger, leaving secret references unresolved
+func loadConfig(cmd *cobra.Command, args []string) error {
+	configFile, err := configFileFromFlag()
+	if err != nil {
+		return err
+	}
+
+	if err := config.LoadFile(configFile); err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
+
+	// Init logger - log format and set zap logging as global
+	logger.InitLogger()
+	// Only keys are logged, settings may hold secrets
+	zap.S().Debugw("Config file set", "file", viper.ConfigFileUsed(), "keys", viper.AllKeys())
+
+	return nil
+}
+
+// configFileFromFlag returns the config file set with the `--config` flag,
+// or the default config file if the flag isn't set
+func configFileFromFlag() (config.ConfigFile, error) {
+	if cfgFile == "" {
+		return config.ConfigFile{
+			Dir:      config.ConfigDir,
+			Filename: config.CONFIG_FILE_NAME,
+			Ext:      config.CONFIG_FILE_EXT,
+		}, nil
+	}
+
+	path, err := filepath.Abs(cfgFile)
+	if err != nil {
+		return config.ConfigFile{}, err
+	}
+
+	return config.NewConfig(path)
+}
+
+func defaultConfigPath() string {
+	return filepath.Join(config.ConfigDir, config.CONFIG_FILE_NAME+"."+config.CONFIG_FILE_EXT)
+}
@@ -0,0 +1,112 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/config"
+)
+
+// secretsCmd represents the secrets command
+var secretsCmd = &cobra.Command{
+	Use:   "secrets",
+	Short: "Manage secrets in the encrypted local keyring",
+	Long: `Manages secrets in the encrypted local keyring, referenced in config as ` + "`keyring:NAME`" + `.
+
+Config values can also reference secrets outside the keyring:
+  env:NAME            the environment variable
+  file:/path          the file's contents
+  exec:helper args    the output of a helper command
+
+The keyring passphrase is read from ` + config.ENV_VAR_KEYRING_PASSPHRASE + `,
+or ` + "`" + config.CONFIG_KEY_KEYRING_PASSPHRASE + "`" + ` in config.`,
+	// Secrets in config aren't resolved, so a keyring secret can be added before it's referenced
+	PersistentPreRunE: loadConfig,
+}
+
+// secretsSetCmd represents the secrets set command
+var secretsSetCmd = &cobra.Command{
+	Use:   "set NAME",
+	Short: "Add or replace a secret, read from stdin",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		b, err := io.ReadAll(cmd.InOrStdin())
+		if err != nil {
+			return err
+		}
+		secret := strings.TrimRight(string(b), "\r\n")
+		if secret == "" {
+			return errors.New("secret is empty")
+		}
+
+		k, err := config.OpenKeyring()
+		if err != nil {
+			return err
+		}
+		k.Set(args[0], secret)
+
+		return k.Save()
+	},
+}
+
+// secretsDeleteCmd represents the secrets delete command
+var secretsDeleteCmd = &cobra.Command{
+	Use:   "delete NAME",
+	Short: "Delete a secret",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		k, err := config.OpenKeyring()
+		if err != nil {
+			return err
+		}
+		if !k.Delete(args[0]) {
+			return fmt.Errorf("secret `%s` isn't in the keyring", args[0])
+		}
+
+		return k.Save()
+	},
+}
+
+// secretsListCmd represents the secrets list command
+var secretsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the names of the secrets",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		k, err := config.OpenKeyring()
+		if err != nil {
+			return err
+		}
+
+		for _, name := range k.Names() {
+			fmt.Fprintln(cmd.OutOrStdout(), name)
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(secretsCmd)
+	secretsCmd.AddCommand(secretsSetCmd)
+	secretsCmd.AddCommand(secretsDeleteCmd)
+	secretsCmd.AddCommand(secretsListCmd)
+}
@@ -0,0 +1,62 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/app"
+)
+
+const (
+	FLAG_TAG = "tag"
+	FLAG_ORG = "org"
+)
+
+// snapshotsCmd represents the snapshots command
+var snapshotsCmd = &cobra.Command{
+	Use:   "snapshots",
+	Short: "List backup snapshots",
+	Long: `Lists the snapshots in the configured storage backend, optionally filtered by tag.
+When several orgs are set in orgs, --org chooses the org whose snapshots are listed.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		tags, _ := cmd.Flags().GetStringSlice(FLAG_TAG)
+		org, _ := cmd.Flags().GetString(FLAG_ORG)
+
+		snapshots, err := app.Snapshots(org, tags...)
+		if err != nil {
+			return err
+		}
+
+		out, err := json.MarshalIndent(snapshots, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), string(out))
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(snapshotsCmd)
+
+	snapshotsCmd.Flags().StringSlice(FLAG_TAG, nil, "only list snapshots with the tag (repeatable)")
+	snapshotsCmd.Flags().String(FLAG_ORG, "", "org in orgs to list the snapshots of")
+}
@@ -5,6 +5,7 @@ go 1.16
 require (
 	github.com/Jeffail/tunny v0.1.4
 	github.com/StackExchange/wmi v1.2.1 // indirect
+	github.com/dgraph-io/badger v1.6.2
 	github.com/dustin/go-humanize v1.0.0
 	github.com/facebookarchive/runcmd v0.0.0-20150612182913-2a9d85ff45fd
 	github.com/fsnotify/fsnotify v1.5.1
@@ -12,15 +13,19 @@ require (
 	github.com/golang-jwt/jwt v3.2.2+incompatible
 	github.com/imdario/mergo v0.3.12
 	github.com/josharian/impl v1.1.0 // indirect
+	github.com/klauspost/compress v1.13.6
+	github.com/minio/minio-go/v7 v7.0.14
 	github.com/mitchellh/mapstructure v1.4.2
 	github.com/pkg/browser v0.0.0-20210911075715-681adbf594b8
 	github.com/shirou/gopsutil v3.21.9+incompatible
 	github.com/sigmavirus24/salesforceid v0.0.0-20210430003503-f95ac032bccc
 	github.com/spf13/afero v1.6.0
+	github.com/spf13/cobra v1.2.1
 	github.com/spf13/viper v1.9.0
 	github.com/tklauser/go-sysconf v0.3.9 // indirect
 	github.com/vburenin/ifacemaker v1.1.0 // indirect
 	go.uber.org/zap v1.19.1
+	golang.org/x/crypto v0.0.0-20210817164053-32db794688a5
 	golang.org/x/mod v0.5.1 // indirect
 	golang.org/x/sys v0.0.0-20211015200801-69063c4bb744 // indirect
 	golang.org/x/tools v0.1.7 // indirect
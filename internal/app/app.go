@@ -1,12 +1,15 @@
 package app
 
 import (
-	"fmt"
+	"io"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
+	"github.com/Jeffail/tunny"
 	"github.com/dustin/go-humanize"
 	"github.com/spf13/viper"
 	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/app/cache"
@@ -15,7 +18,9 @@ import (
 	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/app/siphon"
 	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/app/surveyor"
 	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/logger"
+	pkgcache "gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/cache"
 	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/salesforce"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/storage"
 	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/tools"
 	"go.uber.org/zap"
 )
@@ -55,31 +60,18 @@ func init() {
 	viper.SetDefault(CONFIG_KEY_MAX_MEM_PERCENT, MAX_MEM_PERCENT)
 }
 
+// Start runs a backup session. Config must already be loaded and the logger initialized.
 func Start() {
-	// Read config file
-	viper.SetConfigFile("test.yml")
-	if err := viper.ReadInConfig(); err == nil {
-		fmt.Fprintln(os.Stdout, "Using config file:", viper.ConfigFileUsed())
-	} else {
-		fmt.Printf("Errors: %v", err)
-	}
-
-	// Init logger - log format and set zap logging as global
-	logger.InitLogger()
-
-	settings := viper.AllSettings()
-	zap.S().Debugw("Config file set", "settings", settings)
-
 	UpdateSettings()
 
-	// Load Salesforce details from config
-	sf, err := salesforce.NewSession()
+	// Load the orgs to back up from config
+	orgs, err := LoadOrgs()
 	logger.PanicCheck(err)
 
-
 	// setup done channel for all parts of the app
 	done := make(chan struct{})
-	cache := cache.NewCache(done, baseDir, cacheTimeout)
+	cache, err := cache.New(done, baseDir, cacheTimeout)
+	logger.PanicCheck(err)
 
 	//if no present state in root cache dir, then set one
 	// the timestamp in state is checked by other processes to midigate flooding external apis with requests
@@ -114,22 +106,110 @@ func Start() {
 	cacheNap := naptime.NewDiskNapConsitions(maxCache, baseDir)
 	nt := naptime.NewNaptime(2 * time.Minute, cpuNap, memNap, cacheNap)
 
-	surveyor := surveyor.NewSurveyor(sf, cache, nt)
-	cistern := cistern.NewCistern(cache, nt)
-	
-	siphon := siphon.NewSiphon(surveyor, cistern, cache)
-	siphon.Start(baseDir, done)
+	// Every org's Cistern shares the workers, and the storage unless the org has its own
+	workers := cistern.NewWorkers(nt)
+	sharedStorage, err := cistern.NewStorage()
+	logger.PanicCheck(err)
+	storages := []storage.Storage{sharedStorage}
+	// a storage's run is complete unless a Cistern storing to it fails to store its backups
+	complete := map[storage.Storage]bool{sharedStorage: true}
+
+	cisterns := make([]*cistern.Cistern, 0, len(orgs))
+	cisternStorages := make([]storage.Storage, 0, len(orgs))
+	siphons := make([]*siphon.Siphon, 0, len(orgs))
+	for _, org := range orgs {
+		orgStorage := sharedStorage
+		if org.Storage != nil {
+			orgStorage, err = storage.New(*org.Storage)
+			logger.PanicCheck(err)
+			storages = append(storages, orgStorage)
+			complete[orgStorage] = true
+		}
+
+		c, sp, err := startOrg(org, cache, orgStorage, workers, nt, done)
+		logger.PanicCheck(err)
+		cisterns = append(cisterns, c)
+		cisternStorages = append(cisternStorages, orgStorage)
+		siphons = append(siphons, sp)
+	}
 
 	// Start monitoring for naptimes
 	nt.MonitorConditions()
 
-	for {
-		select {
-		case <-done:
-			close(done)
-			zap.S().Infof("Backup session complete")
+	// The session ends once every org is backed up, or early when interrupted
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	select {
+	case <-allFinished(siphons):
+		zap.S().Info("every org surveyed, storing remaining backups")
+	case sig := <-signals:
+		zap.S().Warnw("interrupted, storing backups cached so far", "signal", sig.String())
+		for _, s := range storages {
+			complete[s] = false
 		}
 	}
+	close(done)
+
+	for i, c := range cisterns {
+		err := c.Close()
+		if err != nil {
+			zap.S().Errorw("unable to store remaining backups", "error", err)
+			complete[cisternStorages[i]] = false
+		}
+	}
+	for _, s := range storages {
+		err := cistern.CloseStorage(s, complete[s])
+		if err != nil {
+			zap.S().Errorw("unable to close storage", "error", err)
+		}
+	}
+	if c, ok := cache.(io.Closer); ok {
+		c.Close()
+	}
+	zap.S().Infof("Backup session complete")
+}
+
+// allFinished is closed once every siphon has finished
+func allFinished(siphons []*siphon.Siphon) <-chan struct{} {
+	finished := make(chan struct{})
+	go func() {
+		for _, s := range siphons {
+			<-s.Finished()
+		}
+		close(finished)
+	}()
+	return finished
+}
+
+// startOrg starts an isolated Surveyor for the org, siphoning into its own Cistern.
+// Orgs with a name are cached in their own namespace of the cache.
+func startOrg(org OrgConfig, c pkgcache.Cache, s storage.Storage, workers *tunny.Pool, nt *naptime.Naptime, done chan struct{}) (*cistern.Cistern, *siphon.Siphon, error) {
+	sf, err := salesforce.NewSessionWithConfig(org.Salesforce)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	orgCache := c
+	if org.CacheNamespace != "" {
+		orgCache, err = cache.Namespace(done, c, cacheTimeout, org.CacheNamespace)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	sv := surveyor.NewSurveyor(sf, orgCache, nt)
+	sv.ObjectPolicy = org.Objects
+	ct := cistern.NewCistern(orgCache, s, workers, org.BackupTags()...)
+
+	if org.Name != "" {
+		zap.S().Infow("starting org backup", "org", org.Name, "cache_namespace", org.CacheNamespace)
+	}
+	sp := siphon.NewSiphon(sv, ct, orgCache)
+	go sp.Start(baseDir, done)
+
+	return ct, sp, nil
 }
 
 func UpdateSettings() {
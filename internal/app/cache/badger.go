@@ -1,54 +1,398 @@
 package cache
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
 
 	"github.com/dgraph-io/badger"
+	"github.com/spf13/viper"
 	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/cache"
+	"go.uber.org/zap"
 )
 
+const (
+	BADGER_DIR = ".badger"
+	// Badger values are read and written whole, so every item is held in memory while it's cached or staged for storage.
+	// Larger items, like big record pages or blobs, need the filesystem driver.
+	BADGER_MAX_VALUE_SIZE = 64 * 1024 * 1024
+
+	CONFIG_KEY_BADGER_MAX_VALUE_SIZE = "cache.badger.max_value_size"
+)
+
+func init() {
+	viper.SetDefault(CONFIG_KEY_BADGER_MAX_VALUE_SIZE, BADGER_MAX_VALUE_SIZE)
+}
+
+var (
+	_ cache.Cache = (*Badger)(nil)
+
+	errStopIteration = errors.New("stop iteration")
+
+	// ErrValueTooLarge is returned when an item is over `cache.badger.max_value_size`
+	ErrValueTooLarge = errors.New("value too large to cache in badger")
+)
+
+// Badger is a cache.Cache stored in an embedded Badger key-value DB.
+// Keys are slash separated paths, prefixed by the namespace when one is set.
 type Badger struct {
-	db *badger.DB
+	db       *badger.DB
 	basePath string
+	options  cache.CacheOptions
+	// maxValueSize is the largest value cached, each value is held in memory whole
+	maxValueSize int64
+}
+
+// NewBadger opens or creates the Badger DB in `<basePath>/.badger`.
+// The options set the namespace and expiry used by default.
+// Values are limited to `cache.badger.max_value_size`, and never more than a value log file holds.
+func NewBadger(basePath string, opts ...cache.CacheOption) (*Badger, error) {
+	dir := filepath.Join(basePath, BADGER_DIR)
+	dbOpts := badger.DefaultOptions(dir).WithLogger(badgerLogger{})
+	db, err := badger.Open(dbOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	maxValueSize := viper.GetInt64(CONFIG_KEY_BADGER_MAX_VALUE_SIZE)
+	if maxValueSize <= 0 {
+		maxValueSize = BADGER_MAX_VALUE_SIZE
+	}
+	if maxValueSize > dbOpts.ValueLogFileSize {
+		maxValueSize = dbOpts.ValueLogFileSize
+	}
+
+	b := &Badger{
+		db:           db,
+		basePath:     basePath,
+		options:      cache.NewCacheOptions(cache.CacheOptions{}, opts...),
+		maxValueSize: maxValueSize,
+	}
+
+	return b, nil
+}
+
+// Namespace returns a cache sharing the DB, with its keys in the namespace
+func (b *Badger) Namespace(ns string) *Badger {
+	n := *b
+	n.options.Namespace = ns
+	return &n
+}
+
+// Close closes the DB, for every namespace sharing it
+func (b *Badger) Close() error {
+	return b.db.Close()
 }
 
 func (b *Badger) BasePath() string {
-	panic("not implemented") // TODO: Implement
+	return b.basePath
+}
+
+// dbKey converts a cache key to the DB key in the namespace
+func (b *Badger) dbKey(key string) []byte {
+	return []byte(b.namespaced(cleanKey(key)))
+}
+
+// cacheKey converts a DB key to the cache key, without the namespace
+func (b *Badger) cacheKey(key []byte) string {
+	k := string(key)
+	if b.options.Namespace != "" {
+		k = strings.TrimPrefix(k, b.options.Namespace+"/")
+	}
+	return k
+}
+
+// prefix is the DB key prefix for every key under the path
+func (b *Badger) prefix(p string) []byte {
+	k := cleanKey(p)
+	if k != "" {
+		k += "/"
+	}
+	return []byte(b.namespaced(k))
+}
+
+func (b *Badger) namespaced(key string) string {
+	return namespacedKey(b.options.Namespace, key)
+}
+
+func namespacedKey(ns string, key string) string {
+	if ns == "" {
+		return key
+	}
+	return ns + "/" + key
+}
+
+// cleanKey normalizes keys to relative slash separated paths
+func cleanKey(key string) string {
+	return strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(key)), "/")
 }
 
 func (b *Badger) Exists(key string) bool {
-	panic("not implemented") // TODO: Implement
+	err := b.db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get(b.dbKey(key))
+		return err
+	})
+	if err == nil {
+		return true
+	}
+	if err != badger.ErrKeyNotFound {
+		zap.S().Errorw("unable to check if cache key exists", "key", key, "error", err)
+		return false
+	}
+
+	// check for keys under the path
+	found := false
+	err = b.iterate(b.prefix(key), false, func(i *badger.Item) error {
+		found = true
+		return errStopIteration
+	})
+	if err != nil && err != errStopIteration {
+		zap.S().Errorw("unable to check if cache path exists", "key", key, "error", err)
+	}
+	return found
 }
 
 func (b *Badger) Get(key string) (cache.Item, error) {
-	panic("not implemented") // TODO: Implement
+	var item cache.Item
+	err := b.db.View(func(txn *badger.Txn) error {
+		i, err := txn.Get(b.dbKey(key))
+		if err != nil {
+			return err
+		}
+		item, err = b.newItem(i)
+		return err
+	})
+	if err == badger.ErrKeyNotFound {
+		return nil, cache.ErrNotFound
+	}
+
+	return item, err
 }
 
-func (b *Badger) FindAll(key string) ([]string, error) {
-	panic("not implemented") // TODO: Implement
+func (b *Badger) FindAll(name string) ([]string, error) {
+	found := make([]string, 0)
+	err := b.iterate(b.prefix(""), false, func(i *badger.Item) error {
+		k := b.cacheKey(i.Key())
+		if path.Base(k) == name {
+			found = append(found, k)
+		}
+		return nil
+	})
+
+	return found, err
 }
 
-func (b *Badger) Cache(key string, val []byte) error {
-	panic("not implemented") // TODO: Implement
+func (b *Badger) Cache(key string, val []byte, opts ...cache.CacheOption) error {
+	if int64(len(val)) > b.maxValueSize {
+		return fmt.Errorf("%w: %s is over %d bytes", ErrValueTooLarge, key, b.maxValueSize)
+	}
+
+	o := cache.NewCacheOptions(b.options, opts...)
+	target := b
+	if o.Namespace != b.options.Namespace {
+		target = b.Namespace(o.Namespace)
+	}
+
+	return b.db.Update(func(txn *badger.Txn) error {
+		e := badger.NewEntry(target.dbKey(key), val)
+		e.ExpiresAt = o.Expiry()
+		return txn.SetEntry(e)
+	})
 }
 
-func (b *Badger) CacheFromReader(key string, r io.Reader) error {
-	panic("not implemented") // TODO: Implement
+// CacheFromReader reads the whole item into memory, Badger only stores values whole.
+// Items over `cache.badger.max_value_size` (64MB by default) return ErrValueTooLarge, cache them with the filesystem driver.
+func (b *Badger) CacheFromReader(key string, r io.Reader, opts ...cache.CacheOption) error {
+	val, err := ioutil.ReadAll(io.LimitReader(r, b.maxValueSize+1))
+	if err != nil {
+		return err
+	}
+
+	return b.Cache(key, val, opts...)
 }
 
 func (b *Badger) Delete(key string) error {
-	panic("not implemented") // TODO: Implement
+	return b.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(b.dbKey(key))
+	})
 }
 
+// DeleteAllWithPath deletes the key and every key under the path
 func (b *Badger) DeleteAllWithPath(path string) error {
-	panic("not implemented") // TODO: Implement
+	if err := b.Delete(path); err != nil {
+		return err
+	}
+
+	prefix := b.prefix(path)
+	if len(prefix) == 0 {
+		return b.db.DropAll()
+	}
+	return b.db.DropPrefix(prefix)
 }
 
 func (b *Badger) Flush() ([]cache.Item, error) {
-	panic("not implemented") // TODO: Implement
+	return b.flush(b.prefix(""))
 }
 
 func (b *Badger) FlushWithPath(path string) ([]cache.Item, error) {
-	panic("not implemented") // TODO: Implement
+	return b.flush(b.prefix(path))
 }
 
+// flush returns the items with the prefix, their values are only read from the DB when they're needed
+func (b *Badger) flush(prefix []byte) ([]cache.Item, error) {
+	items := make([]cache.Item, 0)
+	err := b.iterate(prefix, false, func(i *badger.Item) error {
+		items = append(items, &BadgerItem{
+			key:       b.cacheKey(i.Key()),
+			dbKey:     i.KeyCopy(nil),
+			db:        b.db,
+			size:      i.ValueSize(),
+			expiresAt: i.ExpiresAt(),
+		})
+		return nil
+	})
+
+	return items, err
+}
+
+func (b *Badger) Keys(path string) ([]string, error) {
+	keys := make([]string, 0)
+	err := b.iterate(b.prefix(path), false, func(i *badger.Item) error {
+		keys = append(keys, b.cacheKey(i.Key()))
+		return nil
+	})
+
+	return keys, err
+}
+
+func (b *Badger) GetState(key string) []byte {
+	item, err := b.Get(key)
+	if err != nil {
+		if err != cache.ErrNotFound {
+			zap.S().Warnw("error occurred getting cache state", "cache", key, "error", err)
+		}
+		return nil
+	}
+	return item.Value()
+}
+
+func (b *Badger) SetState(key string, data []byte) {
+	b.SetStateWithName(cache.StatePath(key), data)
+}
+
+func (b *Badger) SetStateWithName(key string, data []byte) {
+	err := b.Cache(key, data)
+	if err != nil {
+		zap.S().Errorw("unable to set cache state", "cache", key, "error", err)
+		return
+	}
+	zap.S().Debugf("cache state updated: %s", key)
+}
+
+// iterate streams the items with the DB key prefix to fn, prefetching values if they'll be read
+func (b *Badger) iterate(prefix []byte, values bool, fn func(*badger.Item) error) error {
+	return b.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = values
+		opts.Prefix = prefix
+
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			if err := fn(it.Item()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (b *Badger) newItem(i *badger.Item) (*BadgerItem, error) {
+	val, err := i.ValueCopy(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BadgerItem{
+		key:       b.cacheKey(i.Key()),
+		value:     val,
+		loaded:    true,
+		size:      int64(len(val)),
+		expiresAt: i.ExpiresAt(),
+	}, nil
+}
+
+// BadgerItem is a cache.Item read from Badger, the value is copied out of the DB whole,
+// Reader doesn't stream it.
+// Items returned by a flush read their value when it's first needed.
+type BadgerItem struct {
+	key       string
+	dbKey     []byte
+	db        *badger.DB
+	value     []byte
+	loaded    bool
+	size      int64
+	expiresAt uint64
+}
+
+func (i *BadgerItem) Key() string {
+	return i.key
+}
+
+func (i *BadgerItem) Value() []byte {
+	if i.loaded {
+		return i.value
+	}
+
+	err := i.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(i.dbKey)
+		if err != nil {
+			return err
+		}
+		i.value, err = item.ValueCopy(nil)
+		return err
+	})
+	if err != nil {
+		zap.S().Errorw("unable to read cache item", "cache", i.key, "error", err)
+		return nil
+	}
+	i.loaded = true
+	return i.value
+}
+
+func (i *BadgerItem) Reader() io.Reader {
+	return bytes.NewReader(i.Value())
+}
+
+func (i *BadgerItem) Size() int64 {
+	return i.size
+}
+
+func (i *BadgerItem) ExpiresAt() uint64 {
+	return i.expiresAt
+}
+
+// badgerLogger sends Badger's logs to zap
+type badgerLogger struct{}
+
+func (badgerLogger) Errorf(f string, v ...interface{}) {
+	zap.S().Errorf(strings.TrimSpace(f), v...)
+}
+
+func (badgerLogger) Warningf(f string, v ...interface{}) {
+	zap.S().Warnf(strings.TrimSpace(f), v...)
+}
+
+func (badgerLogger) Infof(f string, v ...interface{}) {
+	zap.S().Debugf(strings.TrimSpace(f), v...)
+}
+
+func (badgerLogger) Debugf(f string, v ...interface{}) {
+	zap.S().Debugf(strings.TrimSpace(f), v...)
+}
@@ -0,0 +1,33 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestBadgerMaxValueSize(t *testing.T) {
+	viper.Set(CONFIG_KEY_BADGER_MAX_VALUE_SIZE, 8)
+	t.Cleanup(func() { viper.Set(CONFIG_KEY_BADGER_MAX_VALUE_SIZE, BADGER_MAX_VALUE_SIZE) })
+
+	b, err := NewBadger(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+
+	if err := b.CacheFromReader("Account.0.csv", bytes.NewReader([]byte("Id\n001A\n"))); err != nil {
+		t.Errorf("value at the limit: %v", err)
+	}
+	if err := b.CacheFromReader("Account.1.csv", bytes.NewReader([]byte("Id\n001B\n001C\n"))); !errors.Is(err, ErrValueTooLarge) {
+		t.Errorf("CacheFromReader() over the limit = %v, want ErrValueTooLarge", err)
+	}
+	if err := b.Cache("Account.2.csv", []byte("Id\n001B\n001C\n")); !errors.Is(err, ErrValueTooLarge) {
+		t.Errorf("Cache() over the limit = %v, want ErrValueTooLarge", err)
+	}
+	if b.Exists("Account.1.csv") || b.Exists("Account.2.csv") {
+		t.Error("values over the limit were cached")
+	}
+}
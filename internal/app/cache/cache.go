@@ -1,11 +1,12 @@
 package cache
 
 import (
-	"bufio"
 	"bytes"
+	"encoding/csv"
 	"io"
 	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"time"
 
@@ -13,6 +14,7 @@ import (
 	"github.com/spf13/afero"
 	"github.com/spf13/viper"
 	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/logger"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/cache"
 	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/salesforce/api"
 	"go.uber.org/zap"
 )
@@ -27,19 +29,32 @@ const (
 
 	EXT_CSV  = "csv"
 	EXT_JSON = "json"
+	EXT_BLOB = "blob"
 
 	CSV_HEADER_FILE_NAME = "header.csv"
+
+	// Extension of a file being written, until it's renamed to its key
+	EXT_PARTIAL = ".partial"
 )
 
-type Cache struct {
+var _ cache.FileCache = (*Filesystem)(nil)
+
+// Filesystem is a cache.Cache with each item stored as a file under the cache dir.
+// Items don't expire, and a namespace is a sub directory of the cache dir.
+// Files are written straight to disk, reads are cached in memory for the cache timeout.
+type Filesystem struct {
 	fs           *afero.Afero
+	disk         *afero.Afero
+	overlay      afero.Fs
 	dir          string
+	namespace    string
 	stateUpdates chan StateUpdate
 }
 
-func NewCache(done chan struct{}, dir string, timeout time.Duration) *Cache {
-	c := &Cache{
+func NewFilesystem(done chan struct{}, dir string, timeout time.Duration, opts ...cache.CacheOption) *Filesystem {
+	c := &Filesystem{
 		dir: dir,
+		namespace: cache.NewCacheOptions(cache.CacheOptions{}, opts...).Namespace,
 		stateUpdates: make(chan StateUpdate),
 	}
 
@@ -53,10 +68,13 @@ func NewCache(done chan struct{}, dir string, timeout time.Duration) *Cache {
 
 	// Base file system layer, on disk and restricted to the base path
 	baseLayer := afero.NewBasePathFs(afero.NewOsFs(), dir)
-	// Overlay file system layer, in memory
-	overlay := afero.NewMemMapFs()
+	c.disk = &afero.Afero{
+		Fs: baseLayer,
+	}
+	// Overlay file system layer, in memory. Writing through it would hold every item in memory too, so it's only read through
+	c.overlay = afero.NewMemMapFs()
 	// init cache file system
-	fs := afero.NewCacheOnReadFs(baseLayer, overlay, timeout)
+	fs := afero.NewCacheOnReadFs(baseLayer, c.overlay, timeout)
 	c.fs = &afero.Afero{
 		Fs: fs,
 	}
@@ -86,34 +104,51 @@ func NewCache(done chan struct{}, dir string, timeout time.Duration) *Cache {
 	return c
 }
 
-// if error, assume cache doesn't exists
-func (c *Cache) Exists(cachePath string) bool {
-	exists, err := c.fs.Exists(cachePath)
-	if err != nil {
-		zap.S().Errorw("unable to check if cache path exists", "cache", cachePath, "error", err)
+// path is the file path of the key relative to the cache dir
+func (c *Filesystem) path(key string, ns string) string {
+	p := filepath.FromSlash(path.Join(ns, cleanKey(key)))
+	if p == "" {
+		return "."
 	}
-	return exists && err != nil
+	return p
+}
+
+func (c *Filesystem) BasePath() string {
+	return c.dir
+}
+
+// FilePath is the path on disk the key is cached at
+func (c *Filesystem) FilePath(key string) string {
+	return filepath.Join(c.dir, c.path(key, c.namespace))
 }
 
-func (c *Cache) Stat(cachePath string) (os.FileInfo, error) {
-	// ensure path is exists in basdir
-	relPath, err := filepath.Rel(c.dir, cachePath)
+// if error, assume cache doesn't exists
+func (c *Filesystem) Exists(cachePath string) bool {
+	exists, err := c.fs.Exists(c.path(cachePath, c.namespace))
 	if err != nil {
-		zap.S().Warnw("relative path not found on cache, assuming it doesn't exist yet", "path", cachePath, "error", err)
+		zap.S().Errorw("unable to check if cache path exists", "cache", cachePath, "error", err)
 	}
-
-	return c.fs.Stat(relPath)
+	return exists && err == nil
 }
 
-func (c *Cache) GetCacheDir() string {
-	return c.dir
+func (c *Filesystem) Stat(cachePath string) (os.FileInfo, error) {
+	return c.fs.Stat(c.path(cachePath, c.namespace))
 }
 
-func (c *Cache) GetFileInfo(filePath string) (os.FileInfo, error) {
-	return c.fs.Stat(filePath)
+func (c *Filesystem) Get(key string) (cache.Item, error) {
+	p := c.path(key, c.namespace)
+	info, err := c.fs.Stat(p)
+	if os.IsNotExist(err) {
+		return nil, cache.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileItem{fs: c.fs, key: cleanKey(key), path: p, info: info}, nil
 }
 
-func (c *Cache) FindAll(name string) ([]string, error) {
+func (c *Filesystem) FindAll(name string) ([]string, error) {
 	defer func() {
 		if e := recover(); e != nil {
 			zap.S().Errorw("error attempting to get first file", "file", name)
@@ -122,7 +157,8 @@ func (c *Cache) FindAll(name string) ([]string, error) {
 
 	found := make([]string, 0)
 
-	err := c.fs.Walk(".", func(path string, info fs.FileInfo, e error) error {
+	root := c.path("", c.namespace)
+	err := c.fs.Walk(root, func(path string, info fs.FileInfo, e error) error {
 		defer func() {
 			if e := recover(); e != nil {
 				zap.S().Warnw("unable to walk through cache location", "path", path, "file_info", info, "error", e)
@@ -135,7 +171,7 @@ func (c *Cache) FindAll(name string) ([]string, error) {
 
 		if info.Name() == name {
 			zap.S().Debugf("found cache cache file found: %s", path)
-			found = append(found, path)
+			found = append(found, c.key(root, path))
 		}
 		return nil
 	})
@@ -143,7 +179,8 @@ func (c *Cache) FindAll(name string) ([]string, error) {
 	return found, err
 }
 
-func (c *Cache) GetState(cachePath string) []byte {
+func (c *Filesystem) GetState(cachePath string) []byte {
+	cachePath = c.path(cachePath, c.namespace)
 	exists, err := c.fs.Exists(cachePath)
 	if err != nil {
 		zap.S().Warnw("error occurred getting cache state", "cache", cachePath, "error", err)
@@ -164,7 +201,7 @@ func (c *Cache) GetState(cachePath string) []byte {
 // TODO: add getting raw string state
 // always return an empty string, even on errors
 // to assume cache state needs to be (re)set
-// func (c *Cache) GetStateString(cachePath string) string {
+// func (c *Filesystem) GetStateString(cachePath string) string {
 // 	s := c.GetState(cachePath)
 // 	buf := new(strings.Builder)
 // 	_, err := io.Copy(buf, s)
@@ -176,7 +213,7 @@ func (c *Cache) GetState(cachePath string) []byte {
 
 // }
 
-func (c *Cache) SetState(cachePath string, data []byte) {
+func (c *Filesystem) SetState(cachePath string, data []byte) {
 	c.stateUpdates <- StateUpdate{
 		operation: UPDATE,
 		cachePath: cachePath,
@@ -184,7 +221,7 @@ func (c *Cache) SetState(cachePath string, data []byte) {
 	}
 }
 
-func (c *Cache) SetStateWithName(cachePath string, data[]byte) {
+func (c *Filesystem) SetStateWithName(cachePath string, data[]byte) {
 	c.stateUpdates <- StateUpdate{
 		operation: UPDATE,
 		cachePath: cachePath,
@@ -193,29 +230,30 @@ func (c *Cache) SetStateWithName(cachePath string, data[]byte) {
 	}
 }
 
-func (c *Cache) setState(cachePath string, data []byte, withName bool) {
+func (c *Filesystem) setState(cachePath string, data []byte, withName bool) {
 	var path string
 
 	if withName {
-		path = cachePath
+		path = c.path(cachePath, c.namespace)
 	} else {
-		path = getStatePath(cachePath)
+		path = c.path(cache.StatePath(cachePath), c.namespace)
 	}
 
-	exists, err := c.fs.Exists(path)
+	exists, err := c.disk.Exists(path)
 	if err != nil {
 		zap.S().Errorw("error checking if state file exists, attempting to create one", "error", err)
 	}
 
 	var f afero.File
 	if !exists {
-		f, err = c.fs.Create(path)
+		f, err = c.disk.Create(path)
 		logger.PanicCheck(err)
 	} else {
-		f, err = c.fs.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, FILE_MODE)
+		f, err = c.disk.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, FILE_MODE)
 		logger.PanicCheck(err)
 	}
 	defer f.Close()
+	defer c.evict(path)
 
 	_, err = f.Write(data)
 	logger.PanicCheck(err)
@@ -223,46 +261,138 @@ func (c *Cache) setState(cachePath string, data []byte, withName bool) {
 	zap.S().Debugf("cache state updated: %s", path)
 }
 
-func (c *Cache) ClearState(cachePath string) {
+func (c *Filesystem) ClearState(cachePath string) {
 	c.stateUpdates <- StateUpdate{
 		operation: CLEAR,
 		cachePath: cachePath,
 	}
 }
 
-func (c *Cache) clearState(cachePath string) error {
-	path := getStatePath(cachePath)
-	return c.fs.Remove(path)
+func (c *Filesystem) clearState(cachePath string) error {
+	path := c.path(cache.StatePath(cachePath), c.namespace)
+	defer c.evict(path)
+	return c.disk.Remove(path)
+}
+
+// evict drops the path from the in memory overlay once it's changed on disk, so it isn't read stale
+func (c *Filesystem) evict(path string) {
+	c.overlay.RemoveAll(path)
+}
+
+func (c *Filesystem) Cache(key string, val []byte, opts ...cache.CacheOption) error {
+	return c.CacheFromReader(key, bytes.NewReader(val), opts...)
+}
+
+// CacheFromReader writes the key's file, creating its directories. Expiry options are ignored.
+// The file is written beside the key and renamed once complete, so watchers never see a partial item.
+func (c *Filesystem) CacheFromReader(key string, r io.Reader, opts ...cache.CacheOption) error {
+	o := cache.NewCacheOptions(cache.CacheOptions{Namespace: c.namespace}, opts...)
+	p := c.path(key, o.Namespace)
+	tmp := p + EXT_PARTIAL
+
+	if err := c.disk.WriteReader(tmp, r); err != nil {
+		c.disk.Remove(tmp)
+		return err
+	}
+	defer c.evict(p)
+	return c.disk.Rename(tmp, p)
+}
+
+func (c *Filesystem) Delete(key string) error {
+	p := c.path(key, c.namespace)
+	defer c.evict(p)
+	return c.disk.Remove(p)
 }
 
-func (c *Cache) CacheFile(filename string, r io.Reader, perm os.FileMode) error {
-	return c.fs.SafeWriteReader(filename, r)
+func (c *Filesystem) DeleteAllWithPath(cachePath string) error {
+	p := c.path(cachePath, c.namespace)
+	defer c.evict(p)
+	return c.disk.RemoveAll(p)
 }
 
-func (c *Cache) MakeCacheAll(name string, r io.Reader) error {
+func (c *Filesystem) Flush() ([]cache.Item, error) {
+	return c.FlushWithPath("")
+}
 
-	dir, file := filepath.Split(name)
+// FlushWithPath returns the files under the path, they're read when their value is
+func (c *Filesystem) FlushWithPath(cachePath string) ([]cache.Item, error) {
+	root := c.path("", c.namespace)
+	items := make([]cache.Item, 0)
 
-	if dir != "" {
-		err := c.fs.MkdirAll(dir, FILE_MODE)
+	err := c.fs.Walk(c.path(cachePath, c.namespace), func(path string, info fs.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		}
 		if err != nil {
-			zap.S().Errorw("error attempting to cache data", "object", name, "error", err)
 			return err
 		}
+		if info.IsDir() {
+			return nil
+		}
+
+		items = append(items, &FileItem{fs: c.fs, key: c.key(root, path), path: path, info: info})
+		return nil
+	})
 
+	return items, err
+}
+
+func (c *Filesystem) Keys(cachePath string) ([]string, error) {
+	items, err := c.FlushWithPath(cachePath)
+	keys := make([]string, 0, len(items))
+	for _, i := range items {
+		keys = append(keys, i.Key())
 	}
+	return keys, err
+}
 
-	rb := bufio.NewReader(r)
-	if file != "" && rb.Size() > 0 {
-		err := c.CacheFile(name, r, FILE_MODE)
-		logger.PanicCheck(err)
+// key converts a file path relative to the cache dir to the cache key, relative to the namespace root
+func (c *Filesystem) key(root string, path string) string {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		rel = path
+	}
+	return filepath.ToSlash(rel)
+}
+
+// FileItem is a cache.Item stored as a file, the file is read when its value is
+type FileItem struct {
+	fs   *afero.Afero
+	key  string
+	path string
+	info os.FileInfo
+}
+
+func (i *FileItem) Key() string {
+	return i.key
+}
+
+func (i *FileItem) Value() []byte {
+	data, err := i.fs.ReadFile(i.path)
+	if err != nil {
+		zap.S().Errorw("unable to read cache file", "cache", i.key, "error", err)
+		return nil
 	}
+	return data
+}
 
-	zap.S().Infof("metadata cache file created: %v", name)
-	return nil
+func (i *FileItem) Size() int64 {
+	return i.info.Size()
+}
+
+func (i *FileItem) ExpiresAt() uint64 {
+	return 0
 }
 
-func (c *Cache) CacheCSV(path string, data []byte, options... CSVOption) error {
+// CacheCSV caches the CSV records, split into a file per record when the SplitCSVRows option is set.
+// Records are cached as `<path>.<name>.csv`, named by the Id column unless NameFromColumn is set.
+func CacheCSV(c cache.Cache, path string, data []byte, options... CSVOption) error {
+	return CacheCSVFromReader(c, path, bytes.NewReader(data), options...)
+}
+
+// CacheCSVFromReader caches the CSV records as they're read, so only a record at a time is held in memory.
+// Unless split into a file per record, the CSV is cached whole as `<path>.<page>.csv`, or `<path>.csv` without a PageName.
+func CacheCSVFromReader(c cache.Cache, path string, r io.Reader, options... CSVOption) error {
 	o := &CSVOptions{
 		nameFromCol: api.ID_FIELD,
 	}
@@ -270,12 +400,23 @@ func (c *Cache) CacheCSV(path string, data []byte, options... CSVOption) error {
 	for _, opt := range options {
 		opt(o)
 	}
-	r := bytes.NewReader(data)
+
+	if !o.splitRows {
+		cachePath := path + "." + EXT_CSV
+		if o.pageName != "" {
+			cachePath = path + "." + o.pageName + "." + EXT_CSV
+		}
+		return c.CacheFromReader(cachePath, r)
+	}
+
 	csvReader := gocsv.DefaultCSVReader(r)
 	nameIndex := 0
 
 	// Read CSV header, and get index of nameFromCol val
 	row, err := csvReader.Read()
+	if err == io.EOF {
+		return nil
+	}
 	logger.PanicCheck(err)
 	for k, v := range row {
 		if v == o.nameFromCol {
@@ -285,52 +426,28 @@ func (c *Cache) CacheCSV(path string, data []byte, options... CSVOption) error {
 	}
 
 	header := row
-	
-	if o.splitRows {
-		for {
-			row, err := csvReader.Read()
-			if err == io.EOF {
-				break
-			}
-			logger.PanicCheck(err)
-			rh := [][]string{
-				header,
-				row,
-			}
-			csvBytes, err := gocsv.MarshalBytes(rh)
-			logger.PanicCheck(err)
-			
-			cachePath := path + "." + row[nameIndex] + "." + EXT_CSV
-			br := bytes.NewReader(csvBytes)
-			c.MakeCacheAll(cachePath, br)
+
+	for {
+		row, err := csvReader.Read()
+		if err == io.EOF {
+			break
 		}
+		logger.PanicCheck(err)
+		buf := new(bytes.Buffer)
+		w := csv.NewWriter(buf)
+		w.WriteAll([][]string{
+			header,
+			row,
+		})
+		logger.PanicCheck(w.Error())
+
+		cachePath := path + "." + row[nameIndex] + "." + EXT_CSV
+		err = c.CacheFromReader(cachePath, buf)
+		logger.PanicCheck(err)
 	}
 	return nil
 }
 
-func (c *Cache) DeleteFile(filePath string) error {
-	return c.fs.Remove(filePath)
-}
-
-func (c *Cache) DeleteAll(cachePath string) error {
-	return c.fs.RemoveAll(cachePath)
-}
-
-func (c *Cache) Flush() ([]os.FileInfo, error) {
-	d, err := c.fs.Open(".")
-	if err != nil {
-		return nil, err
-	}
-	defer d.Close()
-
-	list, err := d.Readdir(1)
-	if err == io.EOF {
-		return nil, err
-	}
-
-	return list, nil
-}
-
 
 // CSV Options
 type CSVOption func(co *CSVOptions)
@@ -339,6 +456,7 @@ type CSVOptions struct {
 	header []string
 	nameFromCol string
 	splitRows bool
+	pageName string
 }
 
 func SplitCSVRows() CSVOption {
@@ -352,3 +470,10 @@ func NameFromColumn(col string) CSVOption {
 		co.nameFromCol = col
 	}
 }
+
+// PageName names the file a CSV is cached as when it isn't split into a file per record
+func PageName(name string) CSVOption {
+	return func(co *CSVOptions) {
+		co.pageName = name
+	}
+}
@@ -0,0 +1,366 @@
+package cache
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/cache"
+)
+
+// driver creates an empty cache of one of the drivers, each test gets its own
+type driver struct {
+	name string
+	new  func(t *testing.T, done chan struct{}) cache.Cache
+	// expires is false for drivers that ignore expiry options
+	expires bool
+}
+
+var drivers = []driver{
+	{
+		name: DRIVER_FILESYSTEM,
+		new: func(t *testing.T, done chan struct{}) cache.Cache {
+			return NewFilesystem(done, t.TempDir(), time.Second)
+		},
+	},
+	{
+		name: DRIVER_BADGER,
+		new: func(t *testing.T, done chan struct{}) cache.Cache {
+			b, err := NewBadger(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { b.Close() })
+			return b
+		},
+		expires: true,
+	},
+	{
+		name: DRIVER_MEMORY,
+		new: func(t *testing.T, done chan struct{}) cache.Cache {
+			return NewMemory(t.TempDir())
+		},
+		expires: true,
+	},
+}
+
+// TestCacheContract runs the same tests against every cache driver
+func TestCacheContract(t *testing.T) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, d driver, done chan struct{}, c cache.Cache)
+	}{
+		{"get", testGet},
+		{"delete", testDelete},
+		{"find all", testFindAll},
+		{"flush with path", testFlushWithPath},
+		{"delete all with path", testDeleteAllWithPath},
+		{"namespaces", testNamespaces},
+		{"expiry", testExpiry},
+	}
+
+	for _, d := range drivers {
+		d := d
+		t.Run(d.name, func(t *testing.T) {
+			for _, tt := range tests {
+				tt := tt
+				t.Run(tt.name, func(t *testing.T) {
+					done := make(chan struct{})
+					t.Cleanup(func() { close(done) })
+					tt.test(t, d, done, d.new(t, done))
+				})
+			}
+		})
+	}
+}
+
+func mustCache(t *testing.T, c cache.Cache, key string, val string, opts ...cache.CacheOption) {
+	t.Helper()
+	if err := c.Cache(key, []byte(val), opts...); err != nil {
+		t.Fatalf("unable to cache %s: %v", key, err)
+	}
+}
+
+// values reads the items by key
+func values(t *testing.T, items []cache.Item) map[string]string {
+	t.Helper()
+	vals := make(map[string]string, len(items))
+	for _, i := range items {
+		vals[i.Key()] = string(i.Value())
+	}
+	return vals
+}
+
+func sorted(keys []string) []string {
+	sort.Strings(keys)
+	return keys
+}
+
+func testGet(t *testing.T, d driver, done chan struct{}, c cache.Cache) {
+	mustCache(t, c, "Account/metadata.json", `{"name":"Account"}`)
+	if err := c.CacheFromReader("Account.0.csv", bytes.NewReader([]byte("Id\n001A\n"))); err != nil {
+		t.Fatal(err)
+	}
+
+	item, err := c.Get("Account/metadata.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.Key() != "Account/metadata.json" || string(item.Value()) != `{"name":"Account"}` || item.Size() != 18 {
+		t.Errorf("got %s = %q (%d bytes)", item.Key(), item.Value(), item.Size())
+	}
+
+	item, err = c.Get("Account.0.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(item.Value()) != "Id\n001A\n" {
+		t.Errorf("got %q from reader", item.Value())
+	}
+
+	if _, err := c.Get("Contact/metadata.json"); err != cache.ErrNotFound {
+		t.Errorf("got %v for a missing key, want ErrNotFound", err)
+	}
+
+	for key, want := range map[string]bool{
+		"Account/metadata.json": true,
+		"Account":               true,
+		"/Account/":             true,
+		"Contact":               false,
+		"Acc":                   false,
+	} {
+		if got := c.Exists(key); got != want {
+			t.Errorf("Exists(%q) = %v, want %v", key, got, want)
+		}
+	}
+}
+
+func testDelete(t *testing.T, d driver, done chan struct{}, c cache.Cache) {
+	mustCache(t, c, "Account/metadata.json", "a")
+	mustCache(t, c, "Account.0.csv", "b")
+
+	if err := c.Delete("Account/metadata.json"); err != nil {
+		t.Fatal(err)
+	}
+	if c.Exists("Account/metadata.json") {
+		t.Error("deleted key still exists")
+	}
+	if !c.Exists("Account.0.csv") {
+		t.Error("other key was deleted")
+	}
+}
+
+func testFindAll(t *testing.T, d driver, done chan struct{}, c cache.Cache) {
+	mustCache(t, c, "Account/"+cache.STATE_FILE, "{}")
+	mustCache(t, c, "Account/pk-chunks/0/"+cache.STATE_FILE, "{}")
+	mustCache(t, c, "Account/metadata.json", "{}")
+
+	found, err := c.FindAll(cache.STATE_FILE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Account/.state", "Account/pk-chunks/0/.state"}
+	if got := sorted(found); !reflect.DeepEqual(got, want) {
+		t.Errorf("FindAll() = %v, want %v", got, want)
+	}
+}
+
+// cachePaths caches keys sharing prefixes with the Account path, which must not be treated as under it
+func cachePaths(t *testing.T, c cache.Cache) {
+	mustCache(t, c, "Account/metadata.json", "metadata")
+	mustCache(t, c, "Account/pk-chunks/0/"+cache.STATE_FILE, "state")
+	mustCache(t, c, "Account.0.csv", "records")
+	mustCache(t, c, "AccountContactRelation/metadata.json", "other metadata")
+}
+
+func testFlushWithPath(t *testing.T, d driver, done chan struct{}, c cache.Cache) {
+	cachePaths(t, c)
+
+	items, err := c.FlushWithPath("Account")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"Account/metadata.json":      "metadata",
+		"Account/pk-chunks/0/.state": "state",
+	}
+	if got := values(t, items); !reflect.DeepEqual(got, want) {
+		t.Errorf("FlushWithPath() = %v, want %v", got, want)
+	}
+
+	items, err = c.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 4 {
+		t.Errorf("Flush() returned %d items, want 4", len(items))
+	}
+	if !c.Exists("Account/metadata.json") {
+		t.Error("flushed items are no longer cached")
+	}
+
+	keys, err := c.Keys("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantKeys := []string{"Account.0.csv", "Account/metadata.json", "Account/pk-chunks/0/.state", "AccountContactRelation/metadata.json"}
+	if got := sorted(keys); !reflect.DeepEqual(got, wantKeys) {
+		t.Errorf("Keys() = %v, want %v", got, wantKeys)
+	}
+
+	items, err = c.FlushWithPath("Contact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 0 {
+		t.Errorf("FlushWithPath() of a missing path returned %d items", len(items))
+	}
+}
+
+func testDeleteAllWithPath(t *testing.T, d driver, done chan struct{}, c cache.Cache) {
+	cachePaths(t, c)
+
+	if err := c.DeleteAllWithPath("Account"); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := c.Keys("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Account.0.csv", "AccountContactRelation/metadata.json"}
+	if got := sorted(keys); !reflect.DeepEqual(got, want) {
+		t.Errorf("keys left = %v, want %v", got, want)
+	}
+	if c.Exists("Account") {
+		t.Error("deleted path still exists")
+	}
+}
+
+func testNamespaces(t *testing.T, d driver, done chan struct{}, c cache.Cache) {
+	org1, err := Namespace(done, c, time.Second, "org1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	org2, err := Namespace(done, c, time.Second, "org2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mustCache(t, org1, "Account/metadata.json", "org1")
+	mustCache(t, org2, "Account/metadata.json", "org2")
+	mustCache(t, org2, "Contact/metadata.json", "org2")
+
+	item, err := org1.Get("Account/metadata.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(item.Value()) != "org1" {
+		t.Errorf("org1 read %q, want its own item", item.Value())
+	}
+	if org1.Exists("Contact/metadata.json") {
+		t.Error("org1 sees org2's items")
+	}
+
+	items, err := org2.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"Account/metadata.json": "org2", "Contact/metadata.json": "org2"}
+	if got := values(t, items); !reflect.DeepEqual(got, want) {
+		t.Errorf("org2 Flush() = %v, want %v keyed without the namespace", got, want)
+	}
+
+	// the cache the namespaces are under sees every namespace's items
+	keys, err := c.Keys("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantKeys := []string{"org1/Account/metadata.json", "org2/Account/metadata.json", "org2/Contact/metadata.json"}
+	if got := sorted(keys); !reflect.DeepEqual(got, wantKeys) {
+		t.Errorf("Keys() = %v, want %v", got, wantKeys)
+	}
+
+	// namespaces nest
+	nested, err := Namespace(done, org1, time.Second, "sandbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustCache(t, nested, "Account/metadata.json", "nested")
+	if !c.Exists("org1/sandbox/Account/metadata.json") {
+		t.Error("nested namespace isn't under its parent")
+	}
+
+	if err := org1.DeleteAllWithPath("Account"); err != nil {
+		t.Fatal(err)
+	}
+	if org1.Exists("Account/metadata.json") {
+		t.Error("org1 item wasn't deleted")
+	}
+	if !org2.Exists("Account/metadata.json") {
+		t.Error("deleting org1's path deleted org2's items")
+	}
+	if !nested.Exists("Account/metadata.json") {
+		t.Error("deleting org1's path deleted the nested namespace's items")
+	}
+}
+
+func testExpiry(t *testing.T, d driver, done chan struct{}, c cache.Cache) {
+	past := uint64(time.Now().Add(-time.Minute).Unix())
+	future := uint64(time.Now().Add(time.Hour).Unix())
+
+	mustCache(t, c, "expired", "x", cache.ExpiresAt(past))
+	mustCache(t, c, "expires", "x", cache.ExpiresAt(future))
+	mustCache(t, c, "ttl", "x", cache.TTL(time.Hour))
+	mustCache(t, c, "forever", "x")
+
+	if !d.expires {
+		// expiry options are ignored, nothing expires
+		keys, err := c.Keys("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(keys) != 4 {
+			t.Errorf("got keys %v, want every key", keys)
+		}
+		return
+	}
+
+	if c.Exists("expired") {
+		t.Error("expired item exists")
+	}
+	if _, err := c.Get("expired"); err != cache.ErrNotFound {
+		t.Errorf("got %v getting an expired item, want ErrNotFound", err)
+	}
+	keys, err := c.Keys("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"expires", "forever", "ttl"}; !reflect.DeepEqual(sorted(keys), want) {
+		t.Errorf("Keys() = %v, want %v", keys, want)
+	}
+
+	item, err := c.Get("expires")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.ExpiresAt() != future {
+		t.Errorf("ExpiresAt() = %d, want %d", item.ExpiresAt(), future)
+	}
+	item, err = c.Get("ttl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.ExpiresAt() < future-60 || item.ExpiresAt() > future+60 {
+		t.Errorf("TTL ExpiresAt() = %d, want about %d", item.ExpiresAt(), future)
+	}
+	item, err = c.Get("forever")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.ExpiresAt() != 0 {
+		t.Errorf("ExpiresAt() = %d, want 0 for items that don't expire", item.ExpiresAt())
+	}
+}
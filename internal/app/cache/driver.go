@@ -0,0 +1,61 @@
+package cache
+
+import (
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/spf13/viper"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/cache"
+)
+
+const (
+	DRIVER_FILESYSTEM = "filesystem"
+	DRIVER_BADGER     = "badger"
+	DRIVER_MEMORY     = "memory"
+
+	CONFIG_KEY_DRIVER    = "cache.driver"
+	CONFIG_KEY_NAMESPACE = "cache.namespace"
+)
+
+func init() {
+	viper.SetDefault(CONFIG_KEY_DRIVER, DRIVER_FILESYSTEM)
+}
+
+// New creates the cache with the driver set in config, in the dir.
+// The filesystem driver's state updates stop when done is closed.
+// The badger driver holds each item in memory whole and rejects items over `cache.badger.max_value_size`,
+// orgs with large record pages or blobs need the filesystem driver.
+func New(done chan struct{}, dir string, timeout time.Duration) (cache.Cache, error) {
+	opts := make([]cache.CacheOption, 0)
+	if ns := viper.GetString(CONFIG_KEY_NAMESPACE); ns != "" {
+		opts = append(opts, cache.WithNamespace(ns))
+	}
+
+	driver := viper.GetString(CONFIG_KEY_DRIVER)
+	switch driver {
+	case DRIVER_FILESYSTEM, "":
+		return NewFilesystem(done, dir, timeout, opts...), nil
+	case DRIVER_BADGER:
+		return NewBadger(dir, opts...)
+	case DRIVER_MEMORY:
+		return NewMemory(dir, opts...), nil
+	}
+
+	return nil, fmt.Errorf("unknown cache driver: %s", driver)
+}
+
+// Namespace returns a cache of the same driver as the cache, with its keys in the namespace under the cache's namespace.
+// Badger and memory caches share their items, filesystem caches are created alongside the cache in its dir.
+func Namespace(done chan struct{}, c cache.Cache, timeout time.Duration, ns string) (cache.Cache, error) {
+	switch base := c.(type) {
+	case *Badger:
+		return base.Namespace(path.Join(base.options.Namespace, ns)), nil
+	case *Filesystem:
+		return NewFilesystem(done, base.dir, timeout, cache.WithNamespace(path.Join(base.namespace, ns))), nil
+	case *Memory:
+		return base.Namespace(path.Join(base.options.Namespace, ns)), nil
+	}
+
+	return nil, fmt.Errorf("unable to namespace cache: %T", c)
+}
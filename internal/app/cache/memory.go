@@ -0,0 +1,257 @@
+package cache
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/cache"
+	"go.uber.org/zap"
+)
+
+var _ cache.Cache = (*Memory)(nil)
+
+// Memory is a cache.Cache held in memory, nothing is persisted between runs.
+// Useful for tests, or small orgs where the cache doesn't need to survive a restart.
+type Memory struct {
+	mu       *sync.RWMutex
+	items    map[string]*MemoryItem
+	basePath string
+	options  cache.CacheOptions
+}
+
+// NewMemory creates an empty in-memory cache. basePath is only reported by BasePath, nothing is written to it.
+func NewMemory(basePath string, opts ...cache.CacheOption) *Memory {
+	return &Memory{
+		mu:       &sync.RWMutex{},
+		items:    make(map[string]*MemoryItem),
+		basePath: basePath,
+		options:  cache.NewCacheOptions(cache.CacheOptions{}, opts...),
+	}
+}
+
+// Namespace returns a cache sharing the items, with its keys in the namespace
+func (m *Memory) Namespace(ns string) *Memory {
+	n := *m
+	n.options.Namespace = ns
+	return &n
+}
+
+func (m *Memory) BasePath() string {
+	return m.basePath
+}
+
+func (m *Memory) key(key string) string {
+	return namespacedKey(m.options.Namespace, cleanKey(key))
+}
+
+func (m *Memory) prefix(p string) string {
+	k := cleanKey(p)
+	if k != "" {
+		k += "/"
+	}
+	return namespacedKey(m.options.Namespace, k)
+}
+
+func (m *Memory) cacheKey(key string) string {
+	if m.options.Namespace != "" {
+		return strings.TrimPrefix(key, m.options.Namespace+"/")
+	}
+	return key
+}
+
+// get returns the item if it's cached and not expired, m.mu must be held
+func (m *Memory) get(key string) (*MemoryItem, bool) {
+	i, ok := m.items[key]
+	if !ok || i.expired(time.Now()) {
+		return nil, false
+	}
+	return i, true
+}
+
+// each calls fn with the unexpired items under the prefix, sorted by key. m.mu must be held.
+func (m *Memory) each(prefix string, fn func(key string, i *MemoryItem)) {
+	keys := make([]string, 0)
+	now := time.Now()
+	for k, i := range m.items {
+		if strings.HasPrefix(k, prefix) && !i.expired(now) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		fn(k, m.items[k])
+	}
+}
+
+func (m *Memory) Exists(key string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, ok := m.get(m.key(key)); ok {
+		return true
+	}
+
+	found := false
+	m.each(m.prefix(key), func(string, *MemoryItem) {
+		found = true
+	})
+	return found
+}
+
+func (m *Memory) Get(key string) (cache.Item, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	k := m.key(key)
+	i, ok := m.get(k)
+	if !ok {
+		return nil, cache.ErrNotFound
+	}
+	return m.item(k, i), nil
+}
+
+// item is the stored item keyed relative to this cache's namespace, items are shared with caches in other namespaces
+func (m *Memory) item(k string, i *MemoryItem) *MemoryItem {
+	n := *i
+	n.key = m.cacheKey(k)
+	return &n
+}
+
+func (m *Memory) FindAll(name string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	found := make([]string, 0)
+	m.each(m.prefix(""), func(k string, i *MemoryItem) {
+		if path.Base(k) == name {
+			found = append(found, m.cacheKey(k))
+		}
+	})
+	return found, nil
+}
+
+func (m *Memory) Cache(key string, val []byte, opts ...cache.CacheOption) error {
+	o := cache.NewCacheOptions(m.options, opts...)
+	k := cleanKey(key)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.items[namespacedKey(o.Namespace, k)] = &MemoryItem{
+		key:       k,
+		value:     append([]byte{}, val...),
+		expiresAt: o.Expiry(),
+	}
+	return nil
+}
+
+func (m *Memory) CacheFromReader(key string, r io.Reader, opts ...cache.CacheOption) error {
+	val, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return m.Cache(key, val, opts...)
+}
+
+func (m *Memory) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.items, m.key(key))
+	return nil
+}
+
+func (m *Memory) DeleteAllWithPath(path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.items, m.key(path))
+	prefix := m.prefix(path)
+	for k := range m.items {
+		if strings.HasPrefix(k, prefix) {
+			delete(m.items, k)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) Flush() ([]cache.Item, error) {
+	return m.FlushWithPath("")
+}
+
+func (m *Memory) FlushWithPath(path string) ([]cache.Item, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	items := make([]cache.Item, 0)
+	m.each(m.prefix(path), func(k string, i *MemoryItem) {
+		items = append(items, m.item(k, i))
+	})
+	return items, nil
+}
+
+func (m *Memory) Keys(path string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	keys := make([]string, 0)
+	m.each(m.prefix(path), func(k string, i *MemoryItem) {
+		keys = append(keys, m.cacheKey(k))
+	})
+	return keys, nil
+}
+
+func (m *Memory) GetState(key string) []byte {
+	i, err := m.Get(key)
+	if err != nil {
+		return nil
+	}
+	return i.Value()
+}
+
+func (m *Memory) SetState(key string, data []byte) {
+	m.SetStateWithName(cache.StatePath(key), data)
+}
+
+func (m *Memory) SetStateWithName(key string, data []byte) {
+	m.Cache(key, data)
+	zap.S().Debugf("cache state updated: %s", key)
+}
+
+// MemoryItem is a cache.Item held by Memory, its value must not be modified
+type MemoryItem struct {
+	key       string
+	value     []byte
+	expiresAt uint64
+}
+
+func (i *MemoryItem) expired(now time.Time) bool {
+	return i.expiresAt > 0 && uint64(now.Unix()) >= i.expiresAt
+}
+
+func (i *MemoryItem) Key() string {
+	return i.key
+}
+
+func (i *MemoryItem) Value() []byte {
+	return i.value
+}
+
+func (i *MemoryItem) Reader() io.Reader {
+	return bytes.NewReader(i.value)
+}
+
+func (i *MemoryItem) Size() int64 {
+	return int64(len(i.value))
+}
+
+func (i *MemoryItem) ExpiresAt() uint64 {
+	return i.expiresAt
+}
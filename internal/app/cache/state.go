@@ -1,13 +1,13 @@
 package cache
 
 import (
-	"path/filepath"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/cache"
 )
 
 // state data structures and helper functions
 type StateOperation int
 const (
-	STATE_FILE = `.state`
+	STATE_FILE = cache.STATE_FILE
 
 	UPDATE StateOperation = iota
 	CLEAR
@@ -28,20 +28,3 @@ type StateUpdate struct {
 // 	zap.S().Debugf("State generated from values: %v", s)
 // 	return []byte(s)
 // }
-
-func getStatePath(cachePath string) string {
-	path, file := filepath.Split(cachePath)
-
-	// If no extention, then it's only a cache and not a file or `.state` file
-	ext := filepath.Ext(file)
-	if (ext == "") {
-		path = file
-	}
-
-	path = filepath.Join(path, STATE_FILE)
-	return path
-}
-
-
-
-
@@ -1,12 +1,19 @@
 package cistern
 
 import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
 	"github.com/Jeffail/tunny"
 	"github.com/spf13/viper"
-	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/app/cache"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/cache"
 	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/app/naptime"
-	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/logger"
 	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/restic"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/storage"
 	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/tools"
 	"go.uber.org/zap"
 )
@@ -17,64 +24,158 @@ const (
 
 	CONFIG_KEY_BATCH_SIZE = "cistern.batch_size"
 	CONFIG_KEY_MAX_JOBS = "cistern.max_jobs"
-	CONFIG_KEY_STORAGE = "s3"
+	CONFIG_KEY_TAGS = "cistern.tags"
+	CONFIG_KEY_STORAGE = "cistern.storage"
+	// Deprecated: restic on S3 config from before storage backends were selectable
+	CONFIG_KEY_STORAGE_S3 = "s3"
+
+	// Tag prefix for the object a backup is of, used to scope retention policies
+	TAG_PREFIX_OBJECT = storage.TAG_PREFIX_OBJECT
+	// Tag prefix for the org a backup is of, when backing up several orgs
+	TAG_PREFIX_ORG = storage.TAG_PREFIX_ORG
+	// Tag for backups of the org's configuration retrieved through the Metadata API
+	TAG_METADATA_API = "metadata-api"
+	// Tag for backups of schema drift reports
+	TAG_SCHEMA_DRIFT = "schema-drift"
+
+	// Items of caches not stored as files are written here to be backed up
+	STAGE_DIR = ".cistern"
+	STAGE_FILE_MODE = 0755
 )
 
+// ErrMissingItems is returned by Close when cache items queued for backup were gone before they were stored
+var ErrMissingItems = errors.New("queued cache items no longer exist")
+
 func init(){
 	viper.SetDefault(CONFIG_KEY_BATCH_SIZE, BATCH_SIZE)
 	viper.SetDefault(CONFIG_KEY_MAX_JOBS, MAX_JOBS)
 }
 
 type BackupRequest struct {
-	path string
+	key string
 	tags []string
 }
 
 type BatchRequest struct {
 	backups []BackupRequest
-	storage *restic.S3
+	storage storage.Storage
+	cache cache.Cache
+	stageDir string
+}
+
+// BatchResult is the outcome of a backup batch, a failed backup may still have stored a snapshot
+type BatchResult struct {
+	Backup *storage.BackupResult
+	Err error
+	// Missing are the keys queued that were gone from the cache, they can't be backed up
+	Missing []string
+}
+
+// Stats are the totals of the backups stored this session
+type Stats struct {
+	Snapshots []string `json:"snapshots"`
+	Files int64 `json:"files"`
+	Bytes int64 `json:"bytes"`
+	BytesAdded int64 `json:"bytes_added"`
+	Failures int `json:"failures"`
+	Missing int `json:"missing"`
 }
 
 type Cistern struct {
-	storage *restic.S3
-	cache *cache.Cache
+	storage storage.Storage
+	cache cache.Cache
+	stageDir string
+
+	mu sync.Mutex
+	stats Stats
+	pending map[string]bool
 
 	batchSize int
 	batch []BackupRequest
+	tags []string
 
 	backupRequests chan BackupRequest
 	Workers *tunny.Pool
-	maxWorkers int
 }
 
-func NewCistern(cache *cache.Cache, naptime *naptime.Naptime) *Cistern {
+// NewWorkers creates the pool of backup workers, shared by every Cistern and napping with the naptime
+func NewWorkers(naptime *naptime.Naptime) *tunny.Pool {
+	maxWorkers := viper.GetInt(CONFIG_KEY_MAX_JOBS)
+	workers := tunny.NewFunc(maxWorkers, func(i interface{}) interface{} {
+		return ProcessBackupBatch(i)
+	})
+
+	naptime.AddWorkerPool("Cistern Workers", workers, maxWorkers)
+
+	return workers
+}
+
+// NewCistern stores backups of the cache in the storage, with the workers.
+// Backups are tagged with `cistern.tags` and the tags.
+func NewCistern(cache cache.Cache, storage storage.Storage, workers *tunny.Pool, tags ...string) *Cistern {
 	c := &Cistern {
 		cache: cache,
+		storage: storage,
+		stageDir: filepath.Join(cache.BasePath(), STAGE_DIR),
+		pending: make(map[string]bool),
 		backupRequests: make(chan BackupRequest),
+		Workers: workers,
 	}
 	c.UpdateSettings()
+	c.tags = append(c.tags, tags...)
 
-	// Setup storage
-	storageConfig := restic.S3Config{}
-	err := viper.UnmarshalKey(CONFIG_KEY_STORAGE, &storageConfig)
-	logger.PanicCheck(err)
+	return c
+}
 
-	c.storage, err = restic.NewS3(&storageConfig)
-	logger.PanicCheck(err)
+// NewStorage connects to the storage backend defined in config, creating it if it doesn't exist.
+// Falls back to the legacy `s3` restic config when no `cistern.storage` is set.
+func NewStorage() (storage.Storage, error) {
+	if !viper.IsSet(CONFIG_KEY_STORAGE) && viper.IsSet(CONFIG_KEY_STORAGE_S3) {
+		s3Config := restic.S3Config{}
+		err := viper.UnmarshalKey(CONFIG_KEY_STORAGE_S3, &s3Config)
+		if err != nil {
+			return nil, err
+		}
 
-	c.Workers = tunny.NewFunc(c.maxWorkers, func(i interface{}) interface{} {
-		return ProcessBackupBatch(i)
-	})
+		return storage.New(storage.Config{
+			Type:   storage.TYPE_RESTIC,
+			Restic: *s3Config.RepositoryConfig(),
+		})
+	}
 
-	naptime.AddWorkerPool("Cistern Workers", c.Workers, c.maxWorkers)
+	storageConfig := storage.Config{}
+	err := viper.UnmarshalKey(CONFIG_KEY_STORAGE, &storageConfig)
+	if err != nil {
+		return nil, err
+	}
 
-	return c
+	return storage.New(storageConfig)
+}
+
+// ObjectTag is the tag for backups of an object's records and metadata
+func ObjectTag(object string) string {
+	return TAG_PREFIX_OBJECT + object
+}
+
+// OrgTag is the tag for backups of an org's data
+func OrgTag(org string) string {
+	return TAG_PREFIX_ORG + org
 }
 
-func (c *Cistern) StoreData(path string, tags... string) {
+// StoreData queues the cache key to be backed up, then deleted from the cache once it's stored.
+// Keys already queued are ignored.
+func (c *Cistern) StoreData(key string, tags... string) {
+	c.mu.Lock()
+	if c.pending[key] {
+		c.mu.Unlock()
+		return
+	}
+	c.pending[key] = true
+	c.mu.Unlock()
+
 	br := BackupRequest{
-		path: path, 
-		tags: tags,
+		key: key,
+		tags: append(append([]string{}, c.tags...), tags...),
 	}
 	c.batch = append(c.batch, br)
 	if len(c.batch) >= c.batchSize {
@@ -85,66 +186,216 @@ func (c *Cistern) StoreData(path string, tags... string) {
 func (c *Cistern) doBatch() error {
 	//shift leading batch off the batch map
 	s := c.batchSize
+	if s > len(c.batch) {
+		s = len(c.batch)
+	}
 	var b []BackupRequest
 	b, c.batch = c.batch[:s], c.batch[s:]
 
 	br := BatchRequest{
 		backups: b,
 		storage: c.storage,
+		cache: c.cache,
+		stageDir: c.stageDir,
 	}
-	err := c.Workers.Process(br)
-	if err != nil {
+	result, ok := c.Workers.Process(br).(*BatchResult)
+	if !ok {
+		result = &BatchResult{Err: errors.New("unexpected backup batch result")}
+	}
+	c.recordResult(result)
+
+	if result.Err != nil {
 		// if error processing batch, push back into the backup queue
 		c.batch = append(b, c.batch...)
-		return err.(error)
+		return result.Err
 	}
 
-	c.cleanBatch(b)
+	c.cleanBatch(b, result.Missing)
 	return nil
 }
 
-func (c *Cistern) cleanBatch(b []BackupRequest) {
+func (c *Cistern) recordResult(result *BatchResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if result.Err != nil {
+		c.stats.Failures++
+	}
+	c.stats.Missing += len(result.Missing)
+
+	r := result.Backup
+	if r == nil {
+		return
+	}
+	if r.SnapshotID != "" && !tools.StringSliceContaines(c.stats.Snapshots, r.SnapshotID) {
+		c.stats.Snapshots = append(c.stats.Snapshots, r.SnapshotID)
+	}
+	c.stats.Files += r.Files
+	c.stats.Bytes += r.Bytes
+	c.stats.BytesAdded += r.BytesAdded
+}
+
+// Stats returns the totals of the backups stored so far
+func (c *Cistern) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Snapshots = append([]string{}, c.stats.Snapshots...)
+	return stats
+}
+
+// Flush backs up any requests left in a partial batch
+func (c *Cistern) Flush() error {
+	for len(c.batch) > 0 {
+		if err := c.doBatch(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close flushes the remaining backups. The storage may be shared, so it's finished separately with CloseStorage.
+func (c *Cistern) Close() error {
+	if err := c.Flush(); err != nil {
+		return err
+	}
+
+	stats := c.Stats()
+	zap.S().Infow("Cistern backups stored", "snapshots", stats.Snapshots, "files", stats.Files, "bytes", stats.Bytes, "bytes_added", stats.BytesAdded, "failures", stats.Failures, "missing", stats.Missing)
+
+	if stats.Missing > 0 {
+		return fmt.Errorf("%w: %d", ErrMissingItems, stats.Missing)
+	}
+	return nil
+}
+
+// CloseStorage finishes the storage run, applying retention policies after if configured.
+// Retention is skipped when the run is incomplete, so backups aren't forgotten in favor of a run missing some of its data.
+func CloseStorage(s storage.Storage, complete bool) error {
+	if err := s.Close(); err != nil {
+		return err
+	}
+
+	if !viper.GetBool(CONFIG_KEY_RETENTION_AFTER_BACKUP) {
+		return nil
+	}
+	if !complete {
+		zap.S().Warn("backup run incomplete, skipping retention policies")
+		return nil
+	}
+
+	_, err := ApplyRetention(s, false)
+	return err
+}
+
+func (c *Cistern) cleanBatch(b []BackupRequest, missing []string) {
 	for _, cacheItem := range b {
-		err := c.cache.DeleteFile(cacheItem.path)
+		if tools.StringSliceContaines(missing, cacheItem.key) {
+			continue
+		}
+		err := c.cache.Delete(cacheItem.key)
 		if err != nil {
-			zap.S().Errorw("unable to delete cache item", "path", cacheItem, "error", err)
+			zap.S().Errorw("unable to delete cache item", "key", cacheItem.key, "error", err)
 		}
 	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, cacheItem := range b {
+		delete(c.pending, cacheItem.key)
+	}
 }
 
 func (c *Cistern) UpdateSettings() {
 	c.batchSize = viper.GetInt(CONFIG_KEY_BATCH_SIZE)
-	c.maxWorkers = viper.GetInt(CONFIG_KEY_MAX_JOBS)
+	c.tags = viper.GetStringSlice(CONFIG_KEY_TAGS)
 }
 
-// Returning nil means the backup was successful
+// Returns a *BatchResult, the backup was successful if it has no error
 func ProcessBackupBatch(i interface{}) (er interface{}) {
 	defer func(){
 		if e := recover(); e != nil {
 			zap.S().Errorw("unable to backup batch", "error", e)
-			er = e
+			er = &BatchResult{Err: fmt.Errorf("%v", e)}
 		}
 	}()
 
 	batch := i.(BatchRequest)
 
-	paths := make([]string, 0)
-	args := make([]string, 0)
+	// Backups are stored separately per set of tags, so retention policies can be scoped by them
+	groups := make(map[string][]string)
+	groupTags := make(map[string][]string)
+	order := make([]string, 0)
+	staged := make([]string, 0)
+	missing := make([]string, 0)
+	defer func() {
+		for _, p := range staged {
+			os.Remove(p)
+		}
+	}()
+
 	for _, b := range batch.backups {
-		paths = append(paths, b.path)
-		args = tools.StringSliceWeave(restic.CMD_ARG_TAG, b.tags, tools.SHUTTLE_RIGHT)
+		path, isStaged, err := stageItem(batch.cache, batch.stageDir, b.key)
+		if err == cache.ErrNotFound {
+			// nothing else should delete a key while it's queued, it's lost from this backup
+			zap.S().Errorw("queued cache item no longer exists, unable to back it up", "key", b.key)
+			missing = append(missing, b.key)
+			continue
+		}
+		if err != nil {
+			zap.S().Errorw("unable to stage cache item for backup", "key", b.key, "error", err)
+			return &BatchResult{Err: err}
+		}
+		if isStaged {
+			staged = append(staged, path)
+		}
+
+		key := strings.Join(b.tags, ",")
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+			groupTags[key] = b.tags
+		}
+		groups[key] = append(groups[key], path)
 	}
 
-	cmd := make([]string, 0)
-	cmd = append(cmd, restic.CMD_BACKUP)
-	cmd = append(cmd, args...)
-	cmd = append(cmd, paths...)
-	_, err := batch.storage.RunCmd(cmd...)
-	if err != nil {
-		zap.S().Errorw("unable to backup batch", "error", err)
-		return err
+	total := &storage.BackupResult{}
+	for _, key := range order {
+		result, err := batch.storage.Backup(groups[key], groupTags[key]...)
+		if result != nil {
+			total.SnapshotID = result.SnapshotID
+			total.Files += result.Files
+			total.Bytes += result.Bytes
+			total.BytesAdded += result.BytesAdded
+			zap.S().Infow("batch backed up", "snapshot", result.SnapshotID, "tags", groupTags[key], "files", result.Files, "bytes", result.Bytes, "bytes_added", result.BytesAdded)
+		}
+		if err != nil {
+			zap.S().Errorw("unable to backup batch", "tags", groupTags[key], "error", err)
+			return &BatchResult{Backup: total, Err: err, Missing: missing}
+		}
 	}
 
-	return nil
+	return &BatchResult{Backup: total, Missing: missing}
 }
 
+// stageItem returns the path of the cached item on disk, writing it to the stage dir if the cache isn't stored as files
+func stageItem(c cache.Cache, stageDir string, key string) (path string, staged bool, err error) {
+	if fc, ok := c.(cache.FileCache); ok {
+		if !fc.Exists(key) {
+			return "", false, cache.ErrNotFound
+		}
+		return fc.FilePath(key), false, nil
+	}
+
+	item, err := c.Get(key)
+	if err != nil {
+		return "", false, err
+	}
+
+	path = filepath.Join(stageDir, filepath.FromSlash(item.Key()))
+	if err := os.MkdirAll(filepath.Dir(path), STAGE_FILE_MODE); err != nil {
+		return "", false, err
+	}
+
+	return path, true, os.WriteFile(path, item.Value(), STAGE_FILE_MODE)
+}
@@ -0,0 +1,76 @@
+package cistern
+
+import (
+	"fmt"
+
+	"github.com/spf13/viper"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/storage"
+	"go.uber.org/zap"
+)
+
+const (
+	RETENTION_AFTER_BACKUP = false
+	RETENTION_PRUNE        = true
+
+	CONFIG_KEY_RETENTION_POLICIES     = "cistern.retention.policies"
+	CONFIG_KEY_RETENTION_AFTER_BACKUP = "cistern.retention.after_backup"
+	CONFIG_KEY_RETENTION_PRUNE        = "cistern.retention.prune"
+)
+
+func init() {
+	viper.SetDefault(CONFIG_KEY_RETENTION_AFTER_BACKUP, RETENTION_AFTER_BACKUP)
+	viper.SetDefault(CONFIG_KEY_RETENTION_PRUNE, RETENTION_PRUNE)
+}
+
+// RetentionPolicies returns the retention policies defined in config
+func RetentionPolicies() ([]storage.RetentionPolicy, error) {
+	policies := make([]storage.RetentionPolicy, 0)
+	err := viper.UnmarshalKey(CONFIG_KEY_RETENTION_POLICIES, &policies)
+	return policies, err
+}
+
+// ApplyRetention forgets the runs in storage that none of the configured retention policies keep.
+// Only snapshots with any of the tags are considered, or every snapshot if no tags are given.
+// With dryRun nothing is removed, the results show what would be.
+func ApplyRetention(s storage.Storage, dryRun bool, tags ...string) ([]storage.ForgetResult, error) {
+	f, ok := s.(storage.Forgetter)
+	if !ok {
+		return nil, fmt.Errorf("storage %T doesn't support retention policies", s)
+	}
+
+	policies, err := RetentionPolicies()
+	if err != nil {
+		return nil, err
+	}
+	if len(policies) == 0 {
+		zap.S().Warnf("no retention policies defined in `%s`, nothing to forget", CONFIG_KEY_RETENTION_POLICIES)
+		return nil, nil
+	}
+	for _, p := range policies {
+		if err := p.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid retention policy for tags %v: %w", p.Tags, err)
+		}
+	}
+
+	snapshots, err := s.Snapshots(tags...)
+	if err != nil {
+		return nil, err
+	}
+
+	// every policy's keep set is worked out before anything is forgotten
+	results := storage.PlanRetention(snapshots, policies)
+	for _, g := range results {
+		zap.S().Infow("retention policies applied", "tags", g.Tags, "keep", len(g.Keep), "remove", len(g.Remove), "dry_run", dryRun)
+	}
+
+	removed := storage.Removed(results)
+	if dryRun || len(removed) == 0 {
+		return results, nil
+	}
+
+	if err := f.Forget(removed, viper.GetBool(CONFIG_KEY_RETENTION_PRUNE)); err != nil {
+		return results, fmt.Errorf("unable to forget snapshots: %w", err)
+	}
+
+	return results, nil
+}
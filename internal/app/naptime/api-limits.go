@@ -0,0 +1,93 @@
+package naptime
+
+import (
+	"sync"
+	"time"
+
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/client"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/salesforce"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/salesforce/api"
+	"go.uber.org/zap"
+)
+
+// APILimitsNapConditions naps before the org's daily limits run out, leaving the reserve for the org's other integrations.
+// Limits are tracked from every response, and polled from the org when they haven't been reported within the poll interval.
+type APILimitsNapConditions struct {
+	mu           sync.Mutex
+	client       client.Client
+	tracker      *salesforce.LimitTracker
+	limits       []string
+	reserve      float64
+	pollInterval time.Duration
+	lastPoll     time.Time
+}
+
+// NewAPILimitsNapConditions naps when less than the reserve, a fraction of each limit's max, remains of any of the limits
+func NewAPILimitsNapConditions(c client.Client, tracker *salesforce.LimitTracker, reserve float64, pollInterval time.Duration, limits ...string) *APILimitsNapConditions {
+	return &APILimitsNapConditions{
+		client:       c,
+		tracker:      tracker,
+		limits:       limits,
+		reserve:      reserve,
+		pollInterval: pollInterval,
+	}
+}
+
+func (anc *APILimitsNapConditions) IsNapTime() (bool, error) {
+	err := anc.poll()
+	if err != nil {
+		zap.S().Errorf("error getting org limits: %v", err)
+	}
+
+	for _, name := range anc.limits {
+		l, _, ok := anc.tracker.Get(name)
+		if !ok || l.Max <= 0 {
+			continue
+		}
+
+		if float64(l.Remaining) <= float64(l.Max)*anc.reserve {
+			zap.S().Warnw("org limit nearly exhausted", "limit", name, "remaining", l.Remaining, "max", l.Max, "reserve", anc.reserve)
+			return true, nil
+		}
+	}
+	return false, err
+}
+
+// poll gets the limits from the org, unless they were all reported within the poll interval
+func (anc *APILimitsNapConditions) poll() error {
+	anc.mu.Lock()
+	defer anc.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(anc.lastPoll) < anc.pollInterval {
+		return nil
+	}
+
+	fresh := true
+	for _, name := range anc.limits {
+		_, updated, ok := anc.tracker.Get(name)
+		if !ok || now.Sub(updated) >= anc.pollInterval {
+			fresh = false
+			break
+		}
+	}
+	if fresh {
+		return nil
+	}
+
+	limits, err := api.GetLimits(api.WithClient(anc.client))
+	if err != nil {
+		return err
+	}
+	anc.lastPoll = now
+
+	tracked := make(map[string]salesforce.Limit, len(anc.limits))
+	for _, name := range anc.limits {
+		if l, ok := limits[name]; ok {
+			tracked[name] = l
+		}
+	}
+	anc.tracker.Update(tracked)
+
+	return nil
+}
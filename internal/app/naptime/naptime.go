@@ -22,6 +22,8 @@ type WorkerPool struct {
 	label string
 	pool *tunny.Pool
 	size int
+	// conditions only nap this pool, as well as the naptime's conditions
+	conditions []Condition
 }
 
 func NewNaptime(interval time.Duration, conditions... Condition) *Naptime {
@@ -38,11 +40,13 @@ func (nt *Naptime) Stop() {
 	close(nt.stop)
 }
 
-func (nt *Naptime) AddWorkerPool(label string, pool *tunny.Pool, size int) {
+// AddWorkerPool naps the pool with the naptime's conditions, and any conditions of its own
+func (nt *Naptime) AddWorkerPool(label string, pool *tunny.Pool, size int, conditions... Condition) {
 	wp := WorkerPool{
 		label: label,
 		pool: pool,
 		size: size,
+		conditions: conditions,
 	}
 	nt.workerPools = append(nt.workerPools, wp)
 	zap.S().Debugw("worker pool added to naptime", "pool", pool, "size", size)
@@ -62,22 +66,36 @@ func (nt *Naptime) MonitorConditions()  {
 }
 
 func(nt *Naptime) checkConditions() {
-	for _, cond := range nt.conditions {
-
-		sleepy, err := cond.IsNapTime()
-		if err != nil {
-			zap.S().Errorf("%+v", err)
-		}
-		
-		for _, wp := range nt.workerPools {
-			currSize := wp.pool.GetSize()
-			if sleepy && currSize != 0 {
-				zap.S().Warnf("Naptime for %s!", wp.label)
-				wp.pool.SetSize(0)
-			} else if currSize == 0 {
-				zap.S().Warnf("Waking up %s!", wp.label)
-				wp.pool.SetSize(wp.size)
+	// conditions shared by several pools are only checked once
+	checked := make(map[Condition]bool)
+	isNapTime := func(conditions []Condition) bool {
+		sleepy := false
+		for _, cond := range conditions {
+			s, ok := checked[cond]
+			if !ok {
+				var err error
+				s, err = cond.IsNapTime()
+				if err != nil {
+					zap.S().Errorf("%+v", err)
+				}
+				checked[cond] = s
 			}
+			sleepy = sleepy || s
+		}
+		return sleepy
+	}
+
+	sleepy := isNapTime(nt.conditions)
+	for _, wp := range nt.workerPools {
+		poolSleepy := sleepy || isNapTime(wp.conditions)
+
+		currSize := wp.pool.GetSize()
+		if poolSleepy && currSize != 0 {
+			zap.S().Warnf("Naptime for %s!", wp.label)
+			wp.pool.SetSize(0)
+		} else if !poolSleepy && currSize == 0 {
+			zap.S().Warnf("Waking up %s!", wp.label)
+			wp.pool.SetSize(wp.size)
 		}
 	}
 }
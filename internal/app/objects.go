@@ -0,0 +1,49 @@
+package app
+
+import (
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/app/surveyor"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/salesforce/api"
+)
+
+// ListObjects returns the basic metadata for every object in the Salesforce org
+func ListObjects(org string) ([]api.SObject, error) {
+	o, err := FindOrg(org)
+	if err != nil {
+		return nil, err
+	}
+
+	sf, err := o.NewSession()
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := api.DescribeGlobal(api.WithClient(sf))
+	if err != nil {
+		return nil, err
+	}
+
+	return results.SObjects, nil
+}
+
+// SelectedObjects returns the basic metadata for the objects the org's object policy selects for backup
+func SelectedObjects(org string) ([]api.SObject, error) {
+	o, err := FindOrg(org)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := o.Objects
+	if policy == nil {
+		policy, err = surveyor.NewObjectPolicy()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sobjects, err := ListObjects(org)
+	if err != nil {
+		return nil, err
+	}
+
+	return policy.Select(sobjects), nil
+}
@@ -0,0 +1,128 @@
+package app
+
+import (
+	"fmt"
+
+	"github.com/spf13/viper"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/app/cistern"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/app/surveyor"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/salesforce"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/storage"
+)
+
+const (
+	// Orgs backed up in one session, when unset the single org in `salesforce` is backed up
+	CONFIG_KEY_ORGS = "orgs"
+)
+
+// OrgConfig is an org backed up alongside others, isolated in its own cache namespace
+type OrgConfig struct {
+	Name       string                      `mapstructure:"name"`
+	Salesforce salesforce.SalesforceConfig `mapstructure:"salesforce"`
+	// Objects overrides `surveyor.objects` for the org
+	Objects *surveyor.ObjectPolicy `mapstructure:"objects"`
+	// CacheNamespace defaults to the org's name
+	CacheNamespace string `mapstructure:"cache_namespace"`
+	// Tags are added to the org's backups, along with `org:<name>`
+	Tags []string `mapstructure:"tags"`
+	// Storage overrides `cistern.storage` for the org, e.g. its own restic repository
+	Storage *storage.Config `mapstructure:"storage"`
+}
+
+// LoadOrgs reads the orgs to back up from config, or the single org in `salesforce` if there's no list of orgs.
+// The single org has no name, it's backed up without a cache namespace or org tag.
+func LoadOrgs() ([]OrgConfig, error) {
+	if !viper.IsSet(CONFIG_KEY_ORGS) {
+		org := OrgConfig{}
+		err := viper.UnmarshalKey(salesforce.CONFIG_KEY, &org.Salesforce)
+		return []OrgConfig{org}, err
+	}
+
+	orgs := make([]OrgConfig, 0)
+	if err := viper.UnmarshalKey(CONFIG_KEY_ORGS, &orgs); err != nil {
+		return nil, err
+	}
+	if len(orgs) == 0 {
+		return nil, fmt.Errorf("no orgs set in `%s`", CONFIG_KEY_ORGS)
+	}
+
+	names := make(map[string]bool, len(orgs))
+	namespaces := make(map[string]bool, len(orgs))
+	for i := range orgs {
+		org := &orgs[i]
+		if org.Name == "" {
+			return nil, fmt.Errorf("org %d in `%s` has no name", i, CONFIG_KEY_ORGS)
+		}
+		if names[org.Name] {
+			return nil, fmt.Errorf("org `%s` is set more than once in `%s`", org.Name, CONFIG_KEY_ORGS)
+		}
+		names[org.Name] = true
+
+		if org.CacheNamespace == "" {
+			org.CacheNamespace = org.Name
+		}
+		if namespaces[org.CacheNamespace] {
+			return nil, fmt.Errorf("org `%s` shares its cache namespace `%s` with another org", org.Name, org.CacheNamespace)
+		}
+		namespaces[org.CacheNamespace] = true
+
+		if org.Objects != nil {
+			if err := org.Objects.Compile(); err != nil {
+				return nil, fmt.Errorf("invalid objects for org `%s`: %w", org.Name, err)
+			}
+		}
+	}
+
+	return orgs, nil
+}
+
+// BackupTags are the tags added to the org's backups
+func (o OrgConfig) BackupTags() []string {
+	if o.Name == "" {
+		return o.Tags
+	}
+	return append([]string{cistern.OrgTag(o.Name)}, o.Tags...)
+}
+
+// FindOrg returns the org with the name from config, or the only org if no name is given
+func FindOrg(name string) (OrgConfig, error) {
+	orgs, err := LoadOrgs()
+	if err != nil {
+		return OrgConfig{}, err
+	}
+
+	if name == "" {
+		if len(orgs) > 1 {
+			return OrgConfig{}, fmt.Errorf("%d orgs are set in `%s`, an org name is required", len(orgs), CONFIG_KEY_ORGS)
+		}
+		return orgs[0], nil
+	}
+
+	for _, org := range orgs {
+		if org.Name == name {
+			return org, nil
+		}
+	}
+	return OrgConfig{}, fmt.Errorf("org `%s` isn't set in `%s`", name, CONFIG_KEY_ORGS)
+}
+
+// NewSession connects to the org's Salesforce
+func (o OrgConfig) NewSession() (*salesforce.Salesforce, error) {
+	return salesforce.NewSessionWithConfig(o.Salesforce)
+}
+
+// NewStorage connects to the org's own storage, or the `cistern.storage` it shares with other orgs
+func (o OrgConfig) NewStorage() (storage.Storage, error) {
+	if o.Storage != nil {
+		return storage.New(*o.Storage)
+	}
+	return cistern.NewStorage()
+}
+
+// SnapshotTags select the org's snapshots in storage, there are none for the single unnamed org
+func (o OrgConfig) SnapshotTags() []string {
+	if o.Name == "" {
+		return nil
+	}
+	return []string{cistern.OrgTag(o.Name)}
+}
@@ -2,6 +2,7 @@ package siphon
 
 import (
 	"path/filepath"
+	"strings"
 
 	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/app/cache"
 	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/app/surveyor"
@@ -12,22 +13,49 @@ type CacheType int
 const (
 	METADATA CacheType = iota
 	RECORD
+	BLOB
+	METADATA_API
+	SCHEMA_DRIFT
 	STATE
+	// Items still being written, the complete item is created once they're renamed
+	PARTIAL
 	UNKNOWN
 )
 
 func cacheType(path string) CacheType {
 	_, file := filepath.Split(path)
 
+	if strings.HasSuffix(file, cache.EXT_PARTIAL) {
+		return PARTIAL
+	}
+	if strings.HasPrefix(filepath.ToSlash(path), surveyor.METADATA_API_DIR+"/") {
+		return METADATA_API
+	}
+	if strings.HasPrefix(filepath.ToSlash(path), surveyor.SCHEMA_DRIFT_DIR+"/") {
+		return SCHEMA_DRIFT
+	}
 	if file == surveyor.METADATA_FILE_NAME {
 		return METADATA
 	}
-	if filepath.Ext(file) == cache.EXT_CSV {
+	if filepath.Ext(file) == "."+cache.EXT_CSV {
 		return RECORD
 	}
+	if filepath.Ext(file) == "."+cache.EXT_BLOB {
+		return BLOB
+	}
 	if file == cache.STATE_FILE {
 		return STATE
 	}
 
 	return UNKNOWN
-}
\ No newline at end of file
+}
+// cacheObject is the object a record or metadata cache file is for.
+// Records are cached as `<Object>.<page>.csv`, or `<Object>.<Id>.csv` split per record, blobs as `<Object>.<Id>.<Field>.blob`,
+// and metadata in the object's dir, `<Object>/metadata.json`.
+func cacheObject(path string) string {
+	_, file := filepath.Split(path)
+	if ct := cacheType(path); ct == RECORD || ct == BLOB {
+		return strings.SplitN(file, ".", 2)[0]
+	}
+	return filepath.Base(filepath.Dir(path))
+}
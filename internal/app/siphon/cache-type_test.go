@@ -0,0 +1,27 @@
+package siphon
+
+import "testing"
+
+func TestCacheType(t *testing.T) {
+	tests := []struct {
+		path string
+		want CacheType
+	}{
+		{"Account/metadata.json", METADATA},
+		{"Account.0.csv", RECORD},
+		{"Attachment.00P000000000001.Body.blob", BLOB},
+		{"metadata-api/objects/Account.object", METADATA_API},
+		{"schema-drift/20211015T200000Z.json", SCHEMA_DRIFT},
+		{"Account/.state", STATE},
+		{"Account.0.csv.partial", PARTIAL},
+		{"metadata-api/objects/Account.object.partial", PARTIAL},
+		{"schema-drift/20211015T200000Z.json.partial", PARTIAL},
+		{"Account/notes.txt", UNKNOWN},
+	}
+
+	for _, tt := range tests {
+		if got := cacheType(tt.path); got != tt.want {
+			t.Errorf("cacheType(%q) = %d, want %d", tt.path, got, tt.want)
+		}
+	}
+}
@@ -1,30 +1,38 @@
 package siphon
 
 import (
+	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/Jeffail/tunny"
 	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/viper"
-	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/app/cache"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/cache"
 	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/app/cistern"
 	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/app/naptime"
 	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/app/surveyor"
 	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/logger"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/tools"
 	"go.uber.org/zap"
 )
 
 const (
 	MAX_JOBS = 3
 	DRAIN_ON_START = true
+	DRAIN_INTERVAL = "30s"
 
 	CONFIG_KEY_MAX_JOBS = "siphon.max_jobs"
 	CONFIG_KEY_DRAIN_ON_START = "siphone.drain_on_start"
+	// How often caches that can't be watched for new files are drained
+	CONFIG_KEY_DRAIN_INTERVAL = "siphon.drain_interval"
 
 )
 
 func init(){
 	viper.SetDefault(CONFIG_KEY_MAX_JOBS, MAX_JOBS)
 	viper.SetDefault(CONFIG_KEY_DRAIN_ON_START, DRAIN_ON_START)
+	viper.SetDefault(CONFIG_KEY_DRAIN_INTERVAL, DRAIN_INTERVAL)
 }
 
 type SiphonWorker tunny.Worker
@@ -32,36 +40,86 @@ type SiphonWorker tunny.Worker
 type Siphon struct {
 	surveyor *surveyor.Surveyor
 	cistern *cistern.Cistern
-	cache *cache.Cache
+	cache cache.Cache
 	napTime *naptime.Naptime
 
 	done chan struct{}
+	finished chan struct{}
 	
 	watcher *fsnotify.Watcher
 	drainOnStart bool
+	drainInterval time.Duration
 }
 
 // TODO: jeeeeez fix this - oof
-func NewSiphon(surveyor *surveyor.Surveyor, cistern *cistern.Cistern, cache *cache.Cache) *Siphon {
+func NewSiphon(surveyor *surveyor.Surveyor, cistern *cistern.Cistern, cache cache.Cache) *Siphon {
 
 	s := &Siphon{
 		surveyor: surveyor,
 		cistern: cistern,
 		cache: cache,
 		drainOnStart: true,
+		finished: make(chan struct{}),
 	}
-	//Setup file system watcher
-	var err error
-	s.watcher, err = fsnotify.NewWatcher()
-	logger.PanicCheck(err)
+	s.UpdateSettings()
 
 	return s
 }
 
+func (s *Siphon) UpdateSettings() {
+	s.drainOnStart = viper.GetBool(CONFIG_KEY_DRAIN_ON_START)
+
+	di, err := tools.ParseDuration(viper.GetString(CONFIG_KEY_DRAIN_INTERVAL))
+	if err != nil || di <= 0 {
+		zap.S().Errorf("unable to parse `%s` in Siphon config, using default: %s", CONFIG_KEY_DRAIN_INTERVAL, DRAIN_INTERVAL)
+		di, _ = tools.ParseDuration(DRAIN_INTERVAL)
+	}
+	s.drainInterval = di
+}
+
+// Start siphons cached records and metadata into the Cistern as they're cached.
+// Caches stored as files are watched for new files, other caches are drained on an interval.
 func (s *Siphon) Start(baseDir string, done chan struct{}) error {
 
-	s.watcher.Add(baseDir)
+	fc, watchable := s.cache.(cache.FileCache)
+	if watchable {
+		//Setup file system watcher
+		var err error
+		s.watcher, err = fsnotify.NewWatcher()
+		logger.PanicCheck(err)
+		s.watchDirs(fc.FilePath(""))
+	}
+
 	s.surveyor.Start(done)
+
+	if s.drainOnStart {
+		s.Drain()
+	}
+
+	// drain whatever the watcher hasn't siphoned yet once the Surveyor's finished
+	go func() {
+		select {
+		case <-s.surveyor.Finished():
+			s.Drain()
+			close(s.finished)
+		case <-done:
+		}
+	}()
+
+	if !watchable {
+		go func() {
+			for {
+				select {
+				case <-time.After(s.drainInterval):
+					s.Drain()
+				case <-done:
+					return
+				}
+			}
+		}()
+		return nil
+	}
+
 	go func ()  {
 		for {
 			select {
@@ -73,6 +131,7 @@ func (s *Siphon) Start(baseDir string, done chan struct{}) error {
 
 			case <-done:
 				s.watcher.Close()
+				return
 			}
 		}
 	}()
@@ -80,59 +139,105 @@ func (s *Siphon) Start(baseDir string, done chan struct{}) error {
 	return nil
 }
 
-func (s *Siphon) Intake(path... string) {
-	for _, p := range path {
-		zap.S().Debugf("siphoning to cistern: %s", p)
-		s.cistern.StoreData(p)
+// Finished is closed once the Surveyor has finished and everything it cached has been siphoned into the Cistern
+func (s *Siphon) Finished() <-chan struct{} {
+	return s.finished
+}
+
+// watchDirs adds a watcher to the dir and every dir under it, fsnotify doesn't watch recursively
+func (s *Siphon) watchDirs(dir string) {
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return nil
+		}
+		if err := s.watcher.Add(path); err != nil {
+			zap.S().Errorw("unable to attach siphon watcher to dir", "path", path, "error", err)
+		}
+		return nil
+	})
+}
+
+// cacheKey converts a path from a watcher event to its cache key
+func (s *Siphon) cacheKey(path string) string {
+	fc := s.cache.(cache.FileCache)
+	rel, err := filepath.Rel(fc.FilePath(""), path)
+	if err != nil {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
+
+func (s *Siphon) Intake(key... string) {
+	for _, k := range key {
+		zap.S().Debugf("siphoning to cistern: %s", k)
+		s.cistern.StoreData(k, cistern.ObjectTag(cacheObject(k)))
 	}
 }
 
+// Drain siphons everything already cached into the Cistern
 func (s *Siphon) Drain() error {
 
-	cache, err := s.surveyor.FlushCache()
-	logger.PanicCheck(err)
+	keys, err := s.surveyor.CachedKeys()
+	if err != nil {
+		zap.S().Errorw("unable to drain cache", "error", err)
+		return err
+	}
 
-	for _, c := range cache {
-		s.handleCache(c.Name())
+	for _, k := range keys {
+		s.handleCache(k)
 	}
 
 	return nil
 }
 
-func (s *Siphon) handleCache(path string) {
+func (s *Siphon) handleCache(key string) {
 
-	ct := cacheType(path)
+	ct := cacheType(key)
 	switch ct {
-	case STATE:
+	case STATE, PARTIAL:
 		return
 	case RECORD:
-		s.Intake(path)
+		s.Intake(key)
+		return
+	case BLOB:
+		s.Intake(key)
+		return
+	case METADATA_API:
+		// org configuration isn't of any one object
+		s.cistern.StoreData(key, cistern.TAG_METADATA_API)
+		return
+	case SCHEMA_DRIFT:
+		s.cistern.StoreData(key, cistern.TAG_SCHEMA_DRIFT)
 		return
 	case METADATA:
-		s.Intake(path)
+		s.Intake(key)
 		return
 
 	}
 
-	info, err := s.cache.Stat(path)
-	logger.PanicCheck(err)
+	zap.S().Debugf("skipping unknown cache type: %s", key)
+}
+
+func (s *Siphon) handleCacheCreate(path string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		zap.S().Warnw("unable to stat created cache path", "path", path, "error", err)
+		return
+	}
 
 	if info.IsDir() {
-		err := s.watcher.Add(info.Name())
-		if err != nil {
-			zap.S().Errorw("unable to attach siphon watcher to dir", "path", info, "error", err)
-		}
+		s.watchDirs(path)
 		return
 	}
 
-	zap.S().Debugf("skipping unknown cache type: %s", path)
+	s.handleCache(s.cacheKey(path))
 }
 
 func (s *Siphon) handleCacheEvent(event fsnotify.Event) {
 	
 	switch {
 	case event.Op&fsnotify.Create == fsnotify.Create:
-		s.handleCache(event.Name)
+		s.handleCacheCreate(event.Name)
 	case event.Op&fsnotify.Write == fsnotify.Write:
 		zap.S().Debugw("write to cache detected", "event", event)
 		return
@@ -150,44 +255,20 @@ func (s *Siphon) handleCacheEvent(event fsnotify.Event) {
 	}
 }
 
+// Cache items are removed by the Cistern once they're stored, only watchers need cleaning up
 func (s *Siphon) handleCacheRemove(path string) {
-
-	info, err := s.cache.Stat(path)
-	logger.PanicCheck(err)
-
-	if info.IsDir() {
-		s.watcher.Remove(path)
-		zap.S().Debugf("removed file watcher from %s", path)
-		return
-	}
+	// fsnotify removes watches of deleted dirs itself, this errors for files
+	s.watcher.Remove(path)
 
 	ct := cacheType(path)
 	switch ct {
 	case STATE:
-		err := s.cache.DeleteFile(path)
-		if err != nil {
-			zap.S().Errorw("unable to remove state", "path", path, "error", err)
-			return
-		}
 		zap.S().Debugf("state file removed: %s", path)
-		return
 	case RECORD:
-		err := s.cache.DeleteFile(path)
-		if err != nil {
-			zap.S().Errorw("unable to remove cache path", "path", path, "error", err)
-			return
-		}
 		zap.S().Debugf("record file removed: %s", path)
-		return
 	case METADATA:
-		err := s.cache.DeleteFile(path)
-		if err != nil {
-			zap.S().Errorw("unable to remove metadata", "path", path, "error", err)
-			return
-		}
 		zap.S().Debugf("metadata file removed: %s", path)
-		return
 	default:
-		zap.S().Warnf("cannot remove unknown cache object: %v", path)
+		zap.S().Debugf("cache path removed: %s", path)
 	}
 }
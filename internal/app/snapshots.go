@@ -0,0 +1,204 @@
+package app
+
+import (
+	"fmt"
+
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/app/cistern"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/app/spigot"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/storage"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/tools"
+	"go.uber.org/zap"
+)
+
+// orgStorage is a storage and the tags selecting the snapshots of the orgs worked on in it
+type orgStorage struct {
+	name    string
+	storage storage.Storage
+	tags    []string
+}
+
+// orgStorages connects to the storage of the named org, or to every org's storage if no name is given.
+// The `cistern.storage` shared by orgs without their own storage is only connected to once.
+func orgStorages(name string) ([]orgStorage, error) {
+	if name != "" {
+		org, err := FindOrg(name)
+		if err != nil {
+			return nil, err
+		}
+		s, err := org.NewStorage()
+		if err != nil {
+			return nil, err
+		}
+		return []orgStorage{{name: org.Name, storage: s, tags: org.SnapshotTags()}}, nil
+	}
+
+	orgs, err := LoadOrgs()
+	if err != nil {
+		return nil, err
+	}
+
+	storages := make([]orgStorage, 0, len(orgs))
+	shared := false
+	for _, org := range orgs {
+		if org.Storage == nil {
+			shared = true
+			continue
+		}
+		s, err := org.NewStorage()
+		if err != nil {
+			return nil, fmt.Errorf("unable to connect to the storage of org `%s`: %w", org.Name, err)
+		}
+		storages = append(storages, orgStorage{name: org.Name, storage: s, tags: org.SnapshotTags()})
+	}
+	if shared {
+		s, err := cistern.NewStorage()
+		if err != nil {
+			return nil, err
+		}
+		storages = append([]orgStorage{{name: cistern.CONFIG_KEY_STORAGE, storage: s}}, storages...)
+	}
+
+	return storages, nil
+}
+
+// Snapshots lists the snapshots of the org in storage, optionally filtered by tags
+func Snapshots(org string, tags ...string) ([]storage.Snapshot, error) {
+	UpdateSettings()
+
+	o, err := FindOrg(org)
+	if err != nil {
+		return nil, err
+	}
+	s, err := o.NewStorage()
+	if err != nil {
+		return nil, err
+	}
+
+	orgTags := o.SnapshotTags()
+	if len(orgTags) == 0 {
+		return s.Snapshots(tags...)
+	}
+
+	snapshots, err := s.Snapshots(orgTags...)
+	if err != nil || len(tags) == 0 {
+		return snapshots, err
+	}
+	filtered := make([]storage.Snapshot, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		for _, t := range tags {
+			if tools.StringSliceContaines(snapshot.Tags, t) {
+				filtered = append(filtered, snapshot)
+				break
+			}
+		}
+	}
+	return filtered, nil
+}
+
+// Restore restores a snapshot of the org from storage into the target directory
+func Restore(org string, snapshotID string, target string, include ...string) error {
+	UpdateSettings()
+
+	o, err := FindOrg(org)
+	if err != nil {
+		return err
+	}
+	s, err := o.NewStorage()
+	if err != nil {
+		return err
+	}
+
+	// the latest snapshot in storage shared with other orgs may not be the org's
+	if tags := o.SnapshotTags(); len(tags) > 0 && (snapshotID == "" || snapshotID == storage.SNAPSHOT_LATEST) {
+		snapshots, err := s.Snapshots(tags...)
+		if err != nil {
+			return err
+		}
+		if len(snapshots) == 0 {
+			return fmt.Errorf("no snapshots of org `%s` found to restore", o.Name)
+		}
+		latest := snapshots[0]
+		for _, snapshot := range snapshots[1:] {
+			if snapshot.Time.After(latest.Time) {
+				latest = snapshot
+			}
+		}
+		snapshotID = latest.ID
+	}
+
+	zap.S().Infow("restoring snapshot", "org", o.Name, "snapshot", snapshotID, "target", target, "include", include)
+	return s.Restore(snapshotID, target, include...)
+}
+
+// Verify checks the integrity of the backups of the org in storage, or of every org's storage if no org is given
+func Verify(org string) error {
+	UpdateSettings()
+
+	storages, err := orgStorages(org)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range storages {
+		zap.S().Infow("verifying storage", "storage", s.name)
+		if err := s.storage.Check(); err != nil {
+			return fmt.Errorf("verifying storage of `%s`: %w", s.name, err)
+		}
+	}
+	return nil
+}
+
+// Forget applies the configured retention policies to the snapshots of the org in storage,
+// or to every org's snapshots if no org is given.
+// With dryRun nothing is removed, the results show what would be.
+func Forget(org string, dryRun bool) ([]storage.ForgetResult, error) {
+	UpdateSettings()
+
+	storages, err := orgStorages(org)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]storage.ForgetResult, 0)
+	for _, s := range storages {
+		r, err := cistern.ApplyRetention(s.storage, dryRun, s.tags...)
+		if err != nil {
+			return results, fmt.Errorf("applying retention to storage of `%s`: %w", s.name, err)
+		}
+		results = append(results, r...)
+	}
+	return results, nil
+}
+
+// RestoreRecords restores the records of the objects in a snapshot of the org back into its Salesforce org.
+// externalIDs maps objects to the field used to match existing records, overriding config.
+// remapIDs creates new records instead of matching existing ones, for restoring into a different org.
+func RestoreRecords(org string, snapshotID string, objects []string, externalIDs map[string]string, remapIDs bool) error {
+	UpdateSettings()
+
+	o, err := FindOrg(org)
+	if err != nil {
+		return err
+	}
+
+	sf, err := o.NewSession()
+	if err != nil {
+		return err
+	}
+
+	storage, err := o.NewStorage()
+	if err != nil {
+		return err
+	}
+
+	s := spigot.NewSpigot(sf, storage, baseDir)
+	s.SetSnapshotTags(o.SnapshotTags()...)
+	for object, field := range externalIDs {
+		s.SetExternalIDField(object, field)
+	}
+	if remapIDs {
+		s.SetRemapIDs(remapIDs)
+	}
+
+	return s.Restore(snapshotID, objects...)
+}
@@ -0,0 +1,94 @@
+package spigot
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/salesforce/api"
+	"go.uber.org/zap"
+)
+
+const (
+	FILE_MODE = 0755
+)
+
+// runIngestJob creates an Ingest Job, uploads the CSV data and waits for Salesforce to finish processing it
+func (s *Spigot) runIngestJob(object string, operation string, data []byte, options ...api.APIOption) (api.IngestJob, error) {
+	options = append(options, api.WithClient(s.client))
+
+	job, err := api.CreateIngestJob(object, operation, options...)
+	if err != nil {
+		return job, err
+	}
+	zap.S().Infow("Ingest Job created", "job", job.ID, "object", object, "operation", operation)
+
+	err = api.UploadIngestJobData(job.ID, bytes.NewReader(data), api.WithClient(s.client))
+	if err != nil {
+		if _, abortErr := api.AbortIngestJob(job.ID, api.WithClient(s.client)); abortErr != nil {
+			zap.S().Errorw("unable to abort Ingest Job", "job", job.ID, "error", abortErr)
+		}
+		return job, err
+	}
+
+	job, err = api.CloseIngestJob(job.ID, api.WithClient(s.client))
+	if err != nil {
+		return job, err
+	}
+
+	return s.waitForIngestJob(job.ID)
+}
+
+// waitForIngestJob polls the Ingest Job until Salesforce is done processing it
+func (s *Spigot) waitForIngestJob(jobID string) (api.IngestJob, error) {
+	for {
+		job, err := api.GetIngestJob(jobID, api.WithClient(s.client))
+		if err != nil {
+			return job, err
+		}
+
+		zap.S().Debugw("Ingest Job status", "job", job.ID, "state", job.State, "processed", job.NumberRecordsProcessed, "failed", job.NumberRecordsFailed)
+		switch {
+		case job.Complete():
+			zap.S().Infow("Ingest Job complete", "job", job.ID, "object", job.Object, "processed", job.NumberRecordsProcessed, "failed", job.NumberRecordsFailed)
+			return job, nil
+		case job.Failed():
+			return job, fmt.Errorf("ingest job %s failed: %s", job.ID, job.ErrorMessage)
+		case job.Aborted():
+			return job, errors.New("ingest job aborted: " + job.ID)
+		}
+
+		<-time.After(s.pollInterval)
+	}
+}
+
+// saveResults writes the failed and unprocessed records of an Ingest Job to the results dir
+func (s *Spigot) saveResults(job api.IngestJob, dir string) error {
+	if job.NumberRecordsFailed == 0 && job.NumberRecordsProcessed > 0 {
+		return nil
+	}
+
+	err := os.MkdirAll(dir, FILE_MODE)
+	if err != nil {
+		return err
+	}
+
+	for _, resultType := range []string{api.INGEST_RESULTS_FAILED, api.INGEST_RESULTS_UNPROCESSED} {
+		results, err := api.GetIngestJobResults(job.ID, resultType, api.WithClient(s.client))
+		if err != nil {
+			return err
+		}
+
+		path := filepath.Join(dir, fmt.Sprintf("%s.%s.%s.csv", job.Object, job.ID, resultType))
+		err = os.WriteFile(path, results.Data, FILE_MODE)
+		if err != nil {
+			return err
+		}
+		zap.S().Warnw("Ingest Job records not restored", "job", job.ID, "object", job.Object, "results", path)
+	}
+
+	return nil
+}
@@ -0,0 +1,208 @@
+package spigot
+
+import (
+	"sort"
+
+	"go.uber.org/zap"
+)
+
+const (
+	FIELD_TYPE_REFERENCE = "reference"
+)
+
+// Plan is the order objects are restored in, so records are created before the records that look them up
+type Plan struct {
+	Steps []PlanStep
+}
+
+// PlanStep restores an object's records.
+// Deferred fields are lookups to itself, or to objects restored later in a cycle with this one. They are
+// left empty when the records are created, and set in a second update pass once every record in the cycle exists.
+type PlanStep struct {
+	Object          string
+	ReferenceFields map[string][]string
+	DeferredFields  []string
+}
+
+// NewPlan orders the objects topologically using the lookup fields in their describe metadata.
+// Cycles are broken by deferring the lookup fields between the objects in the cycle.
+func NewPlan(records map[string]*ObjectRecords) *Plan {
+	g := newDependencyGraph(records)
+
+	plan := &Plan{}
+	for _, scc := range g.stronglyConnected() {
+		position := make(map[string]int, len(scc))
+		for i, o := range scc {
+			position[o] = i
+		}
+
+		for i, o := range scc {
+			step := PlanStep{
+				Object:          o,
+				ReferenceFields: g.fields[o],
+			}
+			// Only lookups to itself, or objects later in the cycle, don't exist yet
+			for field, refs := range g.fields[o] {
+				for _, r := range refs {
+					if p, inCycle := position[r]; inCycle && p >= i {
+						step.DeferredFields = append(step.DeferredFields, field)
+						break
+					}
+				}
+			}
+			sort.Strings(step.DeferredFields)
+			plan.Steps = append(plan.Steps, step)
+		}
+	}
+
+	zap.S().Debugw("restore plan created", "plan", plan)
+	return plan
+}
+
+// Objects returns the objects in the order they're restored
+func (p *Plan) Objects() []string {
+	objects := make([]string, len(p.Steps))
+	for i, s := range p.Steps {
+		objects[i] = s.Object
+	}
+	return objects
+}
+
+// dependencyGraph links each object to the objects its lookup fields reference
+type dependencyGraph struct {
+	objects []string
+	// object -> lookup field -> referenced objects being restored
+	fields map[string]map[string][]string
+	edges  map[string][]string
+}
+
+func newDependencyGraph(records map[string]*ObjectRecords) *dependencyGraph {
+	g := &dependencyGraph{
+		fields: make(map[string]map[string][]string),
+		edges:  make(map[string][]string),
+	}
+
+	for o := range records {
+		g.objects = append(g.objects, o)
+		g.fields[o] = make(map[string][]string)
+	}
+	sort.Strings(g.objects)
+
+	addReference := func(object string, field string, ref string) {
+		if _, ok := records[ref]; !ok {
+			return
+		}
+		for _, r := range g.fields[object][field] {
+			if r == ref {
+				return
+			}
+		}
+		g.fields[object][field] = append(g.fields[object][field], ref)
+	}
+
+	for _, o := range g.objects {
+		sobj := records[o].Metadata
+		if sobj == nil {
+			continue
+		}
+
+		for _, f := range sobj.Fields {
+			if f.Type != FIELD_TYPE_REFERENCE {
+				continue
+			}
+			for _, ref := range f.Referenceto {
+				addReference(o, f.Name, ref)
+			}
+		}
+
+		// Child relationships fill in lookups for children restored without their own metadata
+		for _, cr := range sobj.Childrelationships {
+			if child, ok := records[cr.Childsobject]; ok && child.Metadata == nil && cr.Field != "" {
+				addReference(cr.Childsobject, cr.Field, o)
+			}
+		}
+	}
+
+	for o, fields := range g.fields {
+		seen := make(map[string]bool)
+		for _, refs := range fields {
+			for _, r := range refs {
+				if !seen[r] {
+					seen[r] = true
+					g.edges[o] = append(g.edges[o], r)
+				}
+			}
+		}
+		sort.Strings(g.edges[o])
+	}
+
+	return g
+}
+
+// stronglyConnected uses Tarjan's algorithm to group objects into cycles.
+// Groups are returned with the objects they reference first.
+func (g *dependencyGraph) stronglyConnected() [][]string {
+	index := 0
+	indexes := make(map[string]int)
+	lowLinks := make(map[string]int)
+	onStack := make(map[string]bool)
+	stack := make([]string, 0)
+	sccs := make([][]string, 0)
+
+	var connect func(o string)
+	connect = func(o string) {
+		indexes[o] = index
+		lowLinks[o] = index
+		index++
+		stack = append(stack, o)
+		onStack[o] = true
+
+		for _, ref := range g.edges[o] {
+			if _, visited := indexes[ref]; !visited {
+				connect(ref)
+				lowLinks[o] = min(lowLinks[o], lowLinks[ref])
+			} else if onStack[ref] {
+				lowLinks[o] = min(lowLinks[o], indexes[ref])
+			}
+		}
+
+		if lowLinks[o] == indexes[o] {
+			scc := make([]string, 0)
+			for {
+				top := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[top] = false
+				scc = append(scc, top)
+				if top == o {
+					break
+				}
+			}
+			sort.Strings(scc)
+			sccs = append(sccs, scc)
+		}
+	}
+
+	for _, o := range g.objects {
+		if _, visited := indexes[o]; !visited {
+			connect(o)
+		}
+	}
+
+	return sccs
+}
+
+func min(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// referenceColumns returns the lookup fields of an object that reference records being restored
+func referenceColumns(step PlanStep) map[string]bool {
+	refs := make(map[string]bool, len(step.ReferenceFields))
+	for field := range step.ReferenceFields {
+		refs[field] = true
+	}
+	return refs
+}
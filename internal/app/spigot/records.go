@@ -0,0 +1,340 @@
+package spigot
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gocarina/gocsv"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/app/cache"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/app/surveyor"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/salesforce/api"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/salesforce/soql"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/tools"
+	"go.uber.org/zap"
+)
+
+// ObjectRecords are the record CSVs and metadata for an object restored from a snapshot
+type ObjectRecords struct {
+	Object   string
+	Metadata *api.SObject
+	Files    []string
+	// Tombstones are CSVs of the records deleted since earlier backups
+	Tombstones []string
+
+	header []string
+	index  map[string]int
+	rows   [][]string
+}
+
+// FindRecords walks a restored snapshot, grouping the record CSVs and metadata by object.
+// Record CSVs are cached by the Surveyor as `<Object>.<page>.csv`, and tombstones as `<Object>.<page>.deleted.csv`.
+func FindRecords(dir string, objects ...string) (map[string]*ObjectRecords, error) {
+	records := make(map[string]*ObjectRecords)
+
+	get := func(object string) *ObjectRecords {
+		or, ok := records[object]
+		if !ok {
+			or = &ObjectRecords{Object: object}
+			records[object] = or
+		}
+		return or
+	}
+
+	metadata := make(map[string]*api.SObject)
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		name := d.Name()
+		if name == surveyor.METADATA_FILE_NAME {
+			sobj, err := readMetadata(path)
+			if err != nil {
+				zap.S().Warnw("unable to read object metadata, restoring all columns", "path", path, "error", err)
+				return nil
+			}
+			metadata[sobj.Name] = sobj
+			return nil
+		}
+
+		if filepath.Ext(name) != "."+cache.EXT_CSV {
+			return nil
+		}
+
+		parts := strings.Split(name, ".")
+		tombstone := len(parts) == 4 && parts[2] == surveyor.TOMBSTONE_SUFFIX
+		if len(parts) != 3 && !tombstone {
+			return nil
+		}
+
+		object := parts[0]
+		if len(objects) > 0 && !tools.StringSliceContaines(objects, object) {
+			return nil
+		}
+
+		or := get(object)
+		if tombstone {
+			or.Tombstones = append(or.Tombstones, path)
+		} else {
+			or.Files = append(or.Files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for object, or := range records {
+		or.Metadata = metadata[object]
+	}
+
+	return records, nil
+}
+
+func readMetadata(path string) (*api.SObject, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	sobj := &api.SObject{}
+	err = json.Unmarshal(data, sobj)
+	if err != nil {
+		return nil, err
+	}
+
+	return sobj, nil
+}
+
+// Load reads every record CSV for the object, aligning rows to the union of the CSV headers.
+// Records deleted after they were backed up are left out.
+func (or *ObjectRecords) Load() error {
+	header, rows, err := read(or.Files)
+	if err != nil {
+		return err
+	}
+
+	or.header = header
+	or.rows = rows
+	or.index = make(map[string]int, len(header))
+	for i, col := range header {
+		or.index[col] = i
+	}
+
+	return or.applyTombstones()
+}
+
+// applyTombstones drops the rows of deleted records, unless the record was changed again after it was deleted
+func (or *ObjectRecords) applyTombstones() error {
+	if len(or.Tombstones) == 0 {
+		return nil
+	}
+
+	header, rows, err := read(or.Tombstones)
+	if err != nil {
+		return err
+	}
+	tombstones := &ObjectRecords{header: header, index: make(map[string]int, len(header))}
+	for i, col := range header {
+		tombstones.index[col] = i
+	}
+
+	deleted := make(map[string]string, len(rows))
+	for _, r := range rows {
+		id := tombstones.Value(r, api.ID_FIELD)
+		if at := tombstones.modified(r); at > deleted[id] || deleted[id] == "" {
+			deleted[id] = at
+		}
+	}
+
+	kept := make([][]string, 0, len(or.rows))
+	for _, r := range or.rows {
+		at, ok := deleted[or.Value(r, api.ID_FIELD)]
+		// watermark times are RFC3339 in UTC, so they compare as strings
+		if ok && (at == "" || or.modified(r) <= at) {
+			continue
+		}
+		kept = append(kept, r)
+	}
+
+	zap.S().Infow("deleted records left out of restore", "object", or.Object, "deleted", len(or.rows)-len(kept))
+	or.rows = kept
+	return nil
+}
+
+// modified is the row's SystemModstamp, or LastModifiedDate if it has none
+func (or *ObjectRecords) modified(row []string) string {
+	if v := or.Value(row, soql.SOQL_FIELD_SYSTEM_MODSTAMP); v != "" {
+		return v
+	}
+	return or.Value(row, soql.SOQL_FIELD_LAST_MODIFIED)
+}
+
+// Value returns a row's value for the column, or an empty string if the column doesn't exist
+func (or *ObjectRecords) Value(row []string, col string) string {
+	if i, ok := or.index[col]; ok && i < len(row) {
+		return row[i]
+	}
+	return ""
+}
+
+// Upload is a CSV of records to upload to an Ingest Job
+type Upload struct {
+	Header []string
+	Data   []byte
+	// Rows and the original Id of each record, used to match Ingest Job results back to the backup
+	Rows   [][]string
+	OldIDs []string
+}
+
+// Uploads writes the object's records into CSV uploads of at most maxSize bytes.
+// The row func returns the values for the columns of a record, or false to skip the record.
+func (or *ObjectRecords) Uploads(maxSize int, columns []string, row func([]string) ([]string, bool)) ([]Upload, error) {
+	uploads := make([]Upload, 0)
+	if len(columns) == 0 {
+		zap.S().Warnw("no writeable fields found in records", "object", or.Object)
+		return uploads, nil
+	}
+
+	var up Upload
+	var buf *bytes.Buffer
+	var w *gocsv.SafeCSVWriter
+
+	next := func() {
+		up = Upload{Header: columns}
+		buf = new(bytes.Buffer)
+		w = gocsv.DefaultCSVWriter(buf)
+		w.Write(columns)
+	}
+
+	done := func() error {
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return err
+		}
+		if len(up.OldIDs) > 0 {
+			up.Data = buf.Bytes()
+			uploads = append(uploads, up)
+		}
+		return nil
+	}
+
+	next()
+	for _, r := range or.rows {
+		out, ok := row(r)
+		if !ok {
+			continue
+		}
+
+		w.Write(out)
+		w.Flush()
+		up.Rows = append(up.Rows, out)
+		up.OldIDs = append(up.OldIDs, or.Value(r, api.ID_FIELD))
+
+		if buf.Len() >= maxSize {
+			if err := done(); err != nil {
+				return nil, err
+			}
+			next()
+		}
+	}
+
+	if err := done(); err != nil {
+		return nil, err
+	}
+
+	return uploads, nil
+}
+
+// read returns the union of every CSV file's header, and each row aligned to it
+func read(files []string) ([]string, [][]string, error) {
+	header := make([]string, 0)
+	index := make(map[string]int)
+	rows := make([][]string, 0, len(files))
+
+	for _, path := range files {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		r := gocsv.DefaultCSVReader(f)
+		fileHeader, err := r.Read()
+		if err != nil {
+			f.Close()
+			zap.S().Warnw("unable to read record CSV header, skipping", "path", path, "error", err)
+			continue
+		}
+
+		for _, col := range fileHeader {
+			if _, ok := index[col]; !ok {
+				index[col] = len(header)
+				header = append(header, col)
+			}
+		}
+
+		for {
+			row, err := r.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				zap.S().Warnw("unable to read record CSV row, skipping", "path", path, "error", err)
+				break
+			}
+
+			aligned := make([]string, len(header))
+			for i, v := range row {
+				aligned[index[fileHeader[i]]] = v
+			}
+			rows = append(rows, aligned)
+		}
+		f.Close()
+	}
+
+	// pad earlier rows if later files added columns
+	for i, row := range rows {
+		if len(row) < len(header) {
+			rows[i] = append(row, make([]string, len(header)-len(row))...)
+		}
+	}
+
+	return header, rows, nil
+}
+
+// WriteableFields returns the columns that can be written to the object, along with the external ID
+// field used to match records. The Id column is only kept when it's used to match records.
+func (or *ObjectRecords) WriteableFields(externalID string, exclude ...string) []string {
+	writeable := make(map[string]bool)
+	if or.Metadata != nil {
+		for _, f := range or.Metadata.Fields {
+			writeable[f.Name] = f.Createable || f.Updateable
+		}
+	}
+
+	columns := make([]string, 0, len(or.header))
+	for _, col := range or.header {
+		switch {
+		case tools.StringSliceContaines(exclude, col):
+			continue
+		case col == externalID:
+			columns = append(columns, col)
+		case col == api.ID_FIELD:
+			// Salesforce rejects the Id when matching records on another field
+			continue
+		case or.Metadata == nil || writeable[col]:
+			columns = append(columns, col)
+		}
+	}
+
+	return columns
+}
@@ -0,0 +1,171 @@
+package spigot
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gocarina/gocsv"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/salesforce/api"
+	"go.uber.org/zap"
+)
+
+const (
+	ID_MAP_FILE_NAME = "id-map.csv"
+
+	rowKeySeparator = "\x1f"
+)
+
+// IdMap maps the Ids of records in a backup to the Ids of the records created when restoring them
+type IdMap struct {
+	mu      sync.RWMutex
+	ids     map[string]string
+	objects map[string]string
+}
+
+func NewIdMap() *IdMap {
+	return &IdMap{
+		ids:     make(map[string]string),
+		objects: make(map[string]string),
+	}
+}
+
+func (m *IdMap) Set(object string, oldID string, newID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.ids[oldID] = newID
+	m.objects[oldID] = object
+}
+
+func (m *IdMap) Get(oldID string) (string, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	newID, ok := m.ids[oldID]
+	return newID, ok
+}
+
+// Remap returns the new Id for a backed up Id, or the Id unchanged if it wasn't restored.
+// Unchanged Ids are kept so lookups to records that weren't restored, like Users, still resolve.
+func (m *IdMap) Remap(oldID string) string {
+	if newID, ok := m.Get(oldID); ok {
+		return newID
+	}
+	return oldID
+}
+
+func (m *IdMap) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return len(m.ids)
+}
+
+// AddResults maps the records in an upload to the Ids in the successful results of its Ingest Job.
+// Results are matched to the upload by the key column, or by every value in the row if no key column is given.
+func (m *IdMap) AddResults(object string, up Upload, results []byte, keyColumn string) (int, error) {
+	keyIndex := -1
+	for i, col := range up.Header {
+		if col == keyColumn {
+			keyIndex = i
+		}
+	}
+
+	pending := make(map[string][]string, len(up.Rows))
+	for i, row := range up.Rows {
+		key := rowKey(row, keyIndex)
+		pending[key] = append(pending[key], up.OldIDs[i])
+	}
+
+	r := gocsv.DefaultCSVReader(bytes.NewReader(results))
+	header, err := r.Read()
+	if err == io.EOF {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	resultIndex := make(map[string]int, len(header))
+	for i, col := range header {
+		resultIndex[col] = i
+	}
+
+	idIndex, ok := resultIndex[api.INGEST_RESULTS_COLUMN_ID]
+	if !ok {
+		return 0, nil
+	}
+
+	mapped := 0
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return mapped, err
+		}
+
+		// align the result to the upload columns
+		values := make([]string, len(up.Header))
+		for i, col := range up.Header {
+			if ri, ok := resultIndex[col]; ok && ri < len(row) {
+				values[i] = row[ri]
+			}
+		}
+
+		key := rowKey(values, keyIndex)
+		oldIDs := pending[key]
+		if len(oldIDs) == 0 {
+			zap.S().Warnw("unable to match Ingest Job result to a backed up record", "object", object, "id", row[idIndex])
+			continue
+		}
+
+		pending[key] = oldIDs[1:]
+		if oldIDs[0] == "" {
+			continue
+		}
+		m.Set(object, oldIDs[0], row[idIndex])
+		mapped++
+	}
+
+	return mapped, nil
+}
+
+// Save writes the Id map to a CSV file, so restored records can be traced back to the backup
+func (m *IdMap) Save(path string) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	oldIDs := make([]string, 0, len(m.ids))
+	for oldID := range m.ids {
+		oldIDs = append(oldIDs, oldID)
+	}
+	sort.Strings(oldIDs)
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := gocsv.DefaultCSVWriter(f)
+	w.Write([]string{"Object", "OldId", "NewId"})
+	for _, oldID := range oldIDs {
+		w.Write([]string{m.objects[oldID], oldID, m.ids[oldID]})
+	}
+	w.Flush()
+
+	return w.Error()
+}
+
+func rowKey(row []string, keyIndex int) string {
+	if keyIndex >= 0 && keyIndex < len(row) && row[keyIndex] != "" {
+		return row[keyIndex]
+	}
+	return strings.Join(row, rowKeySeparator)
+}
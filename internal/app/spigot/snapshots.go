@@ -0,0 +1,97 @@
+package spigot
+
+import (
+	"sort"
+	"strings"
+
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/app/cistern"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/storage"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/tools"
+	"go.uber.org/zap"
+)
+
+// restoreSource is a snapshot to restore the records of the objects from
+type restoreSource struct {
+	SnapshotID string
+	Objects    []string
+}
+
+// resolveSnapshots finds the snapshots holding the objects' records.
+// A run can be stored as several snapshots, each object is restored from every snapshot of the latest run that backed it up,
+// or of the run with the ID. IDs that aren't a run are restored as a single snapshot.
+// Sources are ordered oldest first, so restoring them in order leaves the newest files.
+func resolveSnapshots(snapshots []storage.Snapshot, snapshotID string, objects []string) []restoreSource {
+	runs := storage.GroupRuns(snapshots)
+
+	if snapshotID != "" && snapshotID != storage.SNAPSHOT_LATEST {
+		var match []storage.Run
+		for _, r := range runs {
+			if r.ID == snapshotID {
+				match = append(match, r)
+			}
+		}
+		if len(match) == 0 {
+			return []restoreSource{{SnapshotID: snapshotID, Objects: objects}}
+		}
+		runs = match
+	}
+
+	if len(objects) == 0 {
+		objects = runObjects(runs)
+	}
+
+	// objects of each snapshot to restore
+	bySnapshot := make(map[string][]string)
+	snapshotsByID := make(map[string]storage.Snapshot)
+	for _, o := range objects {
+		tag := cistern.ObjectTag(o)
+		found := false
+		for i := len(runs) - 1; i >= 0 && !found; i-- {
+			for _, s := range runs[i].Snapshots {
+				if !tools.StringSliceContaines(s.Tags, tag) {
+					continue
+				}
+				found = true
+				bySnapshot[s.ID] = append(bySnapshot[s.ID], o)
+				snapshotsByID[s.ID] = s
+			}
+		}
+		if !found {
+			zap.S().Warnw("no snapshots found with the object's records", "object", o, "snapshot", snapshotID)
+		}
+	}
+
+	sources := make([]restoreSource, 0, len(bySnapshot))
+	for id, objs := range bySnapshot {
+		sources = append(sources, restoreSource{SnapshotID: id, Objects: objs})
+	}
+	sort.Slice(sources, func(i, j int) bool {
+		a, b := snapshotsByID[sources[i].SnapshotID], snapshotsByID[sources[j].SnapshotID]
+		if !a.Time.Equal(b.Time) {
+			return a.Time.Before(b.Time)
+		}
+		return a.ID < b.ID
+	})
+
+	return sources
+}
+
+// runObjects are the objects backed up by any of the runs
+func runObjects(runs []storage.Run) []string {
+	seen := make(map[string]bool)
+	objects := make([]string, 0)
+	for _, r := range runs {
+		for _, t := range r.Tags {
+			if !strings.HasPrefix(t, cistern.TAG_PREFIX_OBJECT) {
+				continue
+			}
+			o := strings.TrimPrefix(t, cistern.TAG_PREFIX_OBJECT)
+			if !seen[o] {
+				seen[o] = true
+				objects = append(objects, o)
+			}
+		}
+	}
+	sort.Strings(objects)
+	return objects
+}
@@ -0,0 +1,99 @@
+package spigot
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/storage"
+)
+
+func TestResolveSnapshots(t *testing.T) {
+	day := time.Date(2021, 10, 15, 20, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return day.Add(time.Duration(minutes) * time.Minute) }
+
+	snapshots := []storage.Snapshot{
+		// the earlier run backed up Account and Contact, each in two batches
+		{ID: "a1", Time: at(0), Tags: []string{"object:Account", storage.RunTag("early")}},
+		{ID: "c1", Time: at(1), Tags: []string{"object:Contact", storage.RunTag("early")}},
+		{ID: "a2", Time: at(2), Tags: []string{"object:Account", storage.RunTag("early")}},
+		{ID: "c2", Time: at(3), Tags: []string{"object:Contact", storage.RunTag("early")}},
+		// the latest run only backed up Account
+		{ID: "a3", Time: at(60), Tags: []string{"object:Account", storage.RunTag("late")}},
+		{ID: "a4", Time: at(61), Tags: []string{"object:Account", storage.RunTag("late")}},
+		{ID: "m1", Time: at(62), Tags: []string{"metadata-api", storage.RunTag("late")}},
+	}
+
+	tests := []struct {
+		name       string
+		snapshotID string
+		objects    []string
+		want       []restoreSource
+	}{
+		{
+			name:       "latest run of each object",
+			snapshotID: storage.SNAPSHOT_LATEST,
+			want: []restoreSource{
+				{SnapshotID: "c1", Objects: []string{"Contact"}},
+				{SnapshotID: "c2", Objects: []string{"Contact"}},
+				{SnapshotID: "a3", Objects: []string{"Account"}},
+				{SnapshotID: "a4", Objects: []string{"Account"}},
+			},
+		},
+		{
+			name:       "latest run of the objects given",
+			snapshotID: "",
+			objects:    []string{"Account"},
+			want: []restoreSource{
+				{SnapshotID: "a3", Objects: []string{"Account"}},
+				{SnapshotID: "a4", Objects: []string{"Account"}},
+			},
+		},
+		{
+			name:       "run by ID",
+			snapshotID: "early",
+			objects:    []string{"Account"},
+			want: []restoreSource{
+				{SnapshotID: "a1", Objects: []string{"Account"}},
+				{SnapshotID: "a2", Objects: []string{"Account"}},
+			},
+		},
+		{
+			name:       "snapshot by ID",
+			snapshotID: "a2",
+			objects:    []string{"Account"},
+			want: []restoreSource{
+				{SnapshotID: "a2", Objects: []string{"Account"}},
+			},
+		},
+		{
+			name:       "object never backed up",
+			snapshotID: storage.SNAPSHOT_LATEST,
+			objects:    []string{"Lead"},
+			want:       []restoreSource{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := resolveSnapshots(snapshots, tt.snapshotID, tt.objects)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("resolveSnapshots() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveSnapshotsWholeRunSnapshots(t *testing.T) {
+	// archive and object store backends store a run as one snapshot tagged with every object
+	snapshots := []storage.Snapshot{
+		{ID: "20211014T200000Z", Time: time.Date(2021, 10, 14, 20, 0, 0, 0, time.UTC), Tags: []string{"object:Account", "object:Contact"}},
+		{ID: "20211015T200000Z", Time: time.Date(2021, 10, 15, 20, 0, 0, 0, time.UTC), Tags: []string{"object:Account", "object:Contact"}},
+	}
+
+	got := resolveSnapshots(snapshots, storage.SNAPSHOT_LATEST, nil)
+	want := []restoreSource{{SnapshotID: "20211015T200000Z", Objects: []string{"Account", "Contact"}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("resolveSnapshots() = %v, want %v", got, want)
+	}
+}
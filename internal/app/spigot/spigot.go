@@ -0,0 +1,338 @@
+package spigot
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/viper"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/app/cache"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/app/surveyor"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/client"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/salesforce/api"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/storage"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/tools"
+	"go.uber.org/zap"
+)
+
+// The Spigot draws records back out of the Cistern, restoring them into a Salesforce org
+
+const (
+	RESTORE_DIR      = ".restore"
+	POLL_INTERVAL    = "10s"
+	MAX_UPLOAD_SIZE  = 100 * 1024 * 1024 // BulkV2 allows 150MB per job upload, leave room for base64 encoding
+	RESULTS_DIR_NAME = "results"
+
+	CONFIG_KEY_RESTORE_DIR        = "spigot.restore_dir"
+	CONFIG_KEY_POLL_INTERVAL      = "spigot.poll_interval"
+	CONFIG_KEY_EXTERNAL_ID_FIELDS = "spigot.external_id_fields"
+	CONFIG_KEY_REMAP_IDS          = "spigot.remap_ids"
+)
+
+func init() {
+	viper.SetDefault(CONFIG_KEY_RESTORE_DIR, RESTORE_DIR)
+	viper.SetDefault(CONFIG_KEY_POLL_INTERVAL, POLL_INTERVAL)
+}
+
+type Spigot struct {
+	client  client.Client
+	storage storage.Storage
+
+	dir              string
+	pollInterval     time.Duration
+	externalIDFields map[string]string
+	remapIDs         bool
+	snapshotTags     []string
+}
+
+func NewSpigot(client client.Client, storage storage.Storage, baseDir string) *Spigot {
+	s := &Spigot{
+		client:  client,
+		storage: storage,
+	}
+	s.UpdateSettings(baseDir)
+
+	return s
+}
+
+// Restore pulls the record CSVs for the objects out of a run, or a snapshot, and upserts them into the org.
+// The latest run that backed up each object is restored by default, merging the snapshots the run was stored as.
+// If no objects are given, every object in the run is restored.
+func (s *Spigot) Restore(snapshotID string, objects ...string) error {
+	if snapshotID == "" {
+		snapshotID = storage.SNAPSHOT_LATEST
+	}
+
+	snapshots, err := s.storage.Snapshots(s.snapshotTags...)
+	if err != nil {
+		return err
+	}
+	sources := resolveSnapshots(snapshots, snapshotID, objects)
+	if len(sources) == 0 {
+		return fmt.Errorf("no snapshots found to restore records from: %s", snapshotID)
+	}
+
+	dir := filepath.Join(s.dir, snapshotID)
+	for _, src := range sources {
+		zap.S().Infow("restoring snapshot for records", "snapshot", src.SnapshotID, "dir", dir, "objects", src.Objects)
+		err := s.storage.Restore(src.SnapshotID, dir, includePatterns(src.Objects)...)
+		if err != nil {
+			return err
+		}
+	}
+
+	records, err := FindRecords(dir, objects...)
+	if err != nil {
+		return err
+	}
+
+	if len(records) == 0 {
+		zap.S().Warnw("no records found in snapshot", "snapshot", snapshotID, "objects", objects)
+		return nil
+	}
+
+	plan := NewPlan(records)
+	zap.S().Infow("restore order planned", "objects", plan.Objects(), "remap_ids", s.remapIDs)
+
+	resultsDir := filepath.Join(dir, RESULTS_DIR_NAME)
+	err = os.MkdirAll(resultsDir, FILE_MODE)
+	if err != nil {
+		return err
+	}
+
+	ids := NewIdMap()
+	failed := make(map[string]bool)
+	for _, step := range plan.Steps {
+		err := s.RestoreObject(records[step.Object], step, ids, resultsDir)
+		if err != nil {
+			zap.S().Errorw("unable to restore object records", "object", step.Object, "error", err)
+			failed[step.Object] = true
+		}
+	}
+
+	// Lookups deferred to break cycles can be set now every record in the cycle exists
+	if s.remapIDs {
+		for _, step := range plan.Steps {
+			if len(step.DeferredFields) == 0 || failed[step.Object] {
+				continue
+			}
+			err := s.restoreDeferred(records[step.Object], step, ids, resultsDir)
+			if err != nil {
+				zap.S().Errorw("unable to restore deferred lookups", "object", step.Object, "fields", step.DeferredFields, "error", err)
+				failed[step.Object] = true
+			}
+		}
+
+		err := ids.Save(filepath.Join(resultsDir, ID_MAP_FILE_NAME))
+		if err != nil {
+			zap.S().Errorw("unable to save restored Id map", "error", err)
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("unable to restore records for %d of %d objects", len(failed), len(plan.Steps))
+	}
+
+	zap.S().Infow("restore complete", "snapshot", snapshotID, "objects", len(plan.Steps), "remapped_ids", ids.Len())
+	return nil
+}
+
+// RestoreObject upserts an object's records, matching existing records by its external ID field.
+// When remapping Ids, records are created instead, and lookups are remapped to the Ids of restored records.
+func (s *Spigot) RestoreObject(or *ObjectRecords, step PlanStep, ids *IdMap, resultsDir string) error {
+	if or.Metadata != nil && !or.Metadata.Createable && !or.Metadata.Updateable {
+		zap.S().Warnw("object is not createable or updateable, skipping restore", "object", or.Object)
+		return nil
+	}
+
+	if err := or.Load(); err != nil {
+		return err
+	}
+
+	externalID := s.externalIDField(or.Object)
+	operation := api.INGEST_OPERATION_UPSERT
+	options := []api.APIOption{api.ExternalIDField(externalID)}
+	exclude := make([]string, 0)
+
+	if s.remapIDs {
+		exclude = append(exclude, step.DeferredFields...)
+		if externalID == api.ID_FIELD {
+			// Ids in the backup don't exist in the org, so the records are created with new Ids
+			operation = api.INGEST_OPERATION_INSERT
+			options = nil
+			exclude = append(exclude, api.ID_FIELD)
+		}
+	}
+
+	columns := or.WriteableFields(externalID, exclude...)
+	refs := referenceColumns(step)
+
+	uploads, err := or.Uploads(MAX_UPLOAD_SIZE, columns, func(r []string) ([]string, bool) {
+		out := make([]string, len(columns))
+		for i, col := range columns {
+			out[i] = or.Value(r, col)
+			if s.remapIDs && refs[col] {
+				out[i] = ids.Remap(out[i])
+			}
+		}
+		return out, true
+	})
+	if err != nil {
+		return err
+	}
+
+	zap.S().Infow("restoring object records", "object", or.Object, "files", len(or.Files), "jobs", len(uploads), "operation", operation, "external_id", externalID)
+	for _, up := range uploads {
+		job, err := s.runIngestJob(or.Object, operation, up.Data, options...)
+		if err != nil {
+			return err
+		}
+
+		err = s.saveResults(job, resultsDir)
+		if err != nil {
+			zap.S().Errorw("unable to save ingest job results", "job", job.ID, "error", err)
+		}
+
+		if s.remapIDs {
+			err = s.mapResults(job, up, ids, externalID)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// restoreDeferred updates the lookups deferred to break a cycle, using the Ids of the restored records
+func (s *Spigot) restoreDeferred(or *ObjectRecords, step PlanStep, ids *IdMap, resultsDir string) error {
+	fields := make([]string, 0, len(step.DeferredFields))
+	for _, f := range step.DeferredFields {
+		if or.Metadata != nil && !fieldUpdateable(or.Metadata, f) {
+			zap.S().Warnw("deferred lookup is not updateable, it will not be restored", "object", or.Object, "field", f)
+			continue
+		}
+		fields = append(fields, f)
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+
+	columns := append([]string{api.ID_FIELD}, fields...)
+	uploads, err := or.Uploads(MAX_UPLOAD_SIZE, columns, func(r []string) ([]string, bool) {
+		newID, ok := ids.Get(or.Value(r, api.ID_FIELD))
+		if !ok {
+			return nil, false
+		}
+
+		out := []string{newID}
+		empty := true
+		for _, f := range fields {
+			v := or.Value(r, f)
+			if v != "" {
+				empty = false
+				v = ids.Remap(v)
+			}
+			out = append(out, v)
+		}
+		return out, !empty
+	})
+	if err != nil {
+		return err
+	}
+
+	zap.S().Infow("restoring deferred lookups", "object", or.Object, "fields", fields, "jobs", len(uploads))
+	for _, up := range uploads {
+		job, err := s.runIngestJob(or.Object, api.INGEST_OPERATION_UPDATE, up.Data)
+		if err != nil {
+			return err
+		}
+
+		err = s.saveResults(job, resultsDir)
+		if err != nil {
+			zap.S().Errorw("unable to save ingest job results", "job", job.ID, "error", err)
+		}
+	}
+
+	return nil
+}
+
+// mapResults records the Ids of the records created by an Ingest Job
+func (s *Spigot) mapResults(job api.IngestJob, up Upload, ids *IdMap, externalID string) error {
+	results, err := api.GetIngestJobResults(job.ID, api.INGEST_RESULTS_SUCCESSFUL, api.WithClient(s.client))
+	if err != nil {
+		return err
+	}
+
+	keyColumn := ""
+	if externalID != api.ID_FIELD {
+		keyColumn = externalID
+	}
+
+	mapped, err := ids.AddResults(job.Object, up, results.Data, keyColumn)
+	if err != nil {
+		return err
+	}
+
+	zap.S().Infow("restored record Ids mapped", "object", job.Object, "job", job.ID, "mapped", mapped, "uploaded", len(up.OldIDs))
+	return nil
+}
+
+func fieldUpdateable(sobj *api.SObject, name string) bool {
+	for _, f := range sobj.Fields {
+		if f.Name == name {
+			return f.Updateable
+		}
+	}
+	return false
+}
+
+func (s *Spigot) externalIDField(object string) string {
+	if field, ok := s.externalIDFields[object]; ok && field != "" {
+		return field
+	}
+	return api.ID_FIELD
+}
+
+func (s *Spigot) UpdateSettings(baseDir string) {
+	s.dir = filepath.Join(baseDir, viper.GetString(CONFIG_KEY_RESTORE_DIR))
+	s.externalIDFields = viper.GetStringMapString(CONFIG_KEY_EXTERNAL_ID_FIELDS)
+	s.remapIDs = viper.GetBool(CONFIG_KEY_REMAP_IDS)
+
+	pollInterval, err := tools.ParseDuration(viper.GetString(CONFIG_KEY_POLL_INTERVAL))
+	if err != nil {
+		zap.S().Errorf("unable to parse `%s` in Spigot config", CONFIG_KEY_POLL_INTERVAL)
+		pollInterval, _ = tools.ParseDuration(POLL_INTERVAL)
+	}
+	s.pollInterval = pollInterval
+}
+
+// includePatterns limits a snapshot restore to the records and metadata of the objects
+func includePatterns(objects []string) []string {
+	include := make([]string, 0, len(objects)*2)
+	for _, o := range objects {
+		include = append(include, o+".*."+cache.EXT_CSV, filepath.Join(o, surveyor.METADATA_FILE_NAME))
+	}
+	return include
+}
+
+// SetRemapIDs overrides the config setting for creating records with new Ids.
+// Use when restoring into an org the records weren't backed up from, like a new sandbox.
+func (s *Spigot) SetRemapIDs(remap bool) {
+	s.remapIDs = remap
+}
+
+// SetSnapshotTags limits the snapshots records are restored from to those with any of the tags,
+// e.g. the org's tag when its backups share storage with other orgs.
+func (s *Spigot) SetSnapshotTags(tags ...string) {
+	s.snapshotTags = tags
+}
+
+// SetExternalIDField overrides the config external ID field used to match the object's records
+func (s *Spigot) SetExternalIDField(object string, field string) {
+	if s.externalIDFields == nil {
+		s.externalIDFields = make(map[string]string)
+	}
+	s.externalIDFields[object] = field
+}
@@ -0,0 +1,69 @@
+package surveyor
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/app/naptime"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/salesforce"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/tools"
+	"go.uber.org/zap"
+)
+
+const (
+	API_LIMITS               = true
+	API_LIMITS_RESERVE       = "10%"
+	API_LIMITS_POLL_INTERVAL = "5m"
+
+	CONFIG_KEY_API_LIMITS = "surveyor.api_limits.enabled"
+	// Share of each daily limit left for the org's other integrations, the Surveyor naps once it's all that remains
+	CONFIG_KEY_API_LIMITS_RESERVE       = "surveyor.api_limits.reserve"
+	CONFIG_KEY_API_LIMITS_POLL_INTERVAL = "surveyor.api_limits.poll_interval"
+)
+
+// Daily limits the Surveyor's requests count against
+var apiLimits = []string{
+	salesforce.LIMIT_DAILY_API_REQUESTS,
+	salesforce.LIMIT_DAILY_BULK_V2_QUERY_JOBS,
+}
+
+func init() {
+	viper.SetDefault(CONFIG_KEY_API_LIMITS, API_LIMITS)
+	viper.SetDefault(CONFIG_KEY_API_LIMITS_RESERVE, API_LIMITS_RESERVE)
+	viper.SetDefault(CONFIG_KEY_API_LIMITS_POLL_INTERVAL, API_LIMITS_POLL_INTERVAL)
+}
+
+// limitsClient is a client tracking its org's limits
+type limitsClient interface {
+	Limits() *salesforce.LimitTracker
+}
+
+// newAPILimitsNap returns the conditions napping the Surveyor's workers before the org's daily limits run out.
+// There are none if disabled, or the client doesn't track limits.
+func newAPILimitsNap(s *Surveyor) []naptime.Condition {
+	if !viper.GetBool(CONFIG_KEY_API_LIMITS) {
+		return nil
+	}
+	lc, ok := s.client.(limitsClient)
+	if !ok {
+		zap.S().Warn("client doesn't track org limits, Surveyor won't nap for them")
+		return nil
+	}
+
+	reserve, err := strconv.ParseFloat(strings.Trim(viper.GetString(CONFIG_KEY_API_LIMITS_RESERVE), "%"), 64)
+	if err != nil {
+		zap.S().Errorf("unable to parse `%s` in Surveyor config", CONFIG_KEY_API_LIMITS_RESERVE)
+		reserve, _ = strconv.ParseFloat(strings.Trim(API_LIMITS_RESERVE, "%"), 64)
+	}
+
+	poll, err := tools.ParseDuration(viper.GetString(CONFIG_KEY_API_LIMITS_POLL_INTERVAL))
+	if err != nil {
+		zap.S().Errorf("unable to parse `%s` in Surveyor config", CONFIG_KEY_API_LIMITS_POLL_INTERVAL)
+		poll, _ = tools.ParseDuration(API_LIMITS_POLL_INTERVAL)
+	}
+
+	return []naptime.Condition{
+		naptime.NewAPILimitsNapConditions(s.client, lc.Limits(), reserve/100, poll, apiLimits...),
+	}
+}
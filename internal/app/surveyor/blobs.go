@@ -0,0 +1,248 @@
+package surveyor
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/Jeffail/tunny"
+	"github.com/spf13/viper"
+	appcache "gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/app/cache"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/salesforce/api"
+	"go.uber.org/zap"
+)
+
+const (
+	BLOBS             = true
+	MAX_BLOB_JOBS     = 2
+	BLOB_MAX_ATTEMPTS = 3
+
+	// Fetch the blobs of the records of objects with blob fields
+	CONFIG_KEY_BLOBS         = "surveyor.blobs.enabled"
+	CONFIG_KEY_MAX_BLOB_JOBS = "surveyor.blobs.max_jobs"
+	// Runs a blob is retried in before it's dropped, e.g. when its record was deleted
+	CONFIG_KEY_BLOB_MAX_ATTEMPTS = "surveyor.blobs.max_attempts"
+
+	// Blobs are cached beside their object's records as `<Object>.<Id>.<Field>.blob`,
+	// with the object's blob state as `<Object>.blobs`
+	BLOB_STATE_SUFFIX = "blobs"
+
+	// Blob states are saved after this many blobs complete, and whenever none are in flight
+	BLOB_CHECKPOINT_INTERVAL = 50
+)
+
+// Blob fields of the objects that have them, their records only carry the blob's URL
+var blobFields = map[string]string{
+	"Attachment":     "Body",
+	"ContentVersion": "VersionData",
+	"Document":       "Body",
+}
+
+func init() {
+	viper.SetDefault(CONFIG_KEY_BLOBS, BLOBS)
+	viper.SetDefault(CONFIG_KEY_MAX_BLOB_JOBS, MAX_BLOB_JOBS)
+	viper.SetDefault(CONFIG_KEY_BLOB_MAX_ATTEMPTS, BLOB_MAX_ATTEMPTS)
+}
+
+// blobState is the resume state of an object's blobs
+type blobState struct {
+	Object string
+	Field  string
+	// Pending are the Ids of the records with blobs left to cache, with the number of failed attempts
+	Pending map[string]int
+}
+
+type blobRequest struct {
+	object string
+	field  string
+	id     string
+}
+
+// blobKey is the cache key the record's blob is cached as
+func (br blobRequest) blobKey() string {
+	return strings.Join([]string{br.object, br.id, br.field, appcache.EXT_BLOB}, ".")
+}
+
+func blobStateKey(object string) string {
+	return object + "." + BLOB_STATE_SUFFIX
+}
+
+// blobField is the object's blob field, empty if it has none or blobs aren't fetched
+func (s *Surveyor) blobField(object string) string {
+	if !s.fetchBlobs {
+		return ""
+	}
+	return blobFields[object]
+}
+
+// blobFetcher caches the blobs of records as their records are cached, with its own worker pool.
+// Blobs that fail are left pending and retried on the next run.
+type blobFetcher struct {
+	s *Surveyor
+
+	mu       sync.Mutex
+	states   map[string]*blobState
+	unsaved  map[string]int
+	inflight int
+
+	requests chan blobRequest
+	Workers  *tunny.Pool
+}
+
+func newBlobFetcher(s *Surveyor) *blobFetcher {
+	bf := &blobFetcher{
+		s:        s,
+		states:   make(map[string]*blobState),
+		unsaved:  make(map[string]int),
+		requests: make(chan blobRequest),
+	}
+	bf.Workers = tunny.NewFunc(s.numBlobWorkers, func(i interface{}) interface{} {
+		return fetchBlob(s, i.(blobRequest))
+	})
+
+	return bf
+}
+
+// Start dispatches blob requests to the workers, resuming the blobs left pending by earlier runs
+func (bf *blobFetcher) Start() {
+	for i := 0; i < bf.s.numBlobWorkers; i++ {
+		go func() {
+			for {
+				select {
+				case br := <-bf.requests:
+					err, _ := bf.Workers.Process(br).(error)
+					bf.done(br, err)
+				case <-bf.s.done:
+					return
+				}
+			}
+		}()
+	}
+
+	for object, field := range blobFields {
+		bf.mu.Lock()
+		st := bf.state(object, field)
+		ids := make([]string, 0, len(st.Pending))
+		for id := range st.Pending {
+			ids = append(ids, id)
+		}
+		bf.mu.Unlock()
+
+		if len(ids) == 0 {
+			continue
+		}
+		zap.S().Infow("resuming pending blobs", "object", object, "blobs", len(ids))
+		bf.Queue(object, field, ids...)
+	}
+}
+
+// Queue fetches the blobs of the records, records already pending aren't fetched twice
+func (bf *blobFetcher) Queue(object string, field string, ids ...string) {
+	bf.mu.Lock()
+	st := bf.state(object, field)
+	queued := make([]blobRequest, 0, len(ids))
+	for _, id := range ids {
+		if _, ok := st.Pending[id]; !ok {
+			st.Pending[id] = 0
+		}
+		queued = append(queued, blobRequest{object: object, field: field, id: id})
+	}
+	bf.inflight += len(queued)
+	bf.save(object)
+	bf.mu.Unlock()
+
+	go func() {
+		for _, br := range queued {
+			select {
+			case bf.requests <- br:
+			case <-bf.s.done:
+				return
+			}
+		}
+	}()
+}
+
+// idle is true when no blobs are left to fetch
+func (bf *blobFetcher) idle() bool {
+	bf.mu.Lock()
+	defer bf.mu.Unlock()
+	return bf.inflight == 0
+}
+
+// state loads the object's blob state, the caller must hold the lock
+func (bf *blobFetcher) state(object string, field string) *blobState {
+	if st, ok := bf.states[object]; ok {
+		return st
+	}
+
+	st := &blobState{Object: object, Field: field}
+	if b := bf.s.cache.GetState(blobStateKey(object)); len(b) > 0 {
+		if err := json.Unmarshal(b, st); err != nil {
+			zap.S().Warnw("unable to read blob state, assuming no blobs are pending", "object", object, "error", err)
+		}
+	}
+	if st.Pending == nil {
+		st.Pending = make(map[string]int)
+	}
+	bf.states[object] = st
+
+	return st
+}
+
+func (bf *blobFetcher) done(br blobRequest, err error) {
+	bf.mu.Lock()
+	defer bf.mu.Unlock()
+
+	st := bf.state(br.object, br.field)
+	if err == nil {
+		delete(st.Pending, br.id)
+	} else {
+		st.Pending[br.id]++
+		if st.Pending[br.id] >= bf.s.blobMaxAttempts {
+			zap.S().Errorw("unable to get blob, giving up", "object", br.object, "id", br.id, "attempts", st.Pending[br.id], "error", err)
+			delete(st.Pending, br.id)
+		} else {
+			zap.S().Warnw("unable to get blob, will retry next run", "object", br.object, "id", br.id, "error", err)
+		}
+	}
+
+	bf.inflight--
+	bf.unsaved[br.object]++
+	if bf.unsaved[br.object] >= BLOB_CHECKPOINT_INTERVAL || bf.inflight == 0 {
+		bf.save(br.object)
+	}
+}
+
+// save writes the object's blob state, the caller must hold the lock
+func (bf *blobFetcher) save(object string) {
+	b, err := json.Marshal(bf.states[object])
+	if err != nil {
+		zap.S().Errorw("unable to save blob state", "object", object, "error", err)
+		return
+	}
+	bf.s.cache.SetStateWithName(blobStateKey(object), b)
+	bf.unsaved[object] = 0
+}
+
+// fetchBlob caches the record's blob beside its records, returning an error if it couldn't be
+func fetchBlob(s *Surveyor, br blobRequest) (er interface{}) {
+	defer func() {
+		if e := recover(); e != nil {
+			er = fmt.Errorf("unable to cache blob: %v", e)
+		}
+	}()
+
+	body, err := api.GetBlob(br.object, br.id, br.field, api.WithClient(s.client))
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	if err := s.cache.CacheFromReader(br.blobKey(), body); err != nil {
+		return err
+	}
+	zap.S().Debugw("blob cached", "object", br.object, "id", br.id, "key", br.blobKey())
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package surveyor
+
+import (
+	"path"
+	"strings"
+
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/salesforce/api"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/salesforce/soql"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/tools"
+	"go.uber.org/zap"
+)
+
+const (
+	// Field rules by object, e.g. `surveyor.fields.contact.exclude: ["SSN__c", "*_Secret__c"]`
+	CONFIG_KEY_FIELDS = "surveyor.fields"
+
+	// Field rules for every object, combined with the object's own rules
+	FIELD_RULES_ALL_OBJECTS = "*"
+)
+
+// FieldRules select which of an object's fields are backed up, by glob patterns matched to field names.
+// Fields matching an exclude pattern are left out, even if they match an include pattern.
+type FieldRules struct {
+	// Include only these fields, every field is included when empty
+	Include []string `mapstructure:"include"`
+	Exclude []string `mapstructure:"exclude"`
+}
+
+// Match checks if the rules select the field. Field names are case insensitive, like in SOQL.
+func (fr FieldRules) Match(field string) bool {
+	if len(fr.Include) > 0 && !matchAny(fr.Include, field) {
+		return false
+	}
+	return !matchAny(fr.Exclude, field)
+}
+
+func matchAny(patterns []string, field string) bool {
+	field = strings.ToLower(field)
+	for _, p := range patterns {
+		if ok, _ := path.Match(strings.ToLower(p), field); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// objectFieldRules are the object's rules combined with the rules for every object.
+// The object's include list replaces the one for every object, excludes from both apply.
+func (s *Surveyor) objectFieldRules(object string) FieldRules {
+	all := s.fieldRules[FIELD_RULES_ALL_OBJECTS]
+	// config keys are lower cased
+	rules, ok := s.fieldRules[strings.ToLower(object)]
+	if !ok {
+		return all
+	}
+
+	if len(rules.Include) == 0 {
+		rules.Include = all.Include
+	}
+	rules.Exclude = append(append([]string{}, all.Exclude...), rules.Exclude...)
+	return rules
+}
+
+// selectFields are the object's Bulk API queryable fields selected by its field rules.
+// The required fields are always selected if the object has them.
+func selectFields(s *Surveyor, sobject api.SObject, required ...string) []string {
+	rules := s.objectFieldRules(sobject.Name)
+
+	fields := make([]string, 0, len(sobject.Fields))
+	skipped := make([]string, 0)
+	for _, f := range soql.BulkQueryableFields(sobject) {
+		if tools.StringSliceContaines(required, f.Name) || rules.Match(f.Name) {
+			fields = append(fields, f.Name)
+		} else {
+			skipped = append(skipped, f.Name)
+		}
+	}
+
+	if len(skipped) > 0 {
+		zap.S().Debugw("fields excluded from backup", "object", sobject.Name, "fields", skipped)
+	}
+
+	return fields
+}
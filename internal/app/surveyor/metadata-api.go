@@ -0,0 +1,199 @@
+package surveyor
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/client"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/salesforce/mdapi"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/tools"
+	"go.uber.org/zap"
+)
+
+const (
+	METADATA_API         = true
+	METADATA_API_POLL    = "10s"
+	METADATA_API_TIMEOUT = "30m"
+	// Components are retrieved as one or more files, e.g. with a `-meta.xml`, so retrieves stay well under the file limit
+	METADATA_API_RETRIEVE_SIZE = 5000
+
+	// Retrieve the org's configuration through the Metadata API
+	CONFIG_KEY_METADATA_API = "surveyor.metadata_api.enabled"
+	// Metadata types to retrieve, every component of each type is listed and retrieved
+	CONFIG_KEY_METADATA_API_TYPES   = "surveyor.metadata_api.types"
+	CONFIG_KEY_METADATA_API_POLL    = "surveyor.metadata_api.poll_interval"
+	CONFIG_KEY_METADATA_API_TIMEOUT = "surveyor.metadata_api.timeout"
+	// Components retrieved at once, orgs with more are retrieved in several packages. At most 10,000
+	CONFIG_KEY_METADATA_API_RETRIEVE_SIZE = "surveyor.metadata_api.retrieve_size"
+
+	// Retrieved components are cached unzipped under this dir, e.g. `metadata-api/objects/Account.object`
+	METADATA_API_DIR = "metadata-api"
+)
+
+var defaultMetadataTypes = []string{
+	"CustomObject",
+	"CustomField",
+	"ValidationRule",
+	"Flow",
+	"Profile",
+	"PermissionSet",
+}
+
+func init() {
+	viper.SetDefault(CONFIG_KEY_METADATA_API, METADATA_API)
+	viper.SetDefault(CONFIG_KEY_METADATA_API_TYPES, defaultMetadataTypes)
+	viper.SetDefault(CONFIG_KEY_METADATA_API_POLL, METADATA_API_POLL)
+	viper.SetDefault(CONFIG_KEY_METADATA_API_TIMEOUT, METADATA_API_TIMEOUT)
+	viper.SetDefault(CONFIG_KEY_METADATA_API_RETRIEVE_SIZE, METADATA_API_RETRIEVE_SIZE)
+}
+
+// RetrieveOrgMetadata lists the components of the configured metadata types, retrieves them with package.xml manifests
+// generated from the list, and caches them unzipped under `metadata-api/` for the Cistern.
+// Retrieves are limited to 10,000 files, so the components are split into packages of `retrieve_size` components,
+// and a package.xml of every component is cached instead of each retrieve's.
+func RetrieveOrgMetadata(s *Surveyor) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("%v", e)
+		}
+		if err != nil {
+			zap.S().Errorw("unable to retrieve org metadata", "error", err)
+		}
+	}()
+
+	sc, ok := s.client.(client.SessionClient)
+	if !ok {
+		return mdapi.ErrNoSession
+	}
+	options := []mdapi.MDAPIOption{mdapi.WithClient(sc)}
+
+	types := viper.GetStringSlice(CONFIG_KEY_METADATA_API_TYPES)
+	queries := make([]mdapi.ListMetadataQuery, 0, len(types))
+	for _, t := range types {
+		queries = append(queries, mdapi.ListMetadataQuery{Type: t})
+	}
+
+	zap.S().Infow("listing org metadata", "types", types)
+	components, err := mdapi.ListMetadata(queries, options...)
+	if err != nil {
+		return err
+	}
+	if len(components) == 0 {
+		zap.S().Warnw("no org metadata found to retrieve", "types", types)
+		return nil
+	}
+
+	pkgs := mdapi.NewPackages(mdapi.Version(sc), components, viper.GetInt(CONFIG_KEY_METADATA_API_RETRIEVE_SIZE))
+	for i, pkg := range pkgs {
+		if err := retrievePackage(s, pkg, i+1, len(pkgs), options...); err != nil {
+			return err
+		}
+	}
+
+	return cachePackage(s, mdapi.NewPackage(mdapi.Version(sc), components))
+}
+
+// retrievePackage retrieves the package's components, waiting for the retrieve to finish, and caches them
+func retrievePackage(s *Surveyor, pkg *mdapi.Package, n int, total int, options ...mdapi.MDAPIOption) error {
+	retrieve, err := mdapi.Retrieve(pkg, options...)
+	if err != nil {
+		return err
+	}
+	zap.S().Infow("org metadata retrieve started", "id", retrieve.ID, "components", pkg.Size(), "package", n, "packages", total)
+
+	result, err := pollRetrieve(retrieve.ID, options...)
+	if err != nil {
+		return err
+	}
+	for _, m := range result.Messages {
+		zap.S().Warnw("org metadata retrieve problem", "file", m.FileName, "problem", m.Problem)
+	}
+
+	return cacheRetrieved(s, result)
+}
+
+// cachePackage caches the package.xml of every component retrieved
+func cachePackage(s *Surveyor, pkg *mdapi.Package) error {
+	data, err := xml.MarshalIndent(pkg, "", "    ")
+	if err != nil {
+		return err
+	}
+	data = append([]byte(xml.Header), data...)
+
+	return s.cache.CacheFromReader(path.Join(METADATA_API_DIR, mdapi.PACKAGE_FILE), bytes.NewReader(data))
+}
+
+// pollRetrieve checks the retrieve's status until it's done or the timeout passes
+func pollRetrieve(id string, options ...mdapi.MDAPIOption) (*mdapi.RetrieveResult, error) {
+	interval, err := tools.ParseDuration(viper.GetString(CONFIG_KEY_METADATA_API_POLL))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse `%s`: %w", CONFIG_KEY_METADATA_API_POLL, err)
+	}
+	timeout, err := tools.ParseDuration(viper.GetString(CONFIG_KEY_METADATA_API_TIMEOUT))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse `%s`: %w", CONFIG_KEY_METADATA_API_TIMEOUT, err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		result, err := mdapi.CheckRetrieveStatus(id, options...)
+		if err != nil {
+			return nil, err
+		}
+		if result.Done {
+			return result, result.Err()
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("metadata retrieve %s not done after %s, last status: %s", id, timeout, result.Status)
+		}
+
+		zap.S().Debugw("waiting on org metadata retrieve", "id", id, "status", result.Status)
+		time.Sleep(interval)
+	}
+}
+
+// cacheRetrieved unzips the retrieved components into the cache, the retrieve's package.xml is left for cachePackage
+func cacheRetrieved(s *Surveyor, result *mdapi.RetrieveResult) error {
+	zr, err := result.Zip()
+	if err != nil {
+		return err
+	}
+
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+
+		name := path.Clean(strings.TrimPrefix(f.Name, "/"))
+		if name == ".." || strings.HasPrefix(name, "../") {
+			zap.S().Warnw("skipping retrieved file outside of the package", "file", f.Name)
+			continue
+		}
+		if name == mdapi.PACKAGE_FILE {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+
+		if err := s.cache.CacheFromReader(path.Join(METADATA_API_DIR, name), bytes.NewReader(data)); err != nil {
+			return err
+		}
+	}
+	zap.S().Infow("org metadata cached", "id", result.ID, "files", len(zr.File))
+
+	return nil
+}
@@ -4,16 +4,22 @@ import (
 	"bytes"
 	"encoding/json"
 	"path/filepath"
-	"time"
 
 	"github.com/Jeffail/tunny"
 	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/logger"
 	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/salesforce/api"
-	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/salesforce/soql"
 	"go.uber.org/zap"
 )
 
 
+// newMetadataWorkers creates the pool recording each object's metadata and requesting its records
+func newMetadataWorkers(s *Surveyor) *tunny.Pool {
+	return tunny.NewFunc(s.numMetadataWorkers, func(i interface{}) interface{} {
+		req := i.(RecordMetadataRequest)
+		RecordMetadata(req)
+		return nil
+	})
+}
 
 func DiscoverMetadata(s *Surveyor) error {
 	zap.S().Info("Getting basic object metadata")
@@ -22,22 +28,27 @@ func DiscoverMetadata(s *Surveyor) error {
 		return err
 	}
 
-	stop := make(chan struct{})
-
-	s.MetadataWorkers = tunny.NewFunc(s.numMetadataWorkers, func(i interface{}) interface{} {
-		req := i.(RecordMetadataRequest)
-		RecordMetadata(req)
-		return nil
-	})
+	policy := s.ObjectPolicy
+	if policy == nil {
+		policy, err = NewObjectPolicy()
+		if err != nil {
+			return err
+		}
+	}
+	sobjects := policy.Select(basicData.SObjects)
+	zap.S().Infow("objects selected for backup", "selected", len(sobjects), "found", len(basicData.SObjects), "objects", objectNames(sobjects))
 
-	// TODO debug to clean up
-	go func() {
-		<-time.After(5 * time.Second)
-		stop <-struct{}{}
-	}()
-	zap.S().Infof("%d objects found", len(basicData.SObjects))
 	zap.S().Info("Getting detailed metadata for each object")
-	for _, sobj := range basicData.SObjects {
+	described := make([]api.SObject, 0, len(sobjects))
+	for _, sobj := range sobjects {
+		// the session is ending, a partial discovery isn't reported as drift
+		select {
+		case <-s.done:
+			zap.S().Warnw("metadata discovery stopped", "described", len(described), "selected", len(sobjects))
+			return nil
+		default:
+		}
+
 		zap.S().Debugf("Getting full metadata for %s", sobj.Name)
 		sobject, err := api.Describe(sobj.Name, api.WithClient(s.client))
 		if err != nil {
@@ -45,22 +56,18 @@ func DiscoverMetadata(s *Surveyor) error {
 			continue
 		}
 
+		described = append(described, sobject)
+
 		zap.S().Infof("Recording metadata for %s", sobject.Name)
 		request := RecordMetadataRequest{
 			sobject: sobject,
 			s: s,
 		}
 		s.MetadataWorkers.Process(request)
-
-		// TODO debug to clean up
-		select {
-		case <-stop:
-			s.MetadataWorkers.Close()
-			return nil
-		default:
-		}
 	}
 
+	reportSchemaDrift(s, sobjects, described)
+
 	return nil
 }
 
@@ -80,13 +87,12 @@ func RecordMetadata(rmr RecordMetadataRequest) error {
 	data, err := json.Marshal(rmr.sobject)
 	logger.PanicCheck(err)
 
-	err = rmr.s.cache.MakeCacheAll(path, bytes.NewReader(data))
+	err = rmr.s.cache.CacheFromReader(path, bytes.NewReader(data))
 	logger.PanicCheck(err)
 
-	// Only request records for queryable sobjects
+	// Only request records for queryable sobjects, the policy only selects queryable objects by their global describe
 	if rmr.sobject.Queryable {
-		query := soql.SelectFrom(rmr.sobject, soql.WhereLastModifiedAfter(rmr.s.lastModified))
-		rmr.s.recordsRequest <-query
+		requestObjectRecords(rmr.s, rmr.sobject)
 	}
 
 	return nil
@@ -0,0 +1,152 @@
+package surveyor
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/viper"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/salesforce/api"
+)
+
+const (
+	// Object selection policy, see ObjectPolicy
+	CONFIG_KEY_OBJECTS                  = "surveyor.objects"
+	CONFIG_KEY_OBJECTS_EXCLUDE_PATTERNS = "surveyor.objects.exclude_patterns"
+)
+
+// Objects the Bulk API mostly rejects, or that only mirror other objects' data
+var defaultExcludePatterns = []string{
+	"ChangeEvent$",
+	"Share$",
+	"History$",
+	"Feed$",
+	"__e$",
+}
+
+func init() {
+	viper.SetDefault(CONFIG_KEY_OBJECTS_EXCLUDE_PATTERNS, defaultExcludePatterns)
+}
+
+// ObjectPolicy selects which queryable objects are backed up.
+// Excluded objects are never selected. Objects named in Include always are, other objects must match
+// an include pattern, when there are any, and every flag predicate that's set.
+// Object names are case insensitive, patterns are regular expressions.
+type ObjectPolicy struct {
+	Include         []string `mapstructure:"include"`
+	Exclude         []string `mapstructure:"exclude"`
+	IncludePatterns []string `mapstructure:"include_patterns"`
+	ExcludePatterns []string `mapstructure:"exclude_patterns"`
+
+	// Flag predicates, unset flags match any object
+	Custom        *bool `mapstructure:"custom"`
+	Replicateable *bool `mapstructure:"replicateable"`
+	Retrieveable  *bool `mapstructure:"retrieveable"`
+
+	includePatterns []*regexp.Regexp
+	excludePatterns []*regexp.Regexp
+}
+
+// NewObjectPolicy reads the object selection policy from config
+func NewObjectPolicy() (*ObjectPolicy, error) {
+	op := &ObjectPolicy{}
+	err := viper.UnmarshalKey(CONFIG_KEY_OBJECTS, op)
+	if err != nil {
+		return nil, err
+	}
+
+	return op, op.Compile()
+}
+
+// Compile checks the policy's patterns, policies without exclude patterns get those of `surveyor.objects`
+func (op *ObjectPolicy) Compile() error {
+	// a configured policy hides the default of its nested key from UnmarshalKey
+	if op.ExcludePatterns == nil {
+		op.ExcludePatterns = viper.GetStringSlice(CONFIG_KEY_OBJECTS_EXCLUDE_PATTERNS)
+	}
+
+	var err error
+	op.includePatterns, err = compilePatterns(op.IncludePatterns)
+	if err != nil {
+		return err
+	}
+	op.excludePatterns, err = compilePatterns(op.ExcludePatterns)
+	return err
+}
+
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid object pattern `%s`: %w", p, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// Match checks if the policy selects the object
+func (op *ObjectPolicy) Match(sobj api.SObject) bool {
+	if !sobj.Queryable {
+		return false
+	}
+	if containsName(op.Exclude, sobj.Name) || matchPatterns(op.excludePatterns, sobj.Name) {
+		return false
+	}
+	if containsName(op.Include, sobj.Name) {
+		return true
+	}
+	if len(op.Include) > 0 && len(op.includePatterns) == 0 {
+		return false
+	}
+	if len(op.includePatterns) > 0 && !matchPatterns(op.includePatterns, sobj.Name) {
+		return false
+	}
+
+	return matchFlag(op.Custom, sobj.Custom) &&
+		matchFlag(op.Replicateable, sobj.Replicateable) &&
+		matchFlag(op.Retrieveable, sobj.Retrieveable)
+}
+
+// Select returns the objects the policy selects, in order
+func (op *ObjectPolicy) Select(sobjects []api.SObject) []api.SObject {
+	selected := make([]api.SObject, 0, len(sobjects))
+	for _, sobj := range sobjects {
+		if op.Match(sobj) {
+			selected = append(selected, sobj)
+		}
+	}
+	return selected
+}
+
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchPatterns(patterns []*regexp.Regexp, name string) bool {
+	for _, re := range patterns {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchFlag(want *bool, flag bool) bool {
+	return want == nil || *want == flag
+}
+
+// objectNames are the names of the objects, for logging
+func objectNames(sobjects []api.SObject) []string {
+	names := make([]string, 0, len(sobjects))
+	for _, sobj := range sobjects {
+		names = append(names, sobj.Name)
+	}
+	return names
+}
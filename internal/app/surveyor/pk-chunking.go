@@ -0,0 +1,190 @@
+package surveyor
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/salesforce"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/salesforce/api"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/salesforce/soql"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/tools"
+	"go.uber.org/zap"
+)
+
+const (
+	PK_CHUNK_SIZE        = 250000
+	PK_CHUNK_MIN_RECORDS = 1000000
+	PK_CHUNK_MAX_CHUNKS  = 1000
+
+	// Records per chunk, chunking is disabled when 0
+	CONFIG_KEY_PK_CHUNK_SIZE = "surveyor.pk_chunking.chunk_size"
+	// Objects with at least this many records are chunked, only the listed objects are when 0
+	CONFIG_KEY_PK_CHUNK_MIN_RECORDS = "surveyor.pk_chunking.min_records"
+	// The last chunk is left open ended, instead of exceeding this
+	CONFIG_KEY_PK_CHUNK_MAX_CHUNKS = "surveyor.pk_chunking.max_chunks"
+	// Objects always chunked, regardless of their number of records
+	CONFIG_KEY_PK_CHUNK_OBJECTS = "surveyor.pk_chunking.objects"
+
+	// Records states of an object's chunks are cached under `<Object>/chunks/<chunk>`
+	PK_CHUNK_DIR = "chunks"
+
+	// Length of a case-sensitive Salesforce Id, without the checksum suffix
+	ID_LENGTH = 15
+)
+
+func init() {
+	viper.SetDefault(CONFIG_KEY_PK_CHUNK_SIZE, PK_CHUNK_SIZE)
+	viper.SetDefault(CONFIG_KEY_PK_CHUNK_MIN_RECORDS, PK_CHUNK_MIN_RECORDS)
+	viper.SetDefault(CONFIG_KEY_PK_CHUNK_MAX_CHUNKS, PK_CHUNK_MAX_CHUNKS)
+}
+
+// idRange is a chunk of an object's records by Id, from Start up to but not including End.
+// An empty End leaves the range open.
+type idRange struct {
+	Start string
+	End   string
+}
+
+// requestObjectRecords requests the object's records changed since its watermark, split into a Query Job per Id range if the object is large.
+// Chunks are cached under the object like any other records, as `<Object>.<chunk>-<page>.csv`.
+func requestObjectRecords(s *Surveyor, sobject api.SObject) {
+	field, options := recordsQueryOptions(s, sobject)
+	requestTombstones(s, sobject, field)
+
+	ranges := pkChunkRanges(s, sobject)
+	if len(ranges) == 0 {
+		s.requestRecords(RecordsState{
+			ID:             sobject.Name,
+			WatermarkField: field,
+			Query:          soql.SelectFrom(sobject, options...),
+		})
+		return
+	}
+
+	zap.S().Infow("requesting records in PK chunks", "object", sobject.Name, "chunks", len(ranges))
+	for i, r := range ranges {
+		chunk := strconv.Itoa(i)
+		chunkOptions := append(append([]soql.SoqlOption{}, options...), soql.WhereIdRange(r.Start, r.End))
+		s.requestRecords(RecordsState{
+			ID:             sobject.Name,
+			Chunk:          chunk,
+			CachePath:      pkChunkPath(sobject.Name, chunk),
+			WatermarkField: field,
+			Query:          soql.SelectFrom(sobject, chunkOptions...),
+		})
+	}
+}
+
+func pkChunkPath(object string, chunk string) string {
+	return path.Join(object, PK_CHUNK_DIR, chunk)
+}
+
+// shouldPKChunk checks if the object is listed to be chunked, or has enough records to be
+func shouldPKChunk(s *Surveyor, sobject api.SObject) bool {
+	if s.pkChunkSize == 0 {
+		return false
+	}
+	if tools.StringSliceContaines(s.pkChunkObjects, sobject.Name) {
+		return true
+	}
+	if s.pkChunkMinRecords <= 0 {
+		return false
+	}
+
+	counts, err := api.RecordCount([]string{sobject.Name}, api.WithClient(s.client))
+	if err != nil {
+		zap.S().Warnw("unable to count records, not chunking", "object", sobject.Name, "error", err)
+		return false
+	}
+
+	return counts.Count(sobject.Name) >= s.pkChunkMinRecords
+}
+
+// pkChunkRanges splits the object's Ids into ranges of the chunk size, nil if the object shouldn't be chunked.
+// Ranges start at the first Id, or the object's key prefix if it can't be probed, and end at the last Id.
+func pkChunkRanges(s *Surveyor, sobject api.SObject) []idRange {
+	if !shouldPKChunk(s, sobject) {
+		return nil
+	}
+
+	last, err := probeID(s, sobject.Name, true)
+	if err != nil || last == "" {
+		zap.S().Warnw("unable to find last Id, not chunking", "object", sobject.Name, "error", err)
+		return nil
+	}
+
+	first, err := probeID(s, sobject.Name, false)
+	if err != nil || first == "" {
+		first = keyPrefixStart(sobject.Keyprefix, last)
+		zap.S().Warnw("unable to find first Id, chunking from the key prefix", "object", sobject.Name, "start", first, "error", err)
+	}
+
+	ranges, err := idRanges(first, last, s.pkChunkSize, s.pkChunkMaxChunks)
+	if err != nil {
+		zap.S().Warnw("unable to compute PK chunk ranges, not chunking", "object", sobject.Name, "error", err)
+		return nil
+	}
+
+	return ranges
+}
+
+// probeID queries for the first Id of the object, or the last if desc
+func probeID(s *Surveyor, object string, desc bool) (string, error) {
+	probe := soql.Query{
+		Fields:  []string{api.ID_FIELD},
+		From:    object,
+		OrderBy: []soql.Order{{Field: api.ID_FIELD, Desc: desc}},
+		Limit:   1,
+	}
+
+	results, err := api.Query(probe.String(), api.WithClient(s.client))
+	if err != nil {
+		return "", err
+	}
+	if len(results.Records) == 0 {
+		return "", nil
+	}
+
+	id, _ := results.Records[0][api.ID_FIELD].(string)
+	return id, nil
+}
+
+// keyPrefixStart is the first possible Id of the object, on the same pod as the Id
+func keyPrefixStart(keyPrefix string, id string) string {
+	if len(keyPrefix) != 3 || len(id) < ID_LENGTH {
+		return ""
+	}
+	// Ids are the key prefix, a 2 character pod identifier, a reserved character, then a base62 counter
+	return keyPrefix + id[3:5] + strings.Repeat("0", ID_LENGTH-5)
+}
+
+// idRanges splits first to last into ranges of size Ids, leaving the last range open ended
+func idRanges(first string, last string, size uint64, maxChunks int) ([]idRange, error) {
+	if len(first) < ID_LENGTH || len(last) < ID_LENGTH {
+		return nil, fmt.Errorf("invalid Id range: %s to %s", first, last)
+	}
+
+	ranges := make([]idRange, 0)
+	start := first
+	for maxChunks <= 0 || len(ranges) < maxChunks-1 {
+		_, end, err := salesforce.PKChunkRange(start, size)
+		if err != nil && len(ranges) == 0 {
+			return nil, err
+		}
+		// the counter can't go any higher
+		if err != nil {
+			break
+		}
+		// base62 digits sort the same as their characters, so Ids on the same pod compare as strings
+		if end[:ID_LENGTH] > last[:ID_LENGTH] {
+			break
+		}
+		ranges = append(ranges, idRange{start, end})
+		start = end
+	}
+
+	return append(ranges, idRange{Start: start}), nil
+}
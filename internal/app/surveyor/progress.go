@@ -0,0 +1,96 @@
+package surveyor
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// progress tracks the work the Surveyor has left this run: tasks still discovering or handing off records requests,
+// and the Query Jobs created that haven't been fetched yet
+type progress struct {
+	mu    sync.Mutex
+	tasks int
+	jobs  map[string]bool
+}
+
+func (p *progress) begin() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tasks++
+}
+
+func (p *progress) end() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tasks--
+}
+
+func (p *progress) addJob(id string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.jobs == nil {
+		p.jobs = make(map[string]bool)
+	}
+	p.jobs[id] = true
+}
+
+func (p *progress) doneJob(id string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.jobs, id)
+}
+
+func (p *progress) waiting(id string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.jobs[id]
+}
+
+func (p *progress) idle() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.tasks == 0 && len(p.jobs) == 0
+}
+
+// requestRecords hands the records request to the Surveyor, it's counted as work left until it's been made
+func (s *Surveyor) requestRecords(rs RecordsState) {
+	s.progress.begin()
+	select {
+	case s.recordsRequest <- rs:
+	case <-s.done:
+		s.progress.end()
+	}
+}
+
+// fetch hands the Query Job's results to the Surveyor to cache, it's counted as work left until they're cached
+func (s *Surveyor) fetch(rs RecordsState) {
+	s.progress.begin()
+	select {
+	case s.fetchRecords <- rs:
+	case <-s.done:
+		s.progress.end()
+	}
+}
+
+// Finished is closed once the Surveyor has cached everything it found to back up this run
+func (s *Surveyor) Finished() <-chan struct{} {
+	return s.finished
+}
+
+// watchFinished closes finished once discovery is done, every Query Job created has been fetched and no blobs are left
+func (s *Surveyor) watchFinished(interval time.Duration) {
+	for {
+		select {
+		case <-time.After(interval):
+		case <-s.done:
+			return
+		}
+		if s.progress.idle() && s.blobs.idle() {
+			zap.S().Info("Surveyor finished")
+			close(s.finished)
+			return
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package surveyor
+
+import (
+	"sync"
+	"time"
+
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/cache"
+)
+
+// recordsCheckpoint tracks pages of results cached out of order, saving the records state
+// only as far as every page before it has been cached. Resuming from the state refetches
+// any pages after the checkpoint, which are cached under the same names.
+type recordsCheckpoint struct {
+	mu    sync.Mutex
+	cache cache.Cache
+	state RecordsState
+	err   error
+
+	// pages started after the checkpoint, in order, with the locator of the page after each
+	pages []checkpointPage
+}
+
+type checkpointPage struct {
+	nextLocator string
+	done        bool
+	watermark   time.Time
+}
+
+func newRecordsCheckpoint(c cache.Cache, rs RecordsState) *recordsCheckpoint {
+	return &recordsCheckpoint{
+		cache: c,
+		state: rs,
+	}
+}
+
+// add starts the next page, returning its page number
+func (rc *recordsCheckpoint) add(nextLocator string) int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	rc.pages = append(rc.pages, checkpointPage{nextLocator: nextLocator})
+	return rc.state.Page + len(rc.pages) - 1
+}
+
+// done marks the page as cached with the latest watermark of its records,
+// moving the checkpoint past any pages now cached in order
+func (rc *recordsCheckpoint) done(page int, watermark time.Time) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	rc.pages[page-rc.state.Page].done = true
+	rc.pages[page-rc.state.Page].watermark = watermark
+
+	moved := false
+	for len(rc.pages) > 0 && rc.pages[0].done {
+		if rc.pages[0].watermark.After(rc.state.Watermark) {
+			rc.state.Watermark = rc.pages[0].watermark
+		}
+		rc.state.NextLocator = rc.pages[0].nextLocator
+		rc.state.Page++
+		rc.pages = rc.pages[1:]
+		moved = true
+	}
+
+	if moved {
+		setRecordState(rc.cache, rc.state)
+	}
+}
+
+// fail records the first error, no more pages should be started after
+func (rc *recordsCheckpoint) fail(err error) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if rc.err == nil {
+		rc.err = err
+	}
+}
+
+func (rc *recordsCheckpoint) Err() error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.err
+}
+
+// State is the records state as of the checkpoint
+func (rc *recordsCheckpoint) State() RecordsState {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.state
+}
@@ -1,14 +1,21 @@
 package surveyor
 
 import (
+	"encoding/csv"
 	"encoding/json"
+	"fmt"
+	"io"
 	"sort"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/Jeffail/tunny"
 	"github.com/spf13/viper"
-	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/app/cache"
+	appcache "gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/app/cache"
 	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/logger"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/cache"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/salesforce"
 	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/salesforce/api"
 	"go.uber.org/zap"
 )
@@ -25,25 +32,50 @@ type RecordsState struct {
 	RequestID   string
 	Done        bool
 	NextLocator string
+	// Page is the number of result pages already cached
+	Page        int
+	// Chunk is the PK chunk of the object's records the request is for, empty if it isn't chunked
+	Chunk       string
+	// Deleted requests are queryAll jobs for the tombstones of deleted records
+	Deleted     bool
+	// WatermarkField is the datetime field the records are watermarked by, empty if they aren't
+	WatermarkField string
+	// Watermark is the latest WatermarkField value of the records cached so far
+	Watermark      time.Time
 	CachePath   string
 	Query       string
 }
 
+// pageName is the name a page of the request's results is cached as, unique across the object's chunks
+func (rs RecordsState) pageName() string {
+	name := strconv.Itoa(rs.Page)
+	if rs.Chunk != "" {
+		name = rs.Chunk + "-" + name
+	}
+	if rs.Deleted {
+		name += "." + TOMBSTONE_SUFFIX
+	}
+	return name
+}
+
 type cacheRecords struct {
 	RecState RecordsState
-	Data     []byte
-	Cache    *cache.Cache
+	Body     io.Reader
+	Cache    cache.Cache
 }
 
-func DiscoverRecords(s *Surveyor) error {
-	zap.S().Info("Searching for records")
-
-	s.Workers = tunny.New(s.numWorkers, func() tunny.Worker {
+// newRecordsWorkers creates the pool caching pages of records
+func newRecordsWorkers(s *Surveyor) *tunny.Pool {
+	return tunny.New(s.numWorkers, func() tunny.Worker {
 		return &recordsWorker{
 			s:             s,
 			interruptChan: make(chan struct{}),
 		}
 	})
+}
+
+func DiscoverRecords(s *Surveyor) error {
+	zap.S().Info("Searching for records")
 
 	queueIncompleteRecordsRequests(s)
 	watchRecordsRequests(s)
@@ -51,7 +83,7 @@ func DiscoverRecords(s *Surveyor) error {
 	return nil
 }
 
-func RequestRecords(s *Surveyor, query string) (success bool) {
+func RequestRecords(s *Surveyor, rs RecordsState) (success bool) {
 	defer func ()  {
 		if e := recover(); e != nil {
 			zap.S().Errorw("unable to complete records request", "error", e)
@@ -62,85 +94,241 @@ func RequestRecords(s *Surveyor, query string) (success bool) {
 
 	if numRecordsRequests >= s.maxDailyRecordsRequests {
 		zap.S().Warnf("max number of daily records requests reached: %d requests", s.maxDailyRecordsRequests)
-		setRecordState(s.cache, RecordsState{Query: query})
-		zap.S().Debugw("max dailt records requests made, caching query", "query", query)
+		setRecordState(s.cache, rs)
+		zap.S().Debugw("max dailt records requests made, caching query", "query", rs.Query)
 		return false
 	}
 	// Create Query Job
-	job, err := api.CreateQueryJob(query, api.WithClient(s.client))
+	options := []api.APIOption{api.WithClient(s.client)}
+	if rs.Deleted {
+		options = append(options, api.WithQueryType(api.QUERY_ALL))
+	}
+	job, err := api.CreateQueryJob(rs.Query, options...)
 	if err != nil {
-		zap.S().Errorw("error creating BulkV2 Query Job with query", "query", query, "error", err)
+		zap.S().Errorw("error creating BulkV2 Query Job with query", "query", rs.Query, "error", err)
 		return false
 	}
-	zap.S().Infow("Query Job Created", "job", job.ID, "create_date", job.CreatedDate, "created_by_id", job.CreatedById)
+	zap.S().Infow("Query Job Created", "job", job.ID, "create_date", job.CreatedDate, "created_by_id", job.CreatedById, "chunk", rs.Chunk)
 
-	rs := RecordsState{
-		ID:        job.Object,
-		RequestID: job.ID,
-		CachePath: job.Object,
+	if rs.ID == "" {
+		rs.ID = job.Object
 	}
+	rs.RequestID = job.ID
 	
 	setRecordState(s.cache, rs)
+	s.progress.addJob(job.ID)
 	return true
 }
 
+// FetchRecords caches the pages of a Query Job's results, up to one page per records worker at a time.
+// Each response's locator is known before its body is read, so the next page is requested while earlier ones are still being cached.
+// The records state only checkpoints past pages once they, and every page before them, are cached.
 func FetchRecords(s *Surveyor, recState RecordsState) {
-	done := make(chan struct{})
-	defer close(done)
+	// an empty cache path would clean up the whole cache
+	if recState.CachePath == "" {
+		recState.CachePath = recState.ID
+	}
+	cp := newRecordsCheckpoint(s.cache, recState)
+	// failed fetches resume next run, either way the job's done for this one
+	defer s.progress.doneJob(recState.RequestID)
 
-	// index of the Id column in the CSV
+	numWorkers := s.numWorkers
+	if numWorkers < 1 {
+		numWorkers = 1
+	}
+	sem := make(chan struct{}, numWorkers)
+	var wg sync.WaitGroup
 
+	locator := recState.NextLocator
+	gone := false
 	for {
-		resp, err := api.GetQueryJobResults(recState.RequestID, api.WithClient(s.client))
-		logger.PanicCheck(err)
+		sem <- struct{}{}
+		if cp.Err() != nil {
+			<-sem
+			break
+		}
+
+		options := []api.APIOption{api.WithClient(s.client)}
+		if locator != "" && locator != "null" {
+			options = append(options, api.Locator(locator))
+		}
+		if s.maxRecords > 0 {
+			options = append(options, api.MaxRecords(s.maxRecords))
+		}
+
+		resp, err := api.StreamQueryJobResults(recState.RequestID, options...)
+		if err != nil {
+			<-sem
+			cp.fail(err)
+			gone = salesforce.IsNotFound(err)
+			break
+		}
 		zap.S().Debugw("records chunk recieved", "jobID", resp.JobID, "numRecords", resp.NumberOfRecords, "nextLocator", resp.NextLocator)
 
 		if resp.NumberOfRecords == 0 {
-			zap.S().Warnw("no results found for Query Job", "job", resp)
-			CleanupRecords(s, recState)
+			resp.Body.Close()
+			<-sem
+			zap.S().Warnw("no results found for Query Job", "job", resp.JobID)
 			break
 		}
-		// process records chunk
-		cr := cacheRecords{
-			RecState: recState,
-			Data:     resp.Data,
-			Cache:    s.cache,
-		}
-		s.Workers.Process(cr)
 
-		// update records stat
-		recState.NextLocator = resp.NextLocator
-		setRecordState(s.cache, recState)
+		// process records chunk, the body is cached as it's read
+		page := cp.add(resp.NextLocator)
+		wg.Add(1)
+		go func(resp *api.QueryJobResultsStream, page int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			defer resp.Body.Close()
+
+			rs := recState
+			rs.Page = page
+			cr := cacheRecords{
+				RecState: rs,
+				Body:     resp.Body,
+				Cache:    s.cache,
+			}
+			switch r := s.Workers.Process(cr).(type) {
+			case error:
+				cp.fail(r)
+			case recordsPage:
+				cp.done(page, r.Watermark)
+				if len(r.IDs) > 0 {
+					s.blobs.Queue(recState.ID, s.blobField(recState.ID), r.IDs...)
+				}
+			default:
+				cp.done(page, time.Time{})
+			}
+		}(resp, page)
 
-		// Salesforce sends a string of "null", instead of a null value....
-		if resp.NextLocator == "" || resp.NextLocator == "null" {
-			CleanupRecords(s, recState)
+		if resp.Done() {
 			break
 		}
+		locator = resp.NextLocator
 	}
+	wg.Wait()
+
+	if gone {
+		zap.S().Warnw("Query Job no longer exists, requesting its records again", "job_id", recState.RequestID, "object", recState.ID, "chunk", recState.Chunk)
+		rs := restartRecordsRequest(s.cache, cp.State())
+		// the request is made by the Surveyor's loop, which is running this fetch
+		s.progress.begin()
+		go func() {
+			defer s.progress.end()
+			s.requestRecords(rs)
+		}()
+		return
+	}
+	if err := cp.Err(); err != nil {
+		zap.S().Errorw("unable to get records, will resume from the last checkpoint", "job_id", recState.RequestID, "object", recState.ID, "error", err)
+		return
+	}
+
+	CleanupRecords(s, cp.State())
+	s.captureWatermark(cp.State())
 	zap.S().Infow("done getting records", "job_id", recState.RequestID, "object", recState.ID)
 }
 
+// CleanupRecords deletes the Query Job and its records state once its records are cached.
+// Only the state is deleted, everything else under the cache path is left for the Cistern to back up.
 func CleanupRecords(s *Surveyor, rs RecordsState) {
-	if !s.cache.Exists(rs.CachePath) {
-		zap.S().Warnw("no records cache to clean, moving on", "recordsState", rs)
+	statePath := cache.StatePath(rs.CachePath)
+	if !s.cache.Exists(statePath) {
+		zap.S().Warnw("no records state to clean, moving on", "recordsState", rs)
 		return
+	}
+
+	err := api.DeleteQueryJob(rs.RequestID, api.WithClient(s.client))
+	if err != nil {
+		zap.S().Errorw("unable to delete Query Job with request id", "recordsState", rs)
 	} else {
-		err := api.DeleteQueryJob(rs.RequestID, api.WithClient(s.client))
-		if err != nil {
-			zap.S().Errorw("unable to delete Query Job with request id", "recordsState", rs)
-		} else {
-			zap.S().Infow("Query Job deleted for records", "recordState", rs)
+		zap.S().Infow("Query Job deleted for records", "recordState", rs)
+	}
+
+	err = s.cache.Delete(statePath)
+	if err != nil {
+		zap.S().Errorw("unable to delete records state", "recordsState", rs, "error", err)
+		return
+	}
+	zap.S().Infow("records state deleted", "recodsState", rs)
+}
+
+// restartRecordsRequest drops the Query Job from the records state, so the request is made again with a new job.
+// Its pages are cached again from the first, under the same names.
+func restartRecordsRequest(c cache.Cache, rs RecordsState) RecordsState {
+	rs.RequestID = ""
+	rs.NextLocator = ""
+	rs.Page = 0
+	rs.Done = false
+	setRecordState(c, rs)
+	return rs
+}
+
+// purgeQueryJobs deletes the user's Query Jobs left by earlier runs, except those with records states to resume fetching
+func purgeQueryJobs(s *Surveyor) {
+	jobs, err := api.GetAllQueryJobs(api.WithClient(s.client), api.CreatedById(s.client.GetUser()))
+	if err != nil {
+		zap.S().Errorw("unable to list existing Query Jobs, leaving them", "error", err)
+		return
+	}
+
+	remove, err := reconcileRecordsStates(s.cache, jobs.Records)
+	if err != nil {
+		zap.S().Errorw("unable to find records states, leaving existing Query Jobs", "error", err)
+		return
+	}
+
+	removed := 0
+	for _, id := range remove {
+		if err := api.DeleteQueryJob(id, api.WithClient(s.client)); err != nil {
+			zap.S().Warnw("unable to delete existing Query Job", "job", id, "error", err)
+			continue
 		}
-		
-		err = s.cache.DeleteAll(rs.CachePath)
-		if err != nil {
-			zap.S().Errorw("unable to delete records cache", "recordsState", rs)
-			return
-		} else {
-			zap.S().Infow("records cache deleted", "recodsState", rs)
+		removed++
+	}
+	zap.S().Debugw("removed existing Query Jobs", "removed", removed, "resuming", len(jobs.Records)-len(remove))
+}
+
+// reconcileRecordsStates matches the records states to the user's existing Query Jobs, returning the jobs to delete.
+// States of jobs that are gone, failed or aborted are restarted, so they're requested again instead of never resuming,
+// which would also hold back their object's watermark if they're a chunk. Only jobs with a state to resume are kept.
+func reconcileRecordsStates(c cache.Cache, jobs []api.QueryJob) ([]string, error) {
+	statePaths, err := c.FindAll(cache.STATE_FILE)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]api.QueryJob)
+	for _, j := range jobs {
+		byID[j.ID] = j
+	}
+
+	resume := make(map[string]bool)
+	for _, p := range statePaths {
+		rs := getRecordState(c, p)
+		if rs.RequestID == "" {
+			continue
+		}
+
+		j, ok := byID[rs.RequestID]
+		switch {
+		case !ok:
+			zap.S().Warnw("Query Job of records state no longer exists, requesting its records again", "job", rs.RequestID, "object", rs.ID, "chunk", rs.Chunk)
+			restartRecordsRequest(c, rs)
+		case j.Failed() || j.Aborted():
+			zap.S().Warnw("Query Job of records state didn't complete, requesting its records again", "job", rs.RequestID, "object", rs.ID, "chunk", rs.Chunk, "state", j.State)
+			restartRecordsRequest(c, rs)
+		default:
+			resume[rs.RequestID] = true
+		}
+	}
+
+	remove := make([]string, 0)
+	for _, j := range jobs {
+		if !resume[j.ID] {
+			remove = append(remove, j.ID)
 		}
 	}
+	return remove, nil
 }
 
 func queueIncompleteRecordsRequests(s *Surveyor) {
@@ -176,16 +364,19 @@ func queueIncompleteRecordsRequests(s *Surveyor) {
 		return cacheStates[i].NextLocator > cacheStates[j].NextLocator
 	})
 
+	s.progress.begin()
 	go func() {
+		defer s.progress.end()
 		for _, state := range cacheStates {
-			if state.ID == "" && state.Query != "" {
-				s.recordsRequest <- state.Query
+			if state.RequestID == "" && state.Query != "" {
+				s.requestRecords(state)
 			} else {
-				s.fetchRecords <- state
+				s.fetch(state)
 			}
 			select {
 			case <-s.done:
 				return
+			default:
 			}
 		}
 	}()
@@ -201,10 +392,13 @@ func watchRecordsRequests(s *Surveyor) {
 
 			for _, r := range recordsRequests.Records {
 				if r.Complete() {
-					s.fetchRecords <- RecordsState{
-						ID: r.Object,
-						RequestID: r.ID,
+					s.fetch(findRecordState(s.cache, r.Object, r.ID))
+				} else if (r.Failed() || r.Aborted()) && s.progress.waiting(r.ID) {
+					zap.S().Errorw("Query Job didn't complete, its records will be requested again next run", "job", r.ID, "object", r.Object, "state", r.State)
+					if rs := findRecordState(s.cache, r.Object, r.ID); rs.Query != "" {
+						restartRecordsRequest(s.cache, rs)
 					}
+					s.progress.doneJob(r.ID)
 				}
 			}
 			select {
@@ -216,7 +410,7 @@ func watchRecordsRequests(s *Surveyor) {
 	}()
 }
 
-func getRecordState(cache *cache.Cache, path string) RecordsState {
+func getRecordState(cache cache.Cache, path string) RecordsState {
 	state := cache.GetState(path)
 
 	rs := RecordsState{}
@@ -232,7 +426,27 @@ func getRecordState(cache *cache.Cache, path string) RecordsState {
 	return rs
 }
 
-func setRecordState(cache *cache.Cache, rs RecordsState) {
+// findRecordState is the cached state of the Query Job, or a new state if the job wasn't requested by this cache
+func findRecordState(c cache.Cache, object string, requestID string) RecordsState {
+	statePaths, err := c.FindAll(cache.STATE_FILE)
+	if err != nil {
+		zap.S().Warnw("unable to find cache states, assuming none exist", "error", err)
+	}
+
+	for _, p := range statePaths {
+		rs := getRecordState(c, p)
+		if rs.RequestID == requestID {
+			return rs
+		}
+	}
+
+	return RecordsState{
+		ID:        object,
+		RequestID: requestID,
+	}
+}
+
+func setRecordState(cache cache.Cache, rs RecordsState) {
 	if rs.CachePath == "" {
 		rs.CachePath = rs.ID
 	}
@@ -251,17 +465,98 @@ type recordsWorker struct {
 	terminated    bool
 }
 
-func (rw *recordsWorker) Process(i interface{}) interface{} {
+// recordsPage is what's read from a page of records as it's cached
+type recordsPage struct {
+	// Watermark is the latest watermark field value of the records
+	Watermark time.Time
+	// IDs of the records with blobs to fetch
+	IDs []string
+}
+
+// Process caches a page of records, returning a recordsPage if its records are watermarked or have blobs,
+// or an error if they couldn't be cached
+func (rw *recordsWorker) Process(i interface{}) (er interface{}) {
 	cr := i.(cacheRecords)
 	defer func() {
 		if e := recover(); e != nil {
-			zap.S().Errorw("unabel to process CSV records batch", "csv", cr, "error", e)
+			zap.S().Errorw("unabel to process CSV records batch", "object", cr.RecState.ID, "page", cr.RecState.Page, "error", e)
+			er = fmt.Errorf("unable to cache records: %v", e)
 		}
 	}()
 
-	cr.Cache.CacheCSV(cr.RecState.ID, cr.Data)
+	page := appcache.PageName(cr.RecState.pageName())
+	idColumn := ""
+	if !cr.RecState.Deleted && rw.s.blobField(cr.RecState.ID) != "" {
+		idColumn = api.ID_FIELD
+	}
+	if cr.RecState.WatermarkField == "" && idColumn == "" {
+		err := appcache.CacheCSVFromReader(cr.Cache, cr.RecState.ID, cr.Body, page)
+		logger.PanicCheck(err)
+		return nil
+	}
 
-	return nil
+	// the watermark and Ids are read from the records as they're cached
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	scanned := make(chan recordsPage, 1)
+	go func() {
+		scanned <- scanRecordsPage(pr, cr.RecState.WatermarkField, idColumn)
+		io.Copy(io.Discard, pr)
+	}()
+
+	err := appcache.CacheCSVFromReader(cr.Cache, cr.RecState.ID, io.TeeReader(cr.Body, pw), page)
+	logger.PanicCheck(err)
+	pw.Close()
+
+	return <-scanned
+}
+
+// scanRecordsPage reads the CSV, returning the latest time in the watermark column and the values of the Id column.
+// Columns are skipped when empty, values of the watermark column that aren't times are ignored.
+func scanRecordsPage(r io.Reader, watermarkColumn string, idColumn string) recordsPage {
+	page := recordsPage{}
+
+	csvReader := csv.NewReader(r)
+	header, err := csvReader.Read()
+	if err != nil {
+		return page
+	}
+
+	wmIndex, idIndex := -1, -1
+	for i, h := range header {
+		if watermarkColumn != "" && h == watermarkColumn {
+			wmIndex = i
+		}
+		if idColumn != "" && h == idColumn {
+			idIndex = i
+		}
+	}
+	if wmIndex < 0 && idIndex < 0 {
+		return page
+	}
+
+	for {
+		row, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			zap.S().Warnw("unable to read records page", "watermark_column", watermarkColumn, "id_column", idColumn, "error", err)
+			return page
+		}
+
+		if wmIndex >= 0 {
+			t, err := time.Parse(time.RFC3339, row[wmIndex])
+			if err == nil && t.After(page.Watermark) {
+				page.Watermark = t
+			}
+		}
+		if idIndex >= 0 && row[idIndex] != "" {
+			page.IDs = append(page.IDs, row[idIndex])
+		}
+	}
+
+	return page
 }
 
 func (w *recordsWorker) BlockUntilReady() {}
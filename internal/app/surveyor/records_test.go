@@ -0,0 +1,91 @@
+package surveyor
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	appcache "gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/app/cache"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/cache"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/salesforce/api"
+)
+
+func chunkState(chunk string, requestID string) RecordsState {
+	return RecordsState{
+		ID:             "Account",
+		RequestID:      requestID,
+		NextLocator:    "MTAwMDA",
+		Page:           3,
+		Chunk:          chunk,
+		WatermarkField: "SystemModstamp",
+		CachePath:      pkChunkPath("Account", chunk),
+		Query:          "SELECT Id, SystemModstamp FROM Account WHERE Id >= '001000000000001' AND Id < '001000000100001'",
+	}
+}
+
+func TestReconcileRecordsStatesRestartsStaleChunks(t *testing.T) {
+	c := appcache.NewMemory("")
+	setRecordState(c, chunkState("gone", "750000000000001"))
+	setRecordState(c, chunkState("failed", "750000000000002"))
+	setRecordState(c, chunkState("running", "750000000000003"))
+
+	jobs := []api.QueryJob{
+		{ID: "750000000000002", Object: "Account", State: api.STATUS_FAILED},
+		{ID: "750000000000003", Object: "Account", State: api.STATUS_IN_PROGRESS},
+		// left by an earlier run without a state to resume
+		{ID: "750000000000004", Object: "Contact", State: api.STATUS_JOB_COMPLETE},
+	}
+
+	remove, err := reconcileRecordsStates(c, jobs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(remove)
+	if want := []string{"750000000000002", "750000000000004"}; !reflect.DeepEqual(remove, want) {
+		t.Errorf("removing jobs %v, want %v", remove, want)
+	}
+
+	for _, chunk := range []string{"gone", "failed"} {
+		rs := getRecordState(c, cache.StatePath(pkChunkPath("Account", chunk)))
+		want := chunkState(chunk, "")
+		want.NextLocator = ""
+		want.Page = 0
+		if !reflect.DeepEqual(rs, want) {
+			t.Errorf("stale chunk %s state is %+v, want it restarted as %+v", chunk, rs, want)
+		}
+	}
+	if rs := getRecordState(c, cache.StatePath(pkChunkPath("Account", "running"))); !reflect.DeepEqual(rs, chunkState("running", "750000000000003")) {
+		t.Errorf("running chunk state changed to %+v", rs)
+	}
+}
+
+func TestCaptureWatermarkWaitsForStaleChunks(t *testing.T) {
+	c := appcache.NewMemory("")
+	s := &Surveyor{cache: c}
+	wm := time.Date(2021, 10, 15, 20, 0, 0, 0, time.UTC)
+
+	// a chunk left by an earlier run whose job was purged
+	setRecordState(c, chunkState("gone", "750000000000001"))
+	if _, err := reconcileRecordsStates(c, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	done := chunkState("done", "750000000000002")
+	done.Watermark = wm
+	s.captureWatermark(done)
+	if got := s.Watermark("Account"); !got.IsZero() {
+		t.Fatalf("watermark moved to %v while a chunk is pending", got)
+	}
+
+	// the restarted chunk is requested, fetched and cleaned up
+	if err := c.Delete(cache.StatePath(pkChunkPath("Account", "gone"))); err != nil {
+		t.Fatal(err)
+	}
+	gone := chunkState("gone", "750000000000005")
+	gone.Watermark = wm.Add(-time.Hour)
+	s.captureWatermark(gone)
+	if got := s.Watermark("Account"); !got.Equal(wm) {
+		t.Errorf("watermark is %v, want %v once every chunk is done", got, wm)
+	}
+}
@@ -0,0 +1,103 @@
+package surveyor
+
+import (
+	"bytes"
+	"encoding/json"
+	"path"
+	"time"
+
+	"github.com/spf13/viper"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/logger"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/salesforce/api"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/salesforce/drift"
+	"go.uber.org/zap"
+)
+
+const (
+	SCHEMA_DRIFT = true
+
+	// Report schema changes since the last run
+	CONFIG_KEY_SCHEMA_DRIFT = "surveyor.schema_drift"
+
+	// Reports are cached as `schema-drift/<time>.json` and `schema-drift/<time>.md`
+	SCHEMA_DRIFT_DIR    = "schema-drift"
+	SCHEMA_DRIFT_FORMAT = "20060102T150405Z"
+
+	// The schema of the last run is kept as state, metadata.json files are removed once they're backed up
+	SCHEMA_STATE_FILE_NAME = ".schema"
+)
+
+func init() {
+	viper.SetDefault(CONFIG_KEY_SCHEMA_DRIFT, SCHEMA_DRIFT)
+}
+
+type schemaState struct {
+	Taken  time.Time
+	Schema drift.Schema
+}
+
+// reportSchemaDrift compares the schemas of the objects described this run to those of the last run,
+// caching a report of any drift. Objects selected but not described this run keep their last schema,
+// so they aren't reported as removed.
+func reportSchemaDrift(s *Surveyor, selected []api.SObject, described []api.SObject) {
+	defer func() {
+		if e := recover(); e != nil {
+			zap.S().Errorw("unable to report schema drift", "error", e)
+		}
+	}()
+
+	if !viper.GetBool(CONFIG_KEY_SCHEMA_DRIFT) {
+		return
+	}
+
+	last := schemaState{}
+	if b := s.cache.GetState(SCHEMA_STATE_FILE_NAME); len(b) > 0 {
+		if err := json.Unmarshal(b, &last); err != nil {
+			zap.S().Warnw("unable to read last schema, assuming none exists", "error", err)
+		}
+	}
+
+	current := schemaState{
+		Taken:  time.Now().UTC(),
+		Schema: make(drift.Schema, len(selected)),
+	}
+	for _, sobj := range selected {
+		if schema, ok := last.Schema[sobj.Name]; ok {
+			current.Schema[sobj.Name] = schema
+		}
+	}
+	for _, sobj := range described {
+		current.Schema[sobj.Name] = drift.NewObjectSchema(sobj)
+	}
+
+	b, err := json.Marshal(current)
+	logger.PanicCheck(err)
+	s.cache.SetStateWithName(SCHEMA_STATE_FILE_NAME, b)
+
+	if last.Schema == nil {
+		zap.S().Info("no previous schema to compare to, schema saved for the next run")
+		return
+	}
+
+	report := drift.Diff(last.Schema, current.Schema)
+	if report.Empty() {
+		zap.S().Info("no schema drift since last run")
+		return
+	}
+	zap.S().Warnw("schema drift since last run", "since", last.Taken, "added_objects", report.AddedObjects, "removed_objects", report.RemovedObjects, "changed_objects", len(report.Objects))
+
+	name := path.Join(SCHEMA_DRIFT_DIR, current.Taken.Format(SCHEMA_DRIFT_FORMAT))
+	jsonReport, err := json.MarshalIndent(struct {
+		Since time.Time `json:"since"`
+		Until time.Time `json:"until"`
+		*drift.Report
+	}{last.Taken, current.Taken, report}, "", "  ")
+	logger.PanicCheck(err)
+
+	err = s.cache.CacheFromReader(name+".json", bytes.NewReader(jsonReport))
+	logger.PanicCheck(err)
+
+	md := report.Markdown("Schema drift from " + last.Taken.Format(time.RFC3339) + " to " + current.Taken.Format(time.RFC3339))
+	err = s.cache.CacheFromReader(name+".md", bytes.NewReader([]byte(md)))
+	logger.PanicCheck(err)
+}
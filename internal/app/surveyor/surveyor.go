@@ -2,19 +2,18 @@ package surveyor
 
 import (
 	"encoding/json"
-	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Jeffail/tunny"
 	"github.com/dustin/go-humanize"
 	"github.com/spf13/viper"
-	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/app/cache"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/cache"
 	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/app/naptime"
 	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/logger"
 	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/client"
-	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/salesforce/api"
 	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/tools"
 	"go.uber.org/zap"
 )
@@ -28,6 +27,7 @@ const (
 	MAX_CPU_PERCENT            = "85%"
 	MAX_CHECK_INTERVAL         = "1m"
 	MAX_DAILY_RECORDS_REQUESTS = "2000"
+	MAX_RECORDS                = 0
 
 	CONFIG_KEY_MAX_JOBS                   = "surveyor.max_jobs"
 	CONFIG_KEY_MAX_METADATA_JOBS          = "surveyor.max_jobs"
@@ -37,6 +37,8 @@ const (
 	CONFIG_KEY_MAX_CPU_PERCENT            = "surveyor.max_cpu"
 	CONFIG_KEY_MAX_CHECK_INTERVAL         = "surveyor.max_check_interval"
 	CONFIG_KEY_MAX_DAILY_RECORDS_REQUESTS = "surveyor.max_daily_records_requests"
+	// Records per page of Query Job results, Salesforce picks when 0
+	CONFIG_KEY_MAX_RECORDS                = "surveyor.max_records"
 
 	METADATA_FILE_NAME = "metadata.json"
 	SURVEYOR_STATE_FILE_NAME = ".surveyor"
@@ -48,7 +50,7 @@ const (
 // 	Stop()
 // 	RequestRecords(RecordsState)
 // 	FetchRecords(RecordsState)
-// 	FlushCache() ([]os.FileInfo, error)
+// 	FlushCache() ([]cache.Item, error)
 // 	UpdateSettings()
 // }
 
@@ -60,15 +62,20 @@ func init() {
 	viper.SetDefault(CONFIG_KEY_MAX_CPU_PERCENT, MAX_CPU_PERCENT)
 	viper.SetDefault(CONFIG_KEY_MAX_CHECK_INTERVAL, MAX_CHECK_INTERVAL)
 	viper.SetDefault(CONFIG_KEY_MAX_DAILY_RECORDS_REQUESTS, MAX_DAILY_RECORDS_REQUESTS)
+	viper.SetDefault(CONFIG_KEY_MAX_RECORDS, MAX_RECORDS)
 }
 
 type surveyorState struct {
 	NumRecordsRequests int
+	// Watermarks are the latest watermark field value of each object's records backed up
+	Watermarks map[string]time.Time
+	// PendingWatermarks are held until every chunk of the object is backed up
+	PendingWatermarks map[string]time.Time
 }
 
 type Surveyor struct {
 	done               chan struct{}
-	recordsRequest     chan string
+	recordsRequest     chan RecordsState
 	fetchRecords       chan RecordsState
 	MetadataWorkers    *tunny.Pool
 	numMetadataWorkers int
@@ -77,31 +84,58 @@ type Surveyor struct {
 	numWorkers int
 
 	client       client.Client
-	cache        *cache.Cache
+	cache        cache.Cache
 
 	maxCache                uint64
 	maxCPU                  float64
 	maxCheckInverval        time.Duration
 	maxDailyRecordsRequests int
+	maxRecords              int
 	lastModified            time.Time
+	forceFull               bool
+	tombstones              bool
+	fieldRules              map[string]FieldRules
 
-	state surveyorState
+	// ObjectPolicy selects the objects backed up, `surveyor.objects` when nil
+	ObjectPolicy *ObjectPolicy
+
+	blobs           *blobFetcher
+	fetchBlobs      bool
+	numBlobWorkers  int
+	blobMaxAttempts int
+
+	pkChunkSize       uint64
+	pkChunkMinRecords int64
+	pkChunkMaxChunks  int
+	pkChunkObjects    []string
+
+	state   surveyorState
+	stateMu sync.Mutex
+
+	progress progress
+	finished chan struct{}
 }
 
-func NewSurveyor(client client.Client, cache *cache.Cache, naptime *naptime.Naptime) *Surveyor {
+func NewSurveyor(client client.Client, cache cache.Cache, naptime *naptime.Naptime) *Surveyor {
 	s := &Surveyor{
 		client:         client,
 		cache:          cache,
 		done:           make(chan struct{}),
-		recordsRequest: make(chan string),
+		finished:       make(chan struct{}),
+		recordsRequest: make(chan RecordsState),
 		fetchRecords:   make(chan RecordsState),
 	}
 	s.state = s.getState()
 	s.UpdateSettings()
+	s.Workers = newRecordsWorkers(s)
+	s.MetadataWorkers = newMetadataWorkers(s)
+	s.blobs = newBlobFetcher(s)
 
-	// add naptimes for worker pools
-	naptime.AddWorkerPool("Surveyor Record Workers", s.Workers, s.numWorkers)
-	naptime.AddWorkerPool("Surveyor Metadata Workers", s.MetadataWorkers, s.numMetadataWorkers)
+	// add naptimes for worker pools, napping this org's workers before its API limits run out
+	limitsNap := newAPILimitsNap(s)
+	naptime.AddWorkerPool("Surveyor Record Workers", s.Workers, s.numWorkers, limitsNap...)
+	naptime.AddWorkerPool("Surveyor Metadata Workers", s.MetadataWorkers, s.numMetadataWorkers, limitsNap...)
+	naptime.AddWorkerPool("Surveyor Blob Workers", s.blobs.Workers, s.numBlobWorkers, limitsNap...)
 
 	return s
 }
@@ -114,14 +148,8 @@ func (s *Surveyor) Start(done chan struct{}) (err error) {
 	}()
 
 	zap.S().Info("Starting Surveyor")
-	// TODO remove before prod build
-	jobs, err := api.GetAllQueryJobs(api.WithClient(s.client), api.CreatedById(s.client.GetUser()))
-	zap.S().Debugf("removing existing Query Jobs: %v", len(jobs.Records))
-	for _, j := range jobs.Records {
-		api.DeleteQueryJob(j.ID, api.WithClient(s.client))
-	}
-	// get timestamp from .today state cache
-	
+	purgeQueryJobs(s)
+
 	go func() {
 		for {
 			select {
@@ -130,15 +158,35 @@ func (s *Surveyor) Start(done chan struct{}) (err error) {
 				if ok {
 					s.bumpNumRequests()
 				}
+				s.progress.end()
 			case fetch := <-s.fetchRecords:
 				FetchRecords(s, fetch)
+				s.progress.end()
 			case <-done:
 				close(s.done)
-				close(s.fetchRecords)
+				return
 			}
 		}
 	}()
 
+	if s.fetchBlobs {
+		s.blobs.Start()
+	}
+	if viper.GetBool(CONFIG_KEY_METADATA_API) {
+		s.progress.begin()
+		go func() {
+			defer s.progress.end()
+			RetrieveOrgMetadata(s)
+		}()
+	}
+
+	// the Surveyor can't be finished before discovery is
+	s.progress.begin()
+	defer func() {
+		s.progress.end()
+		go s.watchFinished(s.maxCheckInverval)
+	}()
+
 	err = DiscoverRecords(s)
 	logger.PanicCheck(err)
 
@@ -154,10 +202,15 @@ func (s *Surveyor) Stop() {
 	close(s.fetchRecords)
 }
 
-func (s *Surveyor) FlushCache() ([]os.FileInfo, error) {
+func (s *Surveyor) FlushCache() ([]cache.Item, error) {
 	return s.cache.Flush()
 }
 
+// CachedKeys lists the key of everything cached, without reading any of it
+func (s *Surveyor) CachedKeys() ([]string, error) {
+	return s.cache.Keys("")
+}
+
 func (s *Surveyor) getState() surveyorState {
 	sb := s.cache.GetState(SURVEYOR_STATE_FILE_NAME)
 	ss := surveyorState{}
@@ -174,6 +227,9 @@ func (s *Surveyor) getState() surveyorState {
 }
 
 func (s *Surveyor) bumpNumRequests() {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
 	s.state.NumRecordsRequests = s.state.NumRecordsRequests + 1
 	s.saveState()
 }
@@ -192,6 +248,19 @@ func (s *Surveyor) UpdateSettings() {
 	s.numWorkers = viper.GetInt(CONFIG_KEY_MAX_JOBS)
 	s.numMetadataWorkers = viper.GetInt(CONFIG_KEY_MAX_METADATA_JOBS)
 	s.maxDailyRecordsRequests = viper.GetInt(CONFIG_KEY_MAX_DAILY_RECORDS_REQUESTS)
+	s.forceFull = viper.GetBool(CONFIG_KEY_FORCE_FULL)
+	s.tombstones = viper.GetBool(CONFIG_KEY_TOMBSTONES)
+	s.fetchBlobs = viper.GetBool(CONFIG_KEY_BLOBS)
+	s.numBlobWorkers = viper.GetInt(CONFIG_KEY_MAX_BLOB_JOBS)
+	s.blobMaxAttempts = viper.GetInt(CONFIG_KEY_BLOB_MAX_ATTEMPTS)
+
+	s.maxRecords = viper.GetInt(CONFIG_KEY_MAX_RECORDS)
+
+	s.fieldRules = make(map[string]FieldRules)
+	err := viper.UnmarshalKey(CONFIG_KEY_FIELDS, &s.fieldRules)
+	if err != nil {
+		zap.S().Errorf("unable to parse `%s` in Surveyor config: %v", CONFIG_KEY_FIELDS, err)
+	}
 
 	maxCache, err := humanize.ParseBytes(viper.GetString(CONFIG_KEY_MAX_CACHE_SIZE))
 	if err != nil {
@@ -222,4 +291,9 @@ func (s *Surveyor) UpdateSettings() {
 		timeDiff := time.Now().Unix() - int64(lastModified.Seconds())
 		s.lastModified = time.Unix(timeDiff, 0)
 	}
+
+	s.pkChunkSize = uint64(viper.GetInt64(CONFIG_KEY_PK_CHUNK_SIZE))
+	s.pkChunkMinRecords = viper.GetInt64(CONFIG_KEY_PK_CHUNK_MIN_RECORDS)
+	s.pkChunkMaxChunks = viper.GetInt(CONFIG_KEY_PK_CHUNK_MAX_CHUNKS)
+	s.pkChunkObjects = viper.GetStringSlice(CONFIG_KEY_PK_CHUNK_OBJECTS)
 }
@@ -0,0 +1,58 @@
+package surveyor
+
+import (
+	"path"
+
+	"github.com/spf13/viper"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/salesforce/api"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/salesforce/soql"
+	"go.uber.org/zap"
+)
+
+const (
+	TOMBSTONES = true
+
+	// Back up the records deleted since each object's watermark
+	CONFIG_KEY_TOMBSTONES = "surveyor.tombstones"
+
+	// Tombstones are cached as `<Object>.<page>.deleted.csv`, with their records state under `<Object>/deleted`
+	TOMBSTONE_SUFFIX = "deleted"
+)
+
+func init() {
+	viper.SetDefault(CONFIG_KEY_TOMBSTONES, TOMBSTONES)
+}
+
+// requestTombstones requests the Id and deletion time of the object's records deleted since its watermark.
+// Full backups have no tombstones, deleted records are simply left out of them.
+func requestTombstones(s *Surveyor, sobject api.SObject, field string) {
+	if !s.tombstones || s.forceFull || field == "" || !hasField(sobject, soql.SOQL_FIELD_IS_DELETED) {
+		return
+	}
+
+	wm := s.Watermark(sobject.Name)
+	if wm.IsZero() {
+		return
+	}
+
+	zap.S().Debugw("requesting records deleted since watermark", "object", sobject.Name, "field", field, "watermark", wm)
+	s.requestRecords(RecordsState{
+		ID:        sobject.Name,
+		Deleted:   true,
+		CachePath: path.Join(sobject.Name, TOMBSTONE_SUFFIX),
+		Query: soql.SelectFrom(sobject,
+			soql.WithFields(api.ID_FIELD, soql.SOQL_FIELD_IS_DELETED, field),
+			soql.WhereDeleted(),
+			soql.WhereAfter(field, wm),
+		),
+	})
+}
+
+func hasField(sobject api.SObject, name string) bool {
+	for _, f := range sobject.Fields {
+		if f.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+package surveyor
+
+import (
+	"path"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/cache"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/salesforce/api"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/salesforce/soql"
+	"go.uber.org/zap"
+)
+
+const (
+	FORCE_FULL = false
+
+	// Ignore watermarks and back up every record, new watermarks are still recorded
+	CONFIG_KEY_FORCE_FULL = "surveyor.force_full"
+)
+
+// Fields records are watermarked by, in order of preference.
+// SystemModstamp also changes when the system updates a record, so it's preferred over LastModifiedDate.
+var watermarkFields = []string{
+	soql.SOQL_FIELD_SYSTEM_MODSTAMP,
+	soql.SOQL_FIELD_LAST_MODIFIED,
+}
+
+func init() {
+	viper.SetDefault(CONFIG_KEY_FORCE_FULL, FORCE_FULL)
+}
+
+// watermarkField is the field the object's records are watermarked by, empty if it has none
+func watermarkField(sobject api.SObject) string {
+	for _, wf := range watermarkFields {
+		if hasField(sobject, wf) {
+			return wf
+		}
+	}
+	return ""
+}
+
+// recordsQueryOptions selects the object's fields, limiting its records to those changed since its watermark.
+// Objects without a watermark fall back to `surveyor.last_modified`, or a full backup if that isn't set.
+func recordsQueryOptions(s *Surveyor, sobject api.SObject) (string, []soql.SoqlOption) {
+	field := watermarkField(sobject)
+	options := []soql.SoqlOption{
+		soql.WithFields(selectFields(s, sobject, api.ID_FIELD, field)...),
+	}
+
+	if field == "" {
+		zap.S().Infow("object has no watermark field, backing up all records", "object", sobject.Name)
+		return "", options
+	}
+	if s.forceFull {
+		return field, options
+	}
+
+	if wm := s.Watermark(sobject.Name); !wm.IsZero() {
+		zap.S().Debugw("backing up records changed since watermark", "object", sobject.Name, "field", field, "watermark", wm)
+		return field, append(options, soql.WhereAfter(field, wm))
+	}
+
+	return field, append(options, soql.WhereLastModifiedAfter(s.lastModified))
+}
+
+// Watermark is the latest watermark field value of the object's records backed up, zero if there's none
+func (s *Surveyor) Watermark(object string) time.Time {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	return s.state.Watermarks[object]
+}
+
+// captureWatermark records the watermark of a completed records request.
+// A chunked object's watermark is held as pending until every one of its chunks completes.
+func (s *Surveyor) captureWatermark(rs RecordsState) {
+	if rs.WatermarkField == "" {
+		return
+	}
+
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	if s.state.Watermarks == nil {
+		s.state.Watermarks = make(map[string]time.Time)
+	}
+	if s.state.PendingWatermarks == nil {
+		s.state.PendingWatermarks = make(map[string]time.Time)
+	}
+
+	wm := s.state.PendingWatermarks[rs.ID]
+	if rs.Watermark.After(wm) {
+		wm = rs.Watermark
+	}
+
+	if rs.Chunk != "" && hasPendingChunks(s.cache, rs.ID) {
+		s.state.PendingWatermarks[rs.ID] = wm
+		s.saveState()
+		return
+	}
+
+	delete(s.state.PendingWatermarks, rs.ID)
+	if wm.After(s.state.Watermarks[rs.ID]) {
+		s.state.Watermarks[rs.ID] = wm
+		zap.S().Infow("records watermark updated", "object", rs.ID, "field", rs.WatermarkField, "watermark", wm)
+	}
+	s.saveState()
+}
+
+// hasPendingChunks checks if any of the object's chunks still have a records state
+func hasPendingChunks(c cache.Cache, object string) bool {
+	statePaths, err := c.FindAll(cache.STATE_FILE)
+	if err != nil {
+		zap.S().Warnw("unable to find cache states, assuming chunks are pending", "object", object, "error", err)
+		return true
+	}
+
+	prefix := path.Join(object, PK_CHUNK_DIR) + "/"
+	for _, p := range statePaths {
+		if strings.HasPrefix(p, prefix) {
+			return true
+		}
+	}
+	return false
+}
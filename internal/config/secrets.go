@@ -0,0 +1,77 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/secrets"
+)
+
+const (
+	KEYRING_FILE_NAME = "salesforce-backups.keyring"
+
+	// Env variable with the keyring passphrase, takes precedence over config
+	ENV_VAR_KEYRING_PASSPHRASE = "SALESFORCE_BACKUPS_KEYRING_PASSPHRASE"
+
+	CONFIG_KEY_KEYRING_PATH       = "secrets.keyring.path"
+	CONFIG_KEY_KEYRING_PASSPHRASE = "secrets.keyring.passphrase"
+)
+
+// ResolveSecrets replaces secret references in the loaded config, e.g. `password: env:RESTIC_PASSWORD`, with the secrets.
+// See secrets.Resolver for the supported references.
+func ResolveSecrets() error {
+	r := &secrets.Resolver{Keyring: OpenKeyring}
+
+	// Only keys with a reference are set, so the rest keep their precedence, e.g. flags over the config file
+	for _, key := range viper.AllKeys() {
+		// The keyring passphrase is resolved when the keyring is opened
+		if key == CONFIG_KEY_KEYRING_PASSPHRASE {
+			continue
+		}
+
+		resolved, changed, err := r.ResolveAll(viper.Get(key))
+		if err != nil {
+			return fmt.Errorf("unable to resolve secret in config `%s`: %w", key, err)
+		}
+		if changed {
+			viper.Set(key, resolved)
+		}
+	}
+
+	return nil
+}
+
+// KeyringPath is the keyring file set in config, by default in the config dir
+func KeyringPath() string {
+	if p := viper.GetString(CONFIG_KEY_KEYRING_PATH); p != "" {
+		return p
+	}
+	return filepath.Join(ConfigDir, KEYRING_FILE_NAME)
+}
+
+// OpenKeyring opens the local keyring with the passphrase from the env, or config.
+// The passphrase in config can be a reference to any secret outside the keyring.
+func OpenKeyring() (*secrets.Keyring, error) {
+	passphrase, ok := os.LookupEnv(ENV_VAR_KEYRING_PASSPHRASE)
+	if !ok {
+		ref := viper.GetString(CONFIG_KEY_KEYRING_PASSPHRASE)
+		if strings.HasPrefix(ref, secrets.PREFIX_KEYRING) {
+			return nil, errors.New("keyring passphrase can't be stored in the keyring")
+		}
+
+		var err error
+		passphrase, err = (&secrets.Resolver{}).Resolve(ref)
+		if err != nil {
+			return nil, fmt.Errorf("unable to resolve keyring passphrase: %w", err)
+		}
+	}
+	if passphrase == "" {
+		return nil, fmt.Errorf("no keyring passphrase, set `%s` or `%s`", ENV_VAR_KEYRING_PASSPHRASE, CONFIG_KEY_KEYRING_PASSPHRASE)
+	}
+
+	return secrets.OpenKeyring(KeyringPath(), passphrase)
+}
@@ -22,6 +22,11 @@ const (
 	CONFIG_KEY_LOG_TIMESTAMP = "timestamp"
 )
 
+func init() {
+	viper.SetDefault(CONFIG_KEY_LOG+"."+CONFIG_KEY_LOG_LEVEL, LOG_LEVEL)
+	viper.SetDefault(CONFIG_KEY_LOG+"."+CONFIG_KEY_LOG_OUTPUT, LOG_OUPUT)
+}
+
 func InitLogger() {
 
 	// Get logging config values
@@ -1,22 +1,38 @@
 package cache
 
 import (
+	"errors"
 	"io"
+	"time"
 )
 
-// ICache ...
+var ErrNotFound = errors.New("cache key not found")
+
+// Cache stores items by key. Keys are slash separated paths relative to the cache, e.g. `Account/metadata.json`.
 type Cache interface {
+	IState
 	BasePath() string
+	// Exists checks if the key, or any key under it as a path, is cached
 	Exists(key string) bool
 	Get(key string) (Item, error)
-	FindAll(key string) ([]string, error)
-	Cache(key string, val []byte) error
-	CacheFromReader(key string, r io.Reader) error
+	// FindAll returns the keys with the name as their last path element
+	FindAll(name string) ([]string, error)
+	Cache(key string, val []byte, opts ...CacheOption) error
+	CacheFromReader(key string, r io.Reader, opts ...CacheOption) error
 	Delete(key string) error
 	DeleteAllWithPath(path string) error
+	// Flush returns every cached item, items stay cached until deleted
 	Flush() ([]Item, error)
+	// FlushWithPath returns every item cached under the path, items stay cached until deleted
 	FlushWithPath(path string) ([]Item, error)
+	// Keys returns the key of every item cached under the path, or every key if the path is empty, without reading their values
+	Keys(path string) ([]string, error)
+}
 
+// FileCache is a Cache with items stored as files, which can be read from disk directly
+type FileCache interface {
+	Cache
+	FilePath(key string) string
 }
 
 type Item interface {
@@ -29,10 +45,31 @@ type Item interface {
 type CacheOptions struct {
 	Namespace string
 	ExpiresAt uint64
+	TTL time.Duration
 }
 
 type CacheOption func(*CacheOptions)
 
+// NewCacheOptions applies the options over the defaults
+func NewCacheOptions(defaults CacheOptions, opts ...CacheOption) CacheOptions {
+	o := defaults
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// Expiry is when an item cached with the options expires, as time.Unix. 0 never expires.
+func (o CacheOptions) Expiry() uint64 {
+	if o.ExpiresAt > 0 {
+		return o.ExpiresAt
+	}
+	if o.TTL > 0 {
+		return uint64(time.Now().Add(o.TTL).Unix())
+	}
+	return 0
+}
+
 func WithNamespace(ns string) CacheOption {
 	return func(o *CacheOptions) {
 		o.Namespace = ns
@@ -43,4 +80,11 @@ func ExpiresAt(ts uint64) CacheOption {
 	return func(o *CacheOptions) {
 		o.ExpiresAt = ts
 	}
-}
\ No newline at end of file
+}
+
+// TTL expires items the duration after they're cached, ExpiresAt takes precedence
+func TTL(d time.Duration) CacheOption {
+	return func(o *CacheOptions) {
+		o.TTL = d
+	}
+}
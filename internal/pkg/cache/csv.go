@@ -1,6 +1,5 @@
 package cache
 
-func CSV(i Item) 
 
 // CSV Options
 type CSVOption func(co *CSVOptions)
@@ -1,11 +1,30 @@
 package cache
 
+import (
+	"path"
+	"path/filepath"
+)
+
+const (
+	STATE_FILE = ".state"
+)
+
 
 
 type IState interface {
-	GetState(key string) ([]byte, error)
-	SetState(key string, val []byte) error
 	GetState(key string) []byte
 	SetState(key string, data []byte)
 	SetStateWithName(key string, data []byte)
-}
\ No newline at end of file
+}
+
+// StatePath is the key SetState stores the state of a cache key under, a `.state` key beside it.
+// Keys without an extension are paths, so their state is stored under them.
+func StatePath(key string) string {
+	dir, file := path.Split(filepath.ToSlash(key))
+
+	if path.Ext(file) == "" {
+		dir = path.Join(dir, file)
+	}
+
+	return path.Join(dir, STATE_FILE)
+}
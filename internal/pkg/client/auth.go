@@ -7,4 +7,10 @@ type Authenticator interface {
 type AccessToken interface {
 	GetAuthHeader() string
 	GetAuthID() string
-}
\ No newline at end of file
+}
+
+// InstanceToken is an AccessToken for a specific instance of the org, which API requests should be sent to
+type InstanceToken interface {
+	AccessToken
+	GetInstanceURL() string
+}
@@ -1,8 +1,27 @@
 package client
 
-import "net/http"
+import (
+	"errors"
+	"net/http"
+)
+
+// ErrSessionRenewed is returned by a SessionClient when the session ID sent in the request body had expired.
+// The session has been renewed, the request must be built again with the new session ID.
+var ErrSessionRenewed = errors.New("session renewed, the request must be sent again with the new session ID")
 
 type Client interface {
 	GetUser() string
 	DoClientRequest(*http.Request) (*http.Response, error)
 }
+
+// SessionClient is a Client with a session ID that can be sent in a request body, e.g. a SOAP session header
+type SessionClient interface {
+	Client
+	GetSessionID() string
+}
+
+// VersionedClient is a Client with the API version its org supports, e.g. `51.0`
+type VersionedClient interface {
+	Client
+	GetAPIVersion() string
+}
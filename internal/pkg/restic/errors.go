@@ -0,0 +1,90 @@
+package restic
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// restic exit codes
+	EXIT_CODE_SUCCESS             = 0
+	EXIT_CODE_FATAL               = 1
+	EXIT_CODE_INCOMPLETE_SNAPSHOT = 3
+	EXIT_CODE_REPO_NOT_EXIST      = 10
+	EXIT_CODE_LOCK_FAILED         = 11
+	EXIT_CODE_WRONG_PASSWORD      = 12
+	EXIT_CODE_INTERRUPTED         = 130
+)
+
+var (
+	ErrRepoNotExist       = errors.New("repository does not exist")
+	ErrWrongPassword      = errors.New("wrong password")
+	ErrLockHeld           = errors.New("repository lock held")
+	ErrIncompleteSnapshot = errors.New("snapshot created, but some files could not be read")
+	ErrInterrupted        = errors.New("interrupted")
+	ErrFatal              = errors.New("restic command failed")
+	ErrNoSummary          = errors.New("restic backup produced no summary")
+)
+
+// Older restic versions exit 1 for every fatal error, so these are matched against stderr as well
+var stderrErrors = map[string]error{
+	"Is there a repository at the following location?": ErrRepoNotExist,
+	"repository does not exist":                        ErrRepoNotExist,
+	"wrong password or no key found":                   ErrWrongPassword,
+	"unable to create lock":                            ErrLockHeld,
+	"repository is already locked":                     ErrLockHeld,
+}
+
+// ResticError is a failed restic command. Use errors.Is with the Err* values to check the cause.
+type ResticError struct {
+	Command  string
+	ExitCode int
+	Stderr   string
+	Err      error
+}
+
+func (e *ResticError) Error() string {
+	msg := fmt.Sprintf("restic %s: %v (exit code %d)", e.Command, e.Err, e.ExitCode)
+	if e.Stderr != "" {
+		msg += ": " + e.Stderr
+	}
+	return msg
+}
+
+func (e *ResticError) Unwrap() error {
+	return e.Err
+}
+
+// newResticError maps the exit code and stderr of a failed command to an error
+func newResticError(command string, exitCode int, stderr string) *ResticError {
+	stderr = strings.TrimSpace(stderr)
+	e := &ResticError{
+		Command:  command,
+		ExitCode: exitCode,
+		Stderr:   stderr,
+		Err:      ErrFatal,
+	}
+
+	switch exitCode {
+	case EXIT_CODE_INCOMPLETE_SNAPSHOT:
+		e.Err = ErrIncompleteSnapshot
+	case EXIT_CODE_REPO_NOT_EXIST:
+		e.Err = ErrRepoNotExist
+	case EXIT_CODE_LOCK_FAILED:
+		e.Err = ErrLockHeld
+	case EXIT_CODE_WRONG_PASSWORD:
+		e.Err = ErrWrongPassword
+	case EXIT_CODE_INTERRUPTED:
+		e.Err = ErrInterrupted
+	default:
+		for match, err := range stderrErrors {
+			if strings.Contains(stderr, match) {
+				e.Err = err
+				break
+			}
+		}
+	}
+
+	return e
+}
@@ -0,0 +1,248 @@
+package restic
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"time"
+)
+
+const (
+	// Values of `message_type` in restic's line delimited JSON output
+	MESSAGE_TYPE_STATUS   = "status"
+	MESSAGE_TYPE_SUMMARY  = "summary"
+	MESSAGE_TYPE_ERROR    = "error"
+	MESSAGE_TYPE_SNAPSHOT = "snapshot"
+	MESSAGE_TYPE_NODE     = "node"
+)
+
+// message is the envelope shared by every line of restic's JSON output
+type message struct {
+	MessageType string `json:"message_type"`
+	StructType  string `json:"struct_type"`
+}
+
+// BackupStatus is the progress restic reports while a backup runs
+type BackupStatus struct {
+	SecondsElapsed   int64    `json:"seconds_elapsed"`
+	SecondsRemaining int64    `json:"seconds_remaining"`
+	PercentDone      float64  `json:"percent_done"`
+	TotalFiles       int64    `json:"total_files"`
+	FilesDone        int64    `json:"files_done"`
+	TotalBytes       int64    `json:"total_bytes"`
+	BytesDone        int64    `json:"bytes_done"`
+	ErrorCount       int64    `json:"error_count"`
+	CurrentFiles     []string `json:"current_files"`
+}
+
+// BackupError is a file restic was unable to backup, the rest of the backup continues
+type BackupError struct {
+	Error struct {
+		Message string `json:"message"`
+	} `json:"error"`
+	During string `json:"during"`
+	Item   string `json:"item"`
+}
+
+// BackupSummary is reported once a backup completes
+type BackupSummary struct {
+	FilesNew            int64     `json:"files_new"`
+	FilesChanged        int64     `json:"files_changed"`
+	FilesUnmodified     int64     `json:"files_unmodified"`
+	DirsNew             int64     `json:"dirs_new"`
+	DirsChanged         int64     `json:"dirs_changed"`
+	DirsUnmodified      int64     `json:"dirs_unmodified"`
+	DataBlobs           int64     `json:"data_blobs"`
+	TreeBlobs           int64     `json:"tree_blobs"`
+	DataAdded           int64     `json:"data_added"`
+	DataAddedPacked     int64     `json:"data_added_packed"`
+	TotalFilesProcessed int64     `json:"total_files_processed"`
+	TotalBytesProcessed int64     `json:"total_bytes_processed"`
+	TotalDuration       float64   `json:"total_duration"`
+	BackupStart         time.Time `json:"backup_start"`
+	BackupEnd           time.Time `json:"backup_end"`
+	SnapshotID          string    `json:"snapshot_id"`
+	DryRun              bool      `json:"dry_run"`
+
+	// Errors holds the files restic was unable to read, reported before the summary
+	Errors []BackupError `json:"-"`
+}
+
+// Snapshot is an entry of `restic snapshots`
+type Snapshot struct {
+	ID             string    `json:"id"`
+	ShortID        string    `json:"short_id"`
+	Time           time.Time `json:"time"`
+	Parent         string    `json:"parent,omitempty"`
+	Tree           string    `json:"tree"`
+	Paths          []string  `json:"paths"`
+	Hostname       string    `json:"hostname,omitempty"`
+	Username       string    `json:"username,omitempty"`
+	Tags           []string  `json:"tags,omitempty"`
+	Excludes       []string  `json:"excludes,omitempty"`
+	ProgramVersion string    `json:"program_version,omitempty"`
+}
+
+// LsNode is a file or directory listed by `restic ls`
+type LsNode struct {
+	Name  string    `json:"name"`
+	Type  string    `json:"type"`
+	Path  string    `json:"path"`
+	UID   uint32    `json:"uid"`
+	GID   uint32    `json:"gid"`
+	Size  int64     `json:"size"`
+	Mode  uint32    `json:"mode"`
+	MTime time.Time `json:"mtime"`
+	ATime time.Time `json:"atime"`
+	CTime time.Time `json:"ctime"`
+}
+
+// Ls is the output of `restic ls`, the snapshot followed by its nodes
+type Ls struct {
+	Snapshot Snapshot
+	Nodes    []LsNode
+}
+
+// Stats is the output of `restic stats`
+type Stats struct {
+	TotalSize              int64   `json:"total_size"`
+	TotalUncompressedSize  int64   `json:"total_uncompressed_size,omitempty"`
+	TotalFileCount         int64   `json:"total_file_count"`
+	TotalBlobCount         int64   `json:"total_blob_count,omitempty"`
+	SnapshotsCount         int64   `json:"snapshots_count"`
+	CompressionRatio       float64 `json:"compression_ratio,omitempty"`
+	CompressionProgress    float64 `json:"compression_progress,omitempty"`
+	CompressionSpaceSaving float64 `json:"compression_space_saving,omitempty"`
+}
+
+// CheckSummary is reported once `restic check` completes
+type CheckSummary struct {
+	NumErrors          int64    `json:"num_errors"`
+	BrokenPacks        []string `json:"broken_packs"`
+	SuggestRepairIndex bool     `json:"suggest_repair_index"`
+	SuggestPrune       bool     `json:"suggest_prune"`
+
+	// Errors holds the problems restic found, reported before the summary
+	Errors []string `json:"-"`
+}
+
+// ForgetGroup is a group of snapshots a `restic forget` policy was applied to
+type ForgetGroup struct {
+	Tags    []string       `json:"tags"`
+	Host    string         `json:"host"`
+	Paths   []string       `json:"paths"`
+	Keep    []Snapshot     `json:"keep"`
+	Remove  []Snapshot     `json:"remove"`
+	Reasons []ForgetReason `json:"reasons"`
+}
+
+// ForgetReason explains why a snapshot was kept
+type ForgetReason struct {
+	Snapshot Snapshot `json:"snapshot"`
+	Matches  []string `json:"matches"`
+}
+
+// decodeMessages calls the handler with the message type of each line of restic's JSON output
+func decodeMessages(data []byte, handler func(messageType string, line []byte) error) error {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 || line[0] != '{' {
+			continue
+		}
+
+		m := message{}
+		if err := json.Unmarshal(line, &m); err != nil {
+			return err
+		}
+
+		mt := m.MessageType
+		if mt == "" {
+			mt = m.StructType
+		}
+		if err := handler(mt, line); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// parseBackup reads the summary and file errors from a backup's output, ErrNoSummary if restic didn't output one
+func parseBackup(data []byte) (*BackupSummary, error) {
+	var summary *BackupSummary
+	backupErrors := make([]BackupError, 0)
+
+	err := decodeMessages(data, func(messageType string, line []byte) error {
+		switch messageType {
+		case MESSAGE_TYPE_ERROR:
+			e := BackupError{}
+			if err := json.Unmarshal(line, &e); err != nil {
+				return err
+			}
+			backupErrors = append(backupErrors, e)
+		case MESSAGE_TYPE_SUMMARY:
+			summary = &BackupSummary{}
+			return json.Unmarshal(line, summary)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if summary == nil {
+		return nil, ErrNoSummary
+	}
+	summary.Errors = backupErrors
+
+	return summary, nil
+}
+
+func parseLs(data []byte) (*Ls, error) {
+	ls := &Ls{
+		Nodes: make([]LsNode, 0),
+	}
+
+	err := decodeMessages(data, func(messageType string, line []byte) error {
+		switch messageType {
+		case MESSAGE_TYPE_SNAPSHOT:
+			return json.Unmarshal(line, &ls.Snapshot)
+		case MESSAGE_TYPE_NODE:
+			n := LsNode{}
+			if err := json.Unmarshal(line, &n); err != nil {
+				return err
+			}
+			ls.Nodes = append(ls.Nodes, n)
+		}
+		return nil
+	})
+
+	return ls, err
+}
+
+func parseCheck(data []byte) (*CheckSummary, error) {
+	summary := &CheckSummary{}
+	checkErrors := make([]string, 0)
+
+	err := decodeMessages(data, func(messageType string, line []byte) error {
+		switch messageType {
+		case MESSAGE_TYPE_ERROR:
+			e := struct {
+				Message string `json:"message"`
+			}{}
+			if err := json.Unmarshal(line, &e); err != nil {
+				return err
+			}
+			checkErrors = append(checkErrors, e.Message)
+		case MESSAGE_TYPE_SUMMARY:
+			return json.Unmarshal(line, summary)
+		}
+		return nil
+	})
+
+	summary.Errors = checkErrors
+	return summary, err
+}
@@ -0,0 +1,241 @@
+package restic
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// Restic repository backends
+	BACKEND_LOCAL = "local"
+	BACKEND_SFTP  = "sftp"
+	BACKEND_REST  = "rest"
+	BACKEND_S3    = "s3"
+)
+
+// RepositoryConfig defines a restic repository on any backend.
+// Setting Repository uses the restic repository string as-is, instead of building it from the backend fields.
+type RepositoryConfig struct {
+	Backend    string `mapstructure:"backend"`
+	Repository string `mapstructure:"repository"`
+	Path       string `mapstructure:"path"`
+	Host       string `mapstructure:"host"`
+	User       string `mapstructure:"user"`
+	URL        string `mapstructure:"url"`
+	Password   string `mapstructure:"password"`
+	// Env holds backend specific credentials, e.g. AWS_ACCESS_KEY_ID
+	Env map[string]string `mapstructure:"env"`
+}
+
+// Repository implements Repo for any restic backend
+type Repository struct {
+	config *RepositoryConfig
+	Repo   string
+	// env is passed to only the restic commands run for this repository
+	env []string
+}
+
+func NewRepository(config *RepositoryConfig) (*Repository, error) {
+	repo, err := BuildRepository(config)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Repository{
+		config: config,
+		Repo:   repo,
+		env:    config.environ(),
+	}
+
+	if err := r.InitRepo(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// environ is the restic password and backend credentials as `KEY=value` env variables
+func (c *RepositoryConfig) environ() []string {
+	env := make([]string, 0, len(c.Env)+1)
+	if c.Password != "" {
+		env = append(env, ENV_VAR_RESITIC_PASSWORD+"="+c.Password)
+	}
+	for k, v := range c.Env {
+		env = append(env, k+"="+v)
+	}
+	return env
+}
+
+// BuildRepository returns the restic repository string for the backend, e.g. `sftp:user@host:/srv/restic`
+func BuildRepository(config *RepositoryConfig) (string, error) {
+	if config.Repository != "" {
+		return config.Repository, nil
+	}
+
+	switch config.Backend {
+	case BACKEND_LOCAL, "":
+		if config.Path == "" {
+			return "", errors.New("local restic repository requires a path")
+		}
+		return filepath.Abs(config.Path)
+	case BACKEND_SFTP:
+		if config.Host == "" || config.Path == "" {
+			return "", errors.New("sftp restic repository requires a host and path")
+		}
+		host := config.Host
+		if config.User != "" {
+			host = config.User + "@" + host
+		}
+		return fmt.Sprintf("sftp:%s:%s", host, config.Path), nil
+	case BACKEND_REST:
+		if config.URL == "" {
+			return "", errors.New("rest-server restic repository requires a url")
+		}
+		return fmt.Sprintf("rest:%s", config.URL), nil
+	case BACKEND_S3:
+		if config.URL == "" {
+			return "", errors.New("s3 restic repository requires a url")
+		}
+		return buildRepoPath(config.URL, config.Path), nil
+	}
+
+	return "", fmt.Errorf("unknown restic repository backend: %s", config.Backend)
+}
+
+func (r *Repository) InitRepo() error {
+
+	exists, err := repoExists(r.env, r.Repo)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		err := createRepo(r.env, r.Repo)
+		if err != nil {
+			return err
+		}
+		zap.S().Infof("Restic Init new repo created: %s", r.Repo)
+		return nil
+	}
+
+	zap.S().Infof("Restic repo exists: %s", r.Repo)
+
+	return nil
+}
+
+func (r *Repository) RunCmd(cmdArgs ...string) ([]byte, error) {
+	args := []string{"-r", r.Repo}
+	args = append(args, cmdArgs...)
+	return RunResticCmdWithEnv(r.env, args...)
+}
+
+// Snapshots returns the snapshots in the repo, optionally filtered by tags
+func (r *Repository) Snapshots(tags ...string) ([]Snapshot, error) {
+	args := []string{CMD_SNAPSHOTS}
+	for _, t := range tags {
+		args = append(args, CMD_ARG_TAG, t)
+	}
+
+	out, err := r.RunCmd(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := make([]Snapshot, 0)
+	err = json.Unmarshal(out, &snapshots)
+	return snapshots, err
+}
+
+// Backup stores the paths in a new snapshot with the tags.
+// If some files couldn't be read, the summary is returned along with ErrIncompleteSnapshot.
+func (r *Repository) Backup(paths []string, tags ...string) (*BackupSummary, error) {
+	args := []string{CMD_BACKUP}
+	for _, t := range tags {
+		args = append(args, CMD_ARG_TAG, t)
+	}
+	args = append(args, paths...)
+
+	summary, err := backupResult(r.RunCmd(args...))
+	if summary != nil {
+		for _, e := range summary.Errors {
+			zap.S().Warnw("Restic unable to backup file", "item", e.Item, "during", e.During, "error", e.Error.Message)
+		}
+	}
+
+	return summary, err
+}
+
+// Restore restores a snapshot into the target directory.
+// If no include patterns are given, the whole snapshot is restored.
+func (r *Repository) Restore(snapshotID string, target string, include ...string) error {
+	if snapshotID == "" {
+		snapshotID = SNAPSHOT_LATEST
+	}
+
+	args := []string{CMD_RESTORE, snapshotID, CMD_ARG_TARGET, target}
+	for _, i := range include {
+		args = append(args, CMD_ARG_INCLUDE, i)
+	}
+	_, err := r.RunCmd(args...)
+	return err
+}
+
+// Ls lists the files in a snapshot, optionally limited to the paths
+func (r *Repository) Ls(snapshotID string, paths ...string) (*Ls, error) {
+	if snapshotID == "" {
+		snapshotID = SNAPSHOT_LATEST
+	}
+
+	args := append([]string{CMD_LS, snapshotID}, paths...)
+	out, err := r.RunCmd(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseLs(out)
+}
+
+// Stats returns the size of the snapshots, or the whole repo if none are given
+func (r *Repository) Stats(snapshotIDs ...string) (*Stats, error) {
+	args := append([]string{CMD_STATS}, snapshotIDs...)
+	out, err := r.RunCmd(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &Stats{}
+	err = json.Unmarshal(out, stats)
+	return stats, err
+}
+
+// Check verifies the integrity of the repo
+func (r *Repository) Check() (*CheckSummary, error) {
+	out, err := r.RunCmd(CMD_CHECK)
+
+	summary, perr := parseCheck(out)
+	if err != nil {
+		return summary, err
+	}
+
+	return summary, perr
+}
+
+// Forget removes snapshots from the repo, args are passed to `restic forget` as-is
+func (r *Repository) Forget(args ...string) ([]ForgetGroup, error) {
+	out, err := r.RunCmd(append([]string{CMD_FORGET}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]ForgetGroup, 0)
+	if len(out) == 0 {
+		return groups, nil
+	}
+
+	err = json.Unmarshal(out, &groups)
+	return groups, err
+}
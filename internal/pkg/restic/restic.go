@@ -1,7 +1,6 @@
 package restic
 
 import (
-	"encoding/json"
 	"errors"
 	"os"
 	"os/exec"
@@ -31,11 +30,31 @@ const (
 	CMD_ARG_REPO_LOC_DISABLED = "--no-lock"
 	CMD_ARG_TAG               = "--tag"
 	CMD_ARG_VERBOSE           = "--verbose"
+	CMD_ARG_TARGET            = "--target"
+	CMD_ARG_INCLUDE           = "--include"
+	// forget args
+	CMD_ARG_KEEP_LAST    = "--keep-last"
+	CMD_ARG_KEEP_HOURLY  = "--keep-hourly"
+	CMD_ARG_KEEP_DAILY   = "--keep-daily"
+	CMD_ARG_KEEP_WEEKLY  = "--keep-weekly"
+	CMD_ARG_KEEP_MONTHLY = "--keep-monthly"
+	CMD_ARG_KEEP_YEARLY  = "--keep-yearly"
+	CMD_ARG_KEEP_WITHIN  = "--keep-within"
+	CMD_ARG_GROUP_BY     = "--group-by"
+	CMD_ARG_PRUNE        = "--prune"
+	CMD_ARG_DRY_RUN      = "--dry-run"
 
 	// TODO: add sub-command arg constants as needed
 	CMD_INIT      = "init"
 	CMD_BACKUP    = "backup"
 	CMD_SNAPSHOTS = "snapshots"
+	CMD_RESTORE   = "restore"
+	CMD_CHECK     = "check"
+	CMD_LS        = "ls"
+	CMD_STATS     = "stats"
+	CMD_FORGET    = "forget"
+
+	SNAPSHOT_LATEST = "latest"
 
 	ENV_VAR_RESITIC_PASSWORD  = "RESTIC_PASSWORD"
 	ENV_VAR_RESTIC_REPOSITORY = "RESTIC_REPOSITORY"
@@ -43,51 +62,119 @@ const (
 
 type Repo interface {
 	InitRepo() error
-	RunCmd(...string) (interface{}, error)
+	RunCmd(...string) ([]byte, error)
 }
 
-func RunResticCmd(cmdArgs ...string) (interface{}, error) {
+// RunResticCmd runs restic with JSON output and returns stdout.
+// A failed command returns a *ResticError mapped from the exit code and stderr.
+func RunResticCmd(cmdArgs ...string) ([]byte, error) {
+	return RunResticCmdWithEnv(nil, cmdArgs...)
+}
 
-	if os.Getenv(ENV_VAR_RESTIC_REPOSITORY) != "" && !tools.StringSliceContaines(cmdArgs, "-r") {
-		return nil, errors.New("no Resitc repository defined, use the '-r' arg or define env variable")
-	}
+// RunResticCmdWithEnv runs restic like RunResticCmd, adding the env variables (`KEY=value`) to only its environment.
+// Secrets like the repository password are passed this way, so they never reach the global environment.
+func RunResticCmdWithEnv(env []string, cmdArgs ...string) ([]byte, error) {
 
 	// if one string, slit args into slice
 	if len(cmdArgs) == 1 {
 		cmdArgs = strings.Split(cmdArgs[0], " ")
 	}
 
+	hasRepo := tools.StringSliceContaines(cmdArgs, "-r") || tools.StringSliceContaines(cmdArgs, CMD_ARG_REPO)
+	if os.Getenv(ENV_VAR_RESTIC_REPOSITORY) == "" && !hasEnv(env, ENV_VAR_RESTIC_REPOSITORY) && !hasRepo {
+		return nil, errors.New("no Resitc repository defined, use the '-r' arg or define env variable")
+	}
+
 	// Append output format flag
 	cmdArgs = append(cmdArgs, CMD_ARG_OUTPUT_JSON)
 
 	// Tun and capture output
 	cmd := exec.Command(CMD, cmdArgs...)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
 
 	streams, err := runcmd.Run(cmd)
 	if err != nil {
-		zap.S().Errorw("unable to run Restic command", "error", err.Error())
+		exitCode := EXIT_CODE_FATAL
+		if cmd.ProcessState != nil {
+			exitCode = cmd.ProcessState.ExitCode()
+		}
+		rerr := newResticError(subCommand(cmdArgs), exitCode, streams.Stderr().String())
+		zap.S().Debugw("Restic command failed", "command", rerr.Command, "exit_code", exitCode, "error", rerr.Err)
+
+		// restic still outputs the summary of a backup that couldn't read every file
+		return streams.Stdout().Bytes(), rerr
 	}
 
-	stdout := new(interface{})
-	json.Unmarshal(streams.Stdout().Bytes(), stdout)
+	zap.S().Debugw("Restic command done", "command", subCommand(cmdArgs), "output_bytes", streams.Stdout().Len())
+
+	return streams.Stdout().Bytes(), nil
+}
+
+// subCommand finds the restic command in the args, skipping global flags
+func subCommand(cmdArgs []string) string {
+	for i, a := range cmdArgs {
+		if strings.HasPrefix(a, "-") {
+			continue
+		}
+		if i > 0 && (cmdArgs[i-1] == "-r" || cmdArgs[i-1] == CMD_ARG_REPO) {
+			continue
+		}
+		return a
+	}
+	return ""
+}
 
-	zap.S().Debugw("Restic command done", "output", stdout, "error", err)
+// hasEnv checks if the env variable is set in the `KEY=value` list
+func hasEnv(env []string, key string) bool {
+	for _, e := range env {
+		if strings.HasPrefix(e, key+"=") && len(e) > len(key)+1 {
+			return true
+		}
+	}
+	return false
+}
 
-	return stdout, err
+// RepoExists checks if the repo exists. Errors other than the repo not existing, e.g. a wrong password, are returned.
+func RepoExists(repo string) (bool, error) {
+	return repoExists(nil, repo)
 }
 
-func RepoExists(repo string) bool {
+func repoExists(env []string, repo string) (bool, error) {
 	zap.S().Infof("Checking if repo exists: %+v", repo)
-	out, err := RunResticCmd(CMD_ARG_REPO, repo, CMD_SNAPSHOTS)
-	zap.S().Debugw("repo exists check", "output", out, "error", err)
-	return err == nil
+	_, err := RunResticCmdWithEnv(env, CMD_ARG_REPO, repo, CMD_SNAPSHOTS)
+	if errors.Is(err, ErrRepoNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func CreateRepo(repo string) error {
+	return createRepo(nil, repo)
 }
 
-func CreateRepo(repo string) (interface{}, error) {
+func createRepo(env []string, repo string) error {
 	zap.S().Infof("Attempting to create repo: %+v", repo)
-	return RunResticCmd(CMD_ARG_REPO, repo, CMD_INIT)
+	_, err := RunResticCmdWithEnv(env, CMD_ARG_REPO, repo, CMD_INIT)
+	return err
 }
 
-func Backup(filePath string) (interface{}, error) {
-	return RunResticCmd(CMD_BACKUP, filePath)
+func Backup(filePath string) (*BackupSummary, error) {
+	out, err := RunResticCmd(CMD_BACKUP, filePath)
+	return backupResult(out, err)
+}
+
+// backupResult parses the backup summary, which restic still outputs for an incomplete snapshot
+func backupResult(out []byte, err error) (*BackupSummary, error) {
+	if err != nil && !errors.Is(err, ErrIncompleteSnapshot) {
+		return nil, err
+	}
+
+	summary, perr := parseBackup(out)
+	if perr != nil {
+		return nil, perr
+	}
+
+	return summary, err
 }
@@ -1,35 +1,56 @@
 package api
 
 import (
+	"fmt"
 	"net/http"
 	"net/url"
 
-	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/logger"
 	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/client"
 	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/tools"
 )
 
 const (
 	API_BASE_PATH = "/services/data"
-	API_VERSION   = "v51.0"
+	// API_VERSION is used with clients that haven't negotiated a version with their org
+	API_VERSION = "v51.0"
 
 	ID_FIELD = "Id"
 )
 
-func doAPIRequest(req *http.Request, c client.Client) (resp *http.Response, err error) {
-	defer func ()  {
-		if e := recover(); e != nil {
-			err = e.(APIError)
-		}
-	}()
-	
-	u, err := tools.URLBuilder(API_BASE_PATH, API_VERSION, req.URL.String())
-	logger.PanicCheck(err)
+func doAPIRequest(req *http.Request, c client.Client) (*http.Response, error) {
+	u, err := tools.URLBuilder(API_BASE_PATH, apiVersion(c), req.URL.Path)
+	if err != nil {
+		return nil, err
+	}
 
+	u.RawQuery = req.URL.RawQuery
 	req.URL = u
 	return c.DoClientRequest(req)
 }
 
+// apiVersion is the version the client negotiated with its org, e.g. `v52.0`, or API_VERSION
+func apiVersion(c client.Client) string {
+	vc, ok := c.(client.VersionedClient)
+	if !ok || vc.GetAPIVersion() == "" {
+		return API_VERSION
+	}
+
+	v, err := ParseVersion(vc.GetAPIVersion())
+	if err != nil {
+		return API_VERSION
+	}
+
+	return v.String()
+}
+
+// recoveredError is the error a recovered panic was raised with, e.g. a SalesforceError
+func recoveredError(e interface{}) error {
+	if err, ok := e.(error); ok {
+		return err
+	}
+	return APIError(fmt.Sprint(e))
+}
+
 type APIError string 
 
 func (ae APIError) Error() string {
@@ -60,13 +81,35 @@ func (wc withClient) applyAPI(o *APIOptions) {
 	o.client = wc.client
 }
 
+// urlQueryParam is a functional option to set a url query parameter of an api call
+type urlQueryParam struct {
+	key string
+	val string
+}
+
+func (qp urlQueryParam) applyAPI(o *APIOptions) {
+	if o.urlQueryParams == nil {
+		o.urlQueryParams = url.Values{}
+	}
+	o.urlQueryParams.Set(qp.key, qp.val)
+}
+
 type APIRequestBody struct {
-	Operation       string `json:"operation,omitempty"`
-	Query           string `json:"query,omitempty"`
-	ContentType     string `json:"content_type,omitempty"`
-	ColumnDelimiter string `json:"column_delimiter,omitempty"`
-	LineEnding      string `json:"line_ending,omitempty"`
-	State           string `json:",omitempty"`
+	Object              string `json:"object,omitempty"`
+	Operation           string `json:"operation,omitempty"`
+	Query               string `json:"query,omitempty"`
+	ExternalIdFieldName string `json:"externalIdFieldName,omitempty"`
+	ContentType         string `json:"content_type,omitempty"`
+	ColumnDelimiter     string `json:"column_delimiter,omitempty"`
+	LineEnding          string `json:"line_ending,omitempty"`
+	State               string `json:"state,omitempty"`
+}
+
+// requestBodyOption is a functional option to set values in the request body of an api call
+type requestBodyOption func(*APIRequestBody)
+
+func (rbo requestBodyOption) applyAPI(o *APIOptions) {
+	rbo(&o.requestBody)
 }
 
 const (
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/logger"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/tools"
+)
+
+// GetBlob streams the binary content of a record's blob field, e.g. ContentVersion `VersionData` or Attachment `Body`.
+// Bulk queries can't return blob fields, so they're fetched a record at a time. The body must be closed.
+func GetBlob(object string, id string, field string, options ...APIOption) (body io.ReadCloser, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("unable to get %s of %s %s: %v", field, object, id, e)
+		}
+	}()
+
+	o := &APIOptions{}
+
+	for _, opt := range options {
+		opt.applyAPI(o)
+	}
+
+	endPoint, err := tools.URLBuilder(object, id, field)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, endPoint.String(), nil)
+	logger.PanicCheck(err)
+
+	resp, err := doRestRequest(req, o.client)
+	logger.PanicCheck(err)
+
+	return resp.Body, nil
+}
@@ -0,0 +1,330 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"path"
+
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/logger"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/client"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/tools"
+)
+
+const (
+	BULKV2_INGEST_END_POINT = "jobs/ingest"
+
+	INGEST_BATCHES_ENDPOINT = "batches"
+
+	// Ingest Job operations
+	INGEST_OPERATION_INSERT      = "insert"
+	INGEST_OPERATION_UPSERT      = "upsert"
+	INGEST_OPERATION_UPDATE      = "update"
+	INGEST_OPERATION_DELETE      = "delete"
+	INGEST_OPERATION_HARD_DELETE = "hardDelete"
+
+	// Ingest Job results
+	INGEST_RESULTS_SUCCESSFUL  = "successfulResults"
+	INGEST_RESULTS_FAILED      = "failedResults"
+	INGEST_RESULTS_UNPROCESSED = "unprocessedrecords"
+
+	// Columns Salesforce prepends to Ingest Job results
+	INGEST_RESULTS_COLUMN_ID      = "sf__Id"
+	INGEST_RESULTS_COLUMN_CREATED = "sf__Created"
+	INGEST_RESULTS_COLUMN_ERROR   = "sf__Error"
+
+	// Job Status only used by Ingest Jobs
+	STATUS_OPEN = "Open" // The job has been created, and data can be uploaded to the job.
+)
+
+// doBulkV2IngestRequest acts as a simple middleware to make http requests to the client
+func doBulkV2IngestRequest(req *http.Request, c client.Client) (*http.Response, error) {
+	req.URL.Path = path.Join(BULKV2_INGEST_END_POINT, req.URL.Path)
+	if req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	return doAPIRequest(req, c)
+}
+
+// IngestJob represents a Salesforce BulkV2 Ingest Job as a Go struct
+type IngestJob struct {
+	ID                     string  `json:"id,omitempty"`
+	Operation              string  `json:"operation,omitempty"`
+	Object                 string  `json:"object,omitempty"`
+	ExternalIdFieldName    string  `json:"externalIdFieldName,omitempty"`
+	CreatedById            string  `json:"createdById,omitempty"`
+	CreatedDate            string  `json:"createdDate,omitempty"`
+	SystemModstamp         string  `json:"systemModstamp,omitempty"`
+	State                  string  `json:"state,omitempty"`
+	ConcurrencyMode        string  `json:"concurrencyMode,omitempty"`
+	ContentType            string  `json:"contentType,omitempty"`
+	ApiVersion             float32 `json:"apiVersion,omitempty"`
+	JobType                string  `json:"jobType,omitempty"`
+	LineEnding             string  `json:"lineEnding,omitempty"`
+	ColumnDelimiter        string  `json:"columnDelimiter,omitempty"`
+	NumberRecordsProcessed int     `json:"numberRecordsProcessed,omitempty"`
+	NumberRecordsFailed    int     `json:"numberRecordsFailed,omitempty"`
+	Retries                int     `json:"retries,omitempty"`
+	TotalProcessingTime    int     `json:"totalProcessingTime,omitempty"`
+	ErrorMessage           string  `json:"errorMessage,omitempty"`
+}
+
+func (ij IngestJob) Complete() bool {
+	return ij.State == STATUS_JOB_COMPLETE
+}
+
+func (ij IngestJob) Failed() bool {
+	return ij.State == STATUS_FAILED
+}
+
+func (ij IngestJob) Aborted() bool {
+	return ij.State == STATUS_ABORTED
+}
+
+// Done is true when Salesforce is no longer processing the job
+func (ij IngestJob) Done() bool {
+	return ij.Complete() || ij.Failed() || ij.Aborted()
+}
+
+// ExternalIDField sets the field used to match records in an upsert Ingest Job
+func ExternalIDField(field string) APIOption {
+	return requestBodyOption(func(b *APIRequestBody) {
+		b.ExternalIdFieldName = field
+	})
+}
+
+// CreateIngestJob creates a BulkV2 Ingest Job for the object with the given operation
+func CreateIngestJob(object string, operation string, options ...APIOption) (ij IngestJob, err error) {
+	// Recover on Salesforce API error
+	defer func() {
+		if e := recover(); e != nil {
+			err = recoveredError(e)
+		}
+	}()
+
+	o := &APIOptions{}
+	o.requestBody = APIRequestBody{
+		Object:    object,
+		Operation: operation,
+	}
+
+	for _, opt := range options {
+		opt.applyAPI(o)
+	}
+
+	if o.requestBody.Operation == INGEST_OPERATION_UPSERT && o.requestBody.ExternalIdFieldName == "" {
+		return IngestJob{}, errors.New("upsert Ingest Jobs require an external ID field")
+	}
+
+	return createIngestJob(o)
+}
+
+func createIngestJob(o *APIOptions) (IngestJob, error) {
+	payload, err := json.Marshal(o.requestBody)
+	logger.PanicCheck(err)
+
+	req, err := http.NewRequest(http.MethodPost, "", bytes.NewBuffer(payload))
+	logger.PanicCheck(err)
+
+	resp, err := doBulkV2IngestRequest(req, o.client)
+	if err != nil {
+		return IngestJob{}, err
+	}
+
+	return ingestJobFromResponse(resp)
+}
+
+// UploadIngestJobData uploads CSV data to an open Ingest Job.
+// The data must include a header row using the object's field names.
+func UploadIngestJobData(jobID string, data io.Reader, options ...APIOption) (err error) {
+	// Recover on Salesforce API error
+	defer func() {
+		if e := recover(); e != nil {
+			err = recoveredError(e)
+		}
+	}()
+
+	o := &APIOptions{}
+
+	for _, opt := range options {
+		opt.applyAPI(o)
+	}
+
+	return uploadIngestJobData(jobID, data, o)
+}
+
+func uploadIngestJobData(jobID string, data io.Reader, o *APIOptions) error {
+	endPoint, err := tools.URLBuilder(jobID, INGEST_BATCHES_ENDPOINT)
+	logger.PanicCheck(err)
+
+	req, err := http.NewRequest(http.MethodPut, endPoint.String(), data)
+	logger.PanicCheck(err)
+
+	req.Header.Set("Content-Type", HEADER_CSV)
+
+	resp, err := doBulkV2IngestRequest(req, o.client)
+	logger.PanicCheck(err)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return errors.New("failed attempting to upload ingest job data")
+	}
+
+	return nil
+}
+
+// CloseIngestJob marks the Ingest Job as `UploadComplete`, queueing it to be processed by Salesforce
+func CloseIngestJob(jobID string, options ...APIOption) (IngestJob, error) {
+	return setIngestJobState(jobID, STATUS_UPLOAD_COMPLETE, options...)
+}
+
+// AbortIngestJob aborts an Ingest Job, no more data is processed for the job
+func AbortIngestJob(jobID string, options ...APIOption) (IngestJob, error) {
+	return setIngestJobState(jobID, STATUS_ABORTED, options...)
+}
+
+func setIngestJobState(jobID string, state string, options ...APIOption) (ij IngestJob, err error) {
+	// Recover on Salesforce API error
+	defer func() {
+		if e := recover(); e != nil {
+			err = recoveredError(e)
+		}
+	}()
+
+	o := &APIOptions{}
+	o.requestBody = APIRequestBody{
+		State: state,
+	}
+
+	for _, opt := range options {
+		opt.applyAPI(o)
+	}
+
+	payload, err := json.Marshal(o.requestBody)
+	logger.PanicCheck(err)
+
+	req, err := http.NewRequest(http.MethodPatch, jobID, bytes.NewBuffer(payload))
+	logger.PanicCheck(err)
+
+	resp, err := doBulkV2IngestRequest(req, o.client)
+	logger.PanicCheck(err)
+
+	return ingestJobFromResponse(resp)
+}
+
+// GetIngestJob returns a BulkV2 Ingest Job given the jobID
+func GetIngestJob(jobID string, options ...APIOption) (ij IngestJob, err error) {
+	// Recover on Salesforce API error
+	defer func() {
+		if e := recover(); e != nil {
+			err = recoveredError(e)
+		}
+	}()
+
+	o := &APIOptions{}
+
+	for _, opt := range options {
+		opt.applyAPI(o)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, jobID, nil)
+	logger.PanicCheck(err)
+
+	resp, err := doBulkV2IngestRequest(req, o.client)
+	logger.PanicCheck(err)
+
+	return ingestJobFromResponse(resp)
+}
+
+// IngestJobResults holds the CSV results of a processed Ingest Job
+type IngestJobResults struct {
+	JobID      string
+	ResultType string
+	Data       []byte
+}
+
+// GetIngestJobResults returns the CSV results of a processed Ingest Job.
+// The resultType is one of the `INGEST_RESULTS_*` values.
+func GetIngestJobResults(jobID string, resultType string, options ...APIOption) (ijr IngestJobResults, err error) {
+	// Recover on Salesforce API error
+	defer func() {
+		if e := recover(); e != nil {
+			err = recoveredError(e)
+		}
+	}()
+
+	o := &APIOptions{}
+
+	for _, opt := range options {
+		opt.applyAPI(o)
+	}
+
+	endPoint, err := tools.URLBuilder(jobID, resultType)
+	logger.PanicCheck(err)
+
+	req, err := http.NewRequest(http.MethodGet, endPoint.String(), nil)
+	logger.PanicCheck(err)
+
+	req.Header.Add("Accept", HEADER_CSV)
+
+	resp, err := doBulkV2IngestRequest(req, o.client)
+	logger.PanicCheck(err)
+
+	bodyBytes, err := tools.HTTPGetResponseBody(resp)
+	if err != nil {
+		return IngestJobResults{}, err
+	}
+
+	return IngestJobResults{
+		JobID:      jobID,
+		ResultType: resultType,
+		Data:       bodyBytes,
+	}, nil
+}
+
+// DeleteIngestJob deletes an Ingest Job, along with its data and results
+func DeleteIngestJob(jobID string, options ...APIOption) (err error) {
+	// Recover on Salesforce API error
+	defer func() {
+		if e := recover(); e != nil {
+			err = recoveredError(e)
+		}
+	}()
+
+	o := &APIOptions{}
+
+	for _, opt := range options {
+		opt.applyAPI(o)
+	}
+
+	req, err := http.NewRequest(http.MethodDelete, jobID, nil)
+	logger.PanicCheck(err)
+
+	resp, err := doBulkV2IngestRequest(req, o.client)
+	logger.PanicCheck(err)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return errors.New("failed attempting to delete ingest job")
+	}
+
+	return nil
+}
+
+func ingestJobFromResponse(resp *http.Response) (IngestJob, error) {
+	bodyBytes, err := tools.HTTPGetResponseBody(resp)
+	if err != nil {
+		return IngestJob{}, err
+	}
+
+	job := IngestJob{}
+	err = json.Unmarshal(bodyBytes, &job)
+	if err != nil {
+		return IngestJob{}, err
+	}
+
+	return job, nil
+}
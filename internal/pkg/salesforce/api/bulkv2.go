@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"path"
@@ -11,7 +13,6 @@ import (
 
 	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/logger"
 	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/client"
-	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/salesforce"
 	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/tools"
 	"go.uber.org/zap"
 )
@@ -40,7 +41,7 @@ func doBulkV2Request(req *http.Request, c client.Client) (*http.Response, error)
 func applyAPIRequest(req *http.Request) *http.Request {
 
 	// prepend BulkV2 endpoint and set headers
-	req.URL.Path = path.Join(BULKV2_END_POINT, req.URL.String())
+	req.URL.Path = path.Join(BULKV2_END_POINT, req.URL.Path)
 	req.Header.Set("Content-Type", "application/json")
 
 	return req
@@ -89,6 +90,14 @@ const (
 	CREATE_OPERATION         = "query"
 )
 
+// WithQueryType is a functional option to set the operation of a Query Job.
+// QUERY_ALL jobs include deleted and archived records.
+func WithQueryType(qt QueryType) APIOption {
+	return requestBodyOption(func(b *APIRequestBody) {
+		b.Operation = qt.String()
+	})
+}
+
 func CreateQueryJob(query string, options ...APIOption) (QueryJob, error) {
 	o := &APIOptions{}
 	o.requestBody = APIRequestBody{
@@ -131,10 +140,9 @@ func createQueryJob(o *APIOptions) (qj QueryJob, er error) {
 // GetQueryJob returns a BulkV2 QueryJob given the jobID
 func GetQueryJob(jobID string, options ...APIOption) QueryJob {
 	// Recover on Salesforce API error
-	// re-panic if error is not a SalesforceError
 	defer func ()  {
 		if e := recover(); e != nil {
-			zap.S().Error(e.(salesforce.SalesforceError))
+			zap.S().Error(recoveredError(e))
 		}
 	}()
 	o := &APIOptions{}
@@ -173,10 +181,9 @@ type AllQueryJobs struct {
 // GetAllQueryJobs loops through BulkV2 Jobs pages, returning all Query Jobs
 func GetAllQueryJobs(options ...APIOption) (jobs *AllQueryJobs, err error) {
 	// Recover on Salesforce API error
-	// re-panic if error is not a SalesforceError
 	defer func ()  {
 		if e := recover(); e != nil {
-			err = e.(salesforce.SalesforceError)
+			err = recoveredError(e)
 		}
 	}()
 
@@ -249,6 +256,9 @@ const (
 	// Results Response Headers
 	HEADER_NUMBER_OF_RECORDS = "Sforce-NumberOfRecords"
 	HEADER_LOCATOR           = "Sforce-Locator"
+
+	URL_PARAM_LOCATOR     = "locator"
+	URL_PARAM_MAX_RECORDS = "maxRecords"
 )
 
 type QueryJobResults struct {
@@ -259,7 +269,59 @@ type QueryJobResults struct {
 	Format          string
 }
 
+// QueryJobResultsStream is a page of Query Job results with the CSV body left unread.
+// The Body must be closed by the caller.
+type QueryJobResultsStream struct {
+	JobID           string
+	NumberOfRecords int
+	NextLocator     string
+	Body            io.ReadCloser
+	Format          string
+}
+
+// Done checks if there are no more pages of results after this one.
+// Salesforce sends a string of "null", instead of a null value....
+func (qs *QueryJobResultsStream) Done() bool {
+	return qs.NextLocator == "" || qs.NextLocator == "null"
+}
+
+// Locator is a functional option to get the page of Query Job results at the locator
+func Locator(locator string) APIOption {
+	return urlQueryParam{URL_PARAM_LOCATOR, locator}
+}
+
+// MaxRecords is a functional option to set the max number of records in a page of Query Job results.
+// Salesforce picks the page size if it isn't set.
+func MaxRecords(n int) APIOption {
+	return urlQueryParam{URL_PARAM_MAX_RECORDS, strconv.Itoa(n)}
+}
+
+// GetQueryJobResults reads a page of Query Job results into memory
 func GetQueryJobResults(jobID string, options ...APIOption) (qj QueryJobResults, err error) {
+	qs, err := StreamQueryJobResults(jobID, options...)
+	if err != nil {
+		return qj, err
+	}
+	defer qs.Body.Close()
+
+	data, err := io.ReadAll(qs.Body)
+	if err != nil {
+		return qj, err
+	}
+
+	results := QueryJobResults{
+		JobID:           qs.JobID,
+		NumberOfRecords: qs.NumberOfRecords,
+		NextLocator:     qs.NextLocator,
+		Data:            data,
+		Format:          qs.Format,
+	}
+
+	return results, nil
+}
+
+// StreamQueryJobResults requests a page of Query Job results, returning before the CSV body is read
+func StreamQueryJobResults(jobID string, options ...APIOption) (*QueryJobResultsStream, error) {
 	o := &APIOptions{
 		urlQueryParams: url.Values{},
 	}
@@ -268,46 +330,42 @@ func GetQueryJobResults(jobID string, options ...APIOption) (qj QueryJobResults,
 		opt.applyAPI(o)
 	}
 
-	return getQueryJobResults(jobID, o)
+	return streamQueryJobResults(jobID, o)
 }
 
-func getQueryJobResults(jobID string, o *APIOptions) (qj QueryJobResults, err error) {
-	// Recover on Salesforce API error
-	// re-panic if error is not a SalesforceError
-	defer func ()  {
-		if e := recover(); e != nil {
-			err = e.(APIError)
-		}
-	}()
-
+func streamQueryJobResults(jobID string, o *APIOptions) (*QueryJobResultsStream, error) {
 	endPoint, err := tools.URLBuilder(jobID, QUERY_JOB_RESULTS_ENDPOINT)
-	logger.PanicCheck(err)
+	if err != nil {
+		return nil, err
+	}
 
 	if len(o.urlQueryParams) > 0 {
 		endPoint.RawQuery = o.urlQueryParams.Encode()
 	}
 
 	req, err := http.NewRequest(http.MethodGet, endPoint.String(), nil)
-	logger.PanicCheck(err)
+	if err != nil {
+		return nil, err
+	}
 
 	req.Header.Add("Accept", HEADER_CSV)
 
 	resp, err := doBulkV2Request(req, o.client)
-	logger.PanicCheck(err)
-
-	bodyBytes, err := tools.HTTPGetResponseBody(resp)
-	logger.PanicCheck(err)
+	if err != nil {
+		return nil, err
+	}
 
 	numRecords, err := strconv.Atoi(resp.Header.Get(HEADER_NUMBER_OF_RECORDS))
-	logger.PanicCheck(err)
-
-	nextLocator := resp.Header.Get(HEADER_LOCATOR)
+	if err != nil {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unable to read the number of records in Query Job %s results: %w", jobID, err)
+	}
 
-	results := QueryJobResults{
+	results := &QueryJobResultsStream{
 		JobID:           jobID,
 		NumberOfRecords: numRecords,
-		NextLocator:     nextLocator,
-		Data:            bodyBytes,
+		NextLocator:     resp.Header.Get(HEADER_LOCATOR),
+		Body:            resp.Body,
 		Format:          DEFAULT_CONTENT_TYPE,
 	}
 
@@ -317,10 +375,9 @@ func getQueryJobResults(jobID string, o *APIOptions) (qj QueryJobResults, err er
 // AbortQueryJob
 func AbortQueryJob(jobID string, options ...APIOption) (qj QueryJob, err error) {
 	// Recover on Salesforce API error
-	// re-panic if error is not a SalesforceError
 	defer func ()  {
 		if e := recover(); e != nil {
-			err = e.(salesforce.SalesforceError)
+			err = recoveredError(e)
 		}
 	}()
 	o := &APIOptions{}
@@ -358,10 +415,9 @@ func abortQueryJob(jobID string, o *APIOptions) (QueryJob, error) {
 
 func DeleteQueryJob(jobID string, options ...APIOption) (err error) {
 	// Recover on Salesforce API error
-	// re-panic if error is not a SalesforceError
 	defer func ()  {
 		if e := recover(); e != nil {
-			err = e.(salesforce.SalesforceError)
+			err = recoveredError(e)
 		}
 	}()
 	o := &APIOptions{}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/salesforce"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/tools"
+)
+
+const (
+	END_POINT_LIMITS       = "limits"
+	END_POINT_RECORD_COUNT = "recordCount"
+
+	URL_PARAM_SOBJECTS = "sObjects"
+)
+
+// Limits are the org's limits by name, e.g. `DailyApiRequests`
+type Limits map[string]salesforce.Limit
+
+// GetLimits gets the org's limits and what's left of them
+func GetLimits(options ...APIOption) (Limits, error) {
+	o := &APIOptions{}
+	for _, opt := range options {
+		opt.applyAPI(o)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, END_POINT_LIMITS, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := doAPIRequest(req, o.client)
+	if err != nil {
+		return nil, err
+	}
+
+	bodyBytes, err := tools.HTTPGetResponseBody(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	limits := Limits{}
+	err = json.Unmarshal(bodyBytes, &limits)
+	if err != nil {
+		return nil, err
+	}
+
+	return limits, nil
+}
+
+// RecordCounts are the approximate number of records of each object, as Salesforce last counted them
+type RecordCounts struct {
+	SObjects []struct {
+		Count int64  `json:"count"`
+		Name  string `json:"name"`
+	} `json:"sObjects"`
+}
+
+// Count is the number of records of the object, 0 if it wasn't counted
+func (rc *RecordCounts) Count(object string) int64 {
+	for _, o := range rc.SObjects {
+		if o.Name == object {
+			return o.Count
+		}
+	}
+	return 0
+}
+
+// RecordCount gets the approximate number of records of the objects, or of every object if none are given
+func RecordCount(objects []string, options ...APIOption) (*RecordCounts, error) {
+	o := &APIOptions{
+		urlQueryParams: url.Values{},
+	}
+
+	for _, opt := range options {
+		opt.applyAPI(o)
+	}
+	if len(objects) > 0 {
+		o.urlQueryParams.Set(URL_PARAM_SOBJECTS, strings.Join(objects, ","))
+	}
+
+	endPoint, err := tools.URLBuilder(END_POINT_LIMITS, END_POINT_RECORD_COUNT)
+	if err != nil {
+		return nil, err
+	}
+	endPoint.RawQuery = o.urlQueryParams.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, endPoint.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := doAPIRequest(req, o.client)
+	if err != nil {
+		return nil, err
+	}
+
+	bodyBytes, err := tools.HTTPGetResponseBody(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	results := &RecordCounts{}
+	err = json.Unmarshal(bodyBytes, results)
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/tools"
+)
+
+const (
+	END_POINT_QUERY = "query"
+
+	URL_PARAM_QUERY = "q"
+)
+
+// QueryResults is a page of records from the REST query endpoint.
+// Only suited to small queries, e.g. probes, larger ones should use a BulkV2 Query Job.
+type QueryResults struct {
+	TotalSize      int                      `json:"totalSize"`
+	Done           bool                     `json:"done"`
+	NextRecordsURL string                   `json:"nextRecordsUrl,omitempty"`
+	Records        []map[string]interface{} `json:"records"`
+}
+
+// Query runs the SOQL query through the REST API, returning the first page of records
+func Query(soql string, options ...APIOption) (*QueryResults, error) {
+	o := &APIOptions{
+		urlQueryParams: url.Values{},
+	}
+
+	for _, opt := range options {
+		opt.applyAPI(o)
+	}
+	o.urlQueryParams.Set(URL_PARAM_QUERY, soql)
+
+	req, err := http.NewRequest(http.MethodGet, END_POINT_QUERY, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.URL.RawQuery = o.urlQueryParams.Encode()
+
+	resp, err := doAPIRequest(req, o.client)
+	if err != nil {
+		return nil, err
+	}
+
+	bodyBytes, err := tools.HTTPGetResponseBody(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	results := &QueryResults{}
+	err = json.Unmarshal(bodyBytes, results)
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
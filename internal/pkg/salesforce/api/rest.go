@@ -21,9 +21,10 @@ const (
 )
 
 func doRestRequest(req *http.Request, c client.Client) (*http.Response, error) {
-	endPoint, err := tools.URLBuilder(REST_ENDPOINT, req.URL.String())
+	endPoint, err := tools.URLBuilder(REST_ENDPOINT, req.URL.Path)
 	logger.PanicCheck(err)
 
+	endPoint.RawQuery = req.URL.RawQuery
 	req.URL = endPoint
 
 	resp, err := doAPIRequest(req, c)
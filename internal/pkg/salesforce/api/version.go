@@ -33,6 +33,26 @@ func NewVersion(v float32) Version {
 	return Version{parts}
 }
 
+// ParseVersion parses a version like `51.0` or `v51.0`
+func ParseVersion(s string) (Version, error) {
+	s = strings.TrimPrefix(s, "v")
+	if s == "" {
+		return Version{}, errors.New("no value for Version")
+	}
+
+	sParts := strings.Split(s, ".")
+	parts := make([]int, len(sParts))
+	for i, p := range sParts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return Version{}, fmt.Errorf("invalid Version %s: %w", s, err)
+		}
+		parts[i] = n
+	}
+
+	return Version{parts}, nil
+}
+
 func stringToParts(s string) ([]int, error) {
 	s = strings.TrimPrefix(s, "v")
 	sParts := strings.Split(s, ".")
@@ -1,6 +1,8 @@
 package auth
 
 import (
+	"fmt"
+
 	"github.com/mitchellh/mapstructure"
 	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/client"
 	"go.uber.org/zap"
@@ -26,7 +28,14 @@ type StandardAccessToken struct {
 	InstanceURL string `json:"instance_url,omitempty"`
 }
 
-func AttemptConnectAll(url string, authMethods map[string]interface{}) client.AccessToken {
+// GetInstanceURL is the URL of the org's instance, which API requests are sent to instead of the login URL
+func (at StandardAccessToken) GetInstanceURL() string {
+	return at.InstanceURL
+}
+
+// AttemptConnectAll authenticates with the first of the auth methods that connects,
+// returning a token source that renews the session with the same method
+func AttemptConnectAll(url string, authMethods map[string]interface{}) (*TokenSource, error) {
 
 	var accessToken client.AccessToken
 	var auth client.Authenticator
@@ -55,6 +64,48 @@ authLoop:
 			}
 			break authLoop
 
+		case CONFIG_REFRESH_TOKEN_KEY:
+			var cfg RefreshTokenConfig
+			err := mapstructure.Decode(val, &cfg)
+			if err != nil {
+				zap.S().Warnw("refresh token config invalid")
+				break
+			}
+			auth, err = NewRefreshToken(url, cfg)
+			if err != nil {
+				zap.S().Warnw("refresh token config invalid")
+				break
+			}
+
+			zap.S().Info("Attempting refresh token Session")
+			accessToken, err = auth.Authenticate()
+			if err != nil {
+				zap.S().Errorw("unable to connect refresh token session", "error", err)
+				break
+			}
+			break authLoop
+
+		case CONFIG_CLIENT_CREDENTIALS_KEY:
+			var cfg ClientCredentialsConfig
+			err := mapstructure.Decode(val, &cfg)
+			if err != nil {
+				zap.S().Warnw("client credentials config invalid")
+				break
+			}
+			auth, err = NewClientCredentials(url, cfg)
+			if err != nil {
+				zap.S().Warnw("client credentials config invalid")
+				break
+			}
+
+			zap.S().Info("Attempting client credentials Session")
+			accessToken, err = auth.Authenticate()
+			if err != nil {
+				zap.S().Errorw("unable to connect client credentials session", "error", err)
+				break
+			}
+			break authLoop
+
 		case "jwt":
 			var cfg JWTConfig
 			err := mapstructure.Decode(val, &cfg)
@@ -99,7 +150,11 @@ authLoop:
 		}
 	}
 
-	return accessToken
+	if accessToken == nil {
+		return nil, fmt.Errorf("unable to connect a session to %s with any of the auth methods", url)
+	}
+
+	return NewTokenSource(auth, accessToken), nil
 }
 
 // // Web Server Flow
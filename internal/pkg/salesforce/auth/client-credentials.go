@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"net/url"
+
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/client"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/tools"
+	"go.uber.org/zap"
+)
+
+const (
+	CLIENT_CREDENTIALS_GRANT_TYPE = "client_credentials"
+
+	CONFIG_CLIENT_CREDENTIALS_KEY = "client_credentials"
+)
+
+// ClientCredentialsConfig authenticates headless as the connected app's run-as user.
+// The client URL must be the org's My Domain URL, the flow isn't supported on login.salesforce.com.
+// See https://help.salesforce.com/s/articleView?id=sf.remoteaccess_oauth_client_credentials_flow.htm&type=5
+type ClientCredentialsConfig struct {
+	ClientID      string `mapstructure:"client_id"`
+	ClientSecret  string `mapstructure:"client_secret"`
+	TokenEndpoint string `mapstructure:"token_endpoint,omitempty"`
+
+	tokenEndpoint *url.URL
+}
+
+func NewClientCredentials(clientURL string, config ClientCredentialsConfig) (*ClientCredentialsConfig, error) {
+	if config.TokenEndpoint == "" {
+		config.TokenEndpoint = TOKEN_ENDPOINT
+	}
+
+	tokenEndpoint, err := tools.URLBuilder(clientURL, config.TokenEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	config.tokenEndpoint = tokenEndpoint
+
+	return &config, nil
+}
+
+func (cc *ClientCredentialsConfig) Authenticate() (client.AccessToken, error) {
+	data := url.Values{
+		"grant_type":    {CLIENT_CREDENTIALS_GRANT_TYPE},
+		"client_id":     {cc.ClientID},
+		"client_secret": {cc.ClientSecret},
+	}
+
+	zap.S().Debugw("requesting access token with client credentials", "endpoint", cc.tokenEndpoint.String())
+	return requestToken(cc.tokenEndpoint.String(), data)
+}
@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"net/url"
+
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/client"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/tools"
+	"go.uber.org/zap"
+)
+
+const (
+	REFRESH_TOKEN_GRANT_TYPE = "refresh_token"
+
+	CONFIG_REFRESH_TOKEN_KEY = "refresh_token"
+)
+
+// RefreshTokenConfig authenticates headless with a refresh token issued to the connected app, e.g. by the web server flow.
+// See https://help.salesforce.com/s/articleView?id=sf.remoteaccess_oauth_refresh_token_flow.htm&type=5
+type RefreshTokenConfig struct {
+	ClientID      string `mapstructure:"client_id"`
+	ClientSecret  string `mapstructure:"client_secret,omitempty"`
+	RefreshToken  string `mapstructure:"refresh_token"`
+	TokenEndpoint string `mapstructure:"token_endpoint,omitempty"`
+
+	tokenEndpoint *url.URL
+}
+
+func NewRefreshToken(clientURL string, config RefreshTokenConfig) (*RefreshTokenConfig, error) {
+	if config.TokenEndpoint == "" {
+		config.TokenEndpoint = TOKEN_ENDPOINT
+	}
+
+	tokenEndpoint, err := tools.URLBuilder(clientURL, config.TokenEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	config.tokenEndpoint = tokenEndpoint
+
+	return &config, nil
+}
+
+func (rt *RefreshTokenConfig) Authenticate() (client.AccessToken, error) {
+	data := url.Values{
+		"grant_type":    {REFRESH_TOKEN_GRANT_TYPE},
+		"client_id":     {rt.ClientID},
+		"refresh_token": {rt.RefreshToken},
+	}
+	if rt.ClientSecret != "" {
+		data.Set("client_secret", rt.ClientSecret)
+	}
+
+	zap.S().Debugw("requesting access token with refresh token", "endpoint", rt.tokenEndpoint.String())
+	accessToken, err := requestToken(rt.tokenEndpoint.String(), data)
+	if err != nil {
+		return nil, err
+	}
+	// the refresh token isn't reissued
+	accessToken.RefreshToken = rt.RefreshToken
+
+	return accessToken, nil
+}
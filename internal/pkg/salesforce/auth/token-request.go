@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/tools"
+)
+
+// tokenResponse is the token endpoint's JSON response, or its error
+type tokenResponse struct {
+	ID           string `json:"id"`
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	InstanceURL  string `json:"instance_url"`
+	TokenType    string `json:"token_type"`
+	IssuedAt     string `json:"issued_at"`
+	Signature    string `json:"signature"`
+	Scope        string `json:"scope"`
+
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// requestToken posts the grant to the token endpoint, returning the access token it grants
+func requestToken(tokenEndpoint string, data url.Values) (*OAuth2AccessToken, error) {
+	resp, err := http.PostForm(tokenEndpoint, data)
+	if err != nil {
+		return nil, err
+	}
+
+	bodyBytes, err := tools.HTTPGetResponseBody(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	tr := tokenResponse{}
+	if err := json.Unmarshal(bodyBytes, &tr); err != nil {
+		return nil, fmt.Errorf("unable to read token response, status %s: %w", resp.Status, err)
+	}
+	if tr.Error != "" || resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("%s grant failed, status %s: %s %s", data.Get("grant_type"), resp.Status, tr.Error, tr.ErrorDescription)
+	}
+
+	accessToken := &OAuth2AccessToken{
+		StandardAccessToken: StandardAccessToken{
+			ID:          tr.ID,
+			AccessToken: tr.AccessToken,
+			InstanceURL: tr.InstanceURL,
+			TokenType:   tr.TokenType,
+		},
+		RefreshToken: tr.RefreshToken,
+		Signature:    tr.Signature,
+		Scope:        strings.Fields(tr.Scope),
+	}
+	// issued_at is in milliseconds
+	if ms, err := strconv.ParseInt(tr.IssuedAt, 10, 64); err == nil {
+		accessToken.IssuedAt = time.Unix(0, ms*int64(time.Millisecond))
+	}
+
+	return accessToken, nil
+}
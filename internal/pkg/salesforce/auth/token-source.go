@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"sync"
+
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/client"
+	"go.uber.org/zap"
+)
+
+// TokenSource holds a session's access token, renewing it with the session's authenticator when it expires
+type TokenSource struct {
+	mu    sync.Mutex
+	auth  client.Authenticator
+	token client.AccessToken
+}
+
+func NewTokenSource(auth client.Authenticator, token client.AccessToken) *TokenSource {
+	return &TokenSource{
+		auth:  auth,
+		token: token,
+	}
+}
+
+// Token is the current access token
+func (ts *TokenSource) Token() client.AccessToken {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return ts.token
+}
+
+// Renew authenticates again, unless the expired token was already renewed by a concurrent request
+func (ts *TokenSource) Renew(expired client.AccessToken) (client.AccessToken, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	// tokens aren't always comparable, their headers are
+	if ts.token.GetAuthHeader() != expired.GetAuthHeader() {
+		return ts.token, nil
+	}
+
+	zap.S().Info("session expired, authenticating again")
+	token, err := ts.auth.Authenticate()
+	if err != nil {
+		return nil, err
+	}
+	ts.token = token
+
+	return token, nil
+}
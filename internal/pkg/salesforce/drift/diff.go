@@ -0,0 +1,162 @@
+package drift
+
+import (
+	"sort"
+	"strconv"
+)
+
+const (
+	// Field attributes compared between snapshots
+	ATTRIBUTE_TYPE      = "type"
+	ATTRIBUTE_LENGTH    = "length"
+	ATTRIBUTE_PRECISION = "precision"
+	ATTRIBUTE_SCALE     = "scale"
+)
+
+// Report is the drift from one schema snapshot to the next
+type Report struct {
+	AddedObjects   []string      `json:"added_objects,omitempty"`
+	RemovedObjects []string      `json:"removed_objects,omitempty"`
+	Objects        []ObjectDrift `json:"objects,omitempty"`
+}
+
+// ObjectDrift is the drift of an object in both snapshots
+type ObjectDrift struct {
+	Name          string       `json:"name"`
+	AddedFields   []string     `json:"added_fields,omitempty"`
+	RemovedFields []string     `json:"removed_fields,omitempty"`
+	Fields        []FieldDrift `json:"fields,omitempty"`
+}
+
+// FieldDrift is the drift of a field in both snapshots
+type FieldDrift struct {
+	Name                  string   `json:"name"`
+	Changes               []Change `json:"changes,omitempty"`
+	AddedPicklistValues   []string `json:"added_picklist_values,omitempty"`
+	RemovedPicklistValues []string `json:"removed_picklist_values,omitempty"`
+}
+
+// Change is an attribute of a field that changed
+type Change struct {
+	Attribute string `json:"attribute"`
+	From      string `json:"from"`
+	To        string `json:"to"`
+}
+
+// Empty checks if there's no drift
+func (r *Report) Empty() bool {
+	return len(r.AddedObjects) == 0 && len(r.RemovedObjects) == 0 && len(r.Objects) == 0
+}
+
+func (od *ObjectDrift) empty() bool {
+	return len(od.AddedFields) == 0 && len(od.RemovedFields) == 0 && len(od.Fields) == 0
+}
+
+func (fd *FieldDrift) empty() bool {
+	return len(fd.Changes) == 0 && len(fd.AddedPicklistValues) == 0 && len(fd.RemovedPicklistValues) == 0
+}
+
+// Diff reports the drift from the old schema to the new one, sorted by object and field name
+func Diff(old Schema, new Schema) *Report {
+	r := &Report{}
+
+	for _, name := range schemaNames(new) {
+		o, ok := old[name]
+		if !ok {
+			r.AddedObjects = append(r.AddedObjects, name)
+			continue
+		}
+		if od := DiffObject(o, new[name]); !od.empty() {
+			r.Objects = append(r.Objects, od)
+		}
+	}
+	for _, name := range schemaNames(old) {
+		if _, ok := new[name]; !ok {
+			r.RemovedObjects = append(r.RemovedObjects, name)
+		}
+	}
+
+	return r
+}
+
+// DiffObject reports the drift of an object's fields from the old schema to the new one
+func DiffObject(old ObjectSchema, new ObjectSchema) ObjectDrift {
+	od := ObjectDrift{Name: new.Name}
+
+	for _, name := range fieldNames(new.Fields) {
+		o, ok := old.Fields[name]
+		if !ok {
+			od.AddedFields = append(od.AddedFields, name)
+			continue
+		}
+		if fd := diffField(name, o, new.Fields[name]); !fd.empty() {
+			od.Fields = append(od.Fields, fd)
+		}
+	}
+	for _, name := range fieldNames(old.Fields) {
+		if _, ok := new.Fields[name]; !ok {
+			od.RemovedFields = append(od.RemovedFields, name)
+		}
+	}
+
+	return od
+}
+
+func diffField(name string, old FieldSchema, new FieldSchema) FieldDrift {
+	fd := FieldDrift{Name: name}
+
+	if old.Type != new.Type {
+		fd.Changes = append(fd.Changes, Change{ATTRIBUTE_TYPE, old.Type, new.Type})
+	}
+	for _, c := range []struct {
+		attribute string
+		old, new  int
+	}{
+		{ATTRIBUTE_LENGTH, old.Length, new.Length},
+		{ATTRIBUTE_PRECISION, old.Precision, new.Precision},
+		{ATTRIBUTE_SCALE, old.Scale, new.Scale},
+	} {
+		if c.old != c.new {
+			fd.Changes = append(fd.Changes, Change{c.attribute, strconv.Itoa(c.old), strconv.Itoa(c.new)})
+		}
+	}
+
+	fd.AddedPicklistValues = missing(new.Picklist, old.Picklist)
+	fd.RemovedPicklistValues = missing(old.Picklist, new.Picklist)
+
+	return fd
+}
+
+// missing returns the values in a that aren't in b
+func missing(a []string, b []string) []string {
+	in := make(map[string]bool, len(b))
+	for _, v := range b {
+		in[v] = true
+	}
+
+	var m []string
+	for _, v := range a {
+		if !in[v] {
+			m = append(m, v)
+		}
+	}
+	return m
+}
+
+func schemaNames(s Schema) []string {
+	names := make([]string, 0, len(s))
+	for name := range s {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func fieldNames(fields map[string]FieldSchema) []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
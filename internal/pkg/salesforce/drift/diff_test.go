@@ -0,0 +1,161 @@
+package drift
+
+import (
+	"reflect"
+	"testing"
+
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/salesforce/api"
+)
+
+func object(name string, fields map[string]FieldSchema) ObjectSchema {
+	return ObjectSchema{Name: name, Fields: fields}
+}
+
+func TestNewObjectSchema(t *testing.T) {
+	sobject := api.SObject{
+		Name: "Account",
+		Fields: []api.SObjectFields{
+			{Name: "Name", Type: "string", Length: 255},
+			{Name: "AnnualRevenue", Type: "currency", Precision: 18, Scale: 2},
+			{Name: "Type", Type: "picklist", Length: 40, Picklistvalues: []api.SObjectPicklist{
+				{Value: "Prospect", Active: true},
+				{Value: "Customer", Active: true},
+				{Value: "Retired", Active: false},
+			}},
+		},
+	}
+
+	want := object("Account", map[string]FieldSchema{
+		"Name":          {Type: "string", Length: 255},
+		"AnnualRevenue": {Type: "currency", Precision: 18, Scale: 2},
+		"Type":          {Type: "picklist", Length: 40, Picklist: []string{"Customer", "Prospect"}},
+	})
+	if got := NewObjectSchema(sobject); !reflect.DeepEqual(got, want) {
+		t.Errorf("NewObjectSchema() = %+v, want %+v", got, want)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	account := object("Account", map[string]FieldSchema{"Name": {Type: "string", Length: 255}})
+	contact := object("Contact", map[string]FieldSchema{"LastName": {Type: "string", Length: 80}})
+	lead := object("Lead", map[string]FieldSchema{"Company": {Type: "string", Length: 255}})
+
+	tests := []struct {
+		name string
+		old  Schema
+		new  Schema
+		want *Report
+	}{
+		{
+			name: "no changes",
+			old:  Schema{"Account": account, "Contact": contact},
+			new:  Schema{"Account": account, "Contact": contact},
+			want: &Report{},
+		},
+		{
+			name: "added objects",
+			old:  Schema{"Account": account},
+			new:  Schema{"Account": account, "Lead": lead, "Contact": contact},
+			want: &Report{AddedObjects: []string{"Contact", "Lead"}},
+		},
+		{
+			name: "removed objects",
+			old:  Schema{"Account": account, "Lead": lead, "Contact": contact},
+			new:  Schema{"Account": account},
+			want: &Report{RemovedObjects: []string{"Contact", "Lead"}},
+		},
+		{
+			name: "changed object",
+			old:  Schema{"Account": account, "Contact": contact},
+			new:  Schema{"Account": object("Account", map[string]FieldSchema{"Name": {Type: "string", Length: 80}}), "Lead": lead},
+			want: &Report{
+				AddedObjects:   []string{"Lead"},
+				RemovedObjects: []string{"Contact"},
+				Objects: []ObjectDrift{{
+					Name:   "Account",
+					Fields: []FieldDrift{{Name: "Name", Changes: []Change{{ATTRIBUTE_LENGTH, "255", "80"}}}},
+				}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Diff(tt.old, tt.new)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Diff() = %+v, want %+v", got, tt.want)
+			}
+			if got.Empty() != tt.want.Empty() {
+				t.Errorf("Diff().Empty() = %v, want %v", got.Empty(), tt.want.Empty())
+			}
+		})
+	}
+}
+
+func TestDiffObject(t *testing.T) {
+	tests := []struct {
+		name string
+		old  map[string]FieldSchema
+		new  map[string]FieldSchema
+		want ObjectDrift
+	}{
+		{
+			name: "no changes",
+			old:  map[string]FieldSchema{"Name": {Type: "string", Length: 255}, "Type": {Type: "picklist", Picklist: []string{"Customer"}}},
+			new:  map[string]FieldSchema{"Name": {Type: "string", Length: 255}, "Type": {Type: "picklist", Picklist: []string{"Customer"}}},
+			want: ObjectDrift{Name: "Account"},
+		},
+		{
+			name: "added fields",
+			old:  map[string]FieldSchema{"Name": {Type: "string", Length: 255}},
+			new:  map[string]FieldSchema{"Name": {Type: "string", Length: 255}, "Site": {Type: "string", Length: 80}, "Industry": {Type: "picklist"}},
+			want: ObjectDrift{Name: "Account", AddedFields: []string{"Industry", "Site"}},
+		},
+		{
+			name: "removed fields",
+			old:  map[string]FieldSchema{"Name": {Type: "string", Length: 255}, "Site": {Type: "string", Length: 80}, "Industry": {Type: "picklist"}},
+			new:  map[string]FieldSchema{"Name": {Type: "string", Length: 255}},
+			want: ObjectDrift{Name: "Account", RemovedFields: []string{"Industry", "Site"}},
+		},
+		{
+			name: "type change",
+			old:  map[string]FieldSchema{"Phone": {Type: "string", Length: 40}},
+			new:  map[string]FieldSchema{"Phone": {Type: "phone", Length: 40}},
+			want: ObjectDrift{Name: "Account", Fields: []FieldDrift{{Name: "Phone", Changes: []Change{{ATTRIBUTE_TYPE, "string", "phone"}}}}},
+		},
+		{
+			name: "length change",
+			old:  map[string]FieldSchema{"Site": {Type: "string", Length: 80}},
+			new:  map[string]FieldSchema{"Site": {Type: "string", Length: 255}},
+			want: ObjectDrift{Name: "Account", Fields: []FieldDrift{{Name: "Site", Changes: []Change{{ATTRIBUTE_LENGTH, "80", "255"}}}}},
+		},
+		{
+			name: "precision and scale change",
+			old:  map[string]FieldSchema{"AnnualRevenue": {Type: "currency", Precision: 18, Scale: 0}},
+			new:  map[string]FieldSchema{"AnnualRevenue": {Type: "currency", Precision: 16, Scale: 2}},
+			want: ObjectDrift{Name: "Account", Fields: []FieldDrift{{Name: "AnnualRevenue", Changes: []Change{
+				{ATTRIBUTE_PRECISION, "18", "16"},
+				{ATTRIBUTE_SCALE, "0", "2"},
+			}}}},
+		},
+		{
+			name: "picklist value changes",
+			old:  map[string]FieldSchema{"Type": {Type: "picklist", Picklist: []string{"Customer", "Partner", "Prospect"}}},
+			new:  map[string]FieldSchema{"Type": {Type: "picklist", Picklist: []string{"Customer", "Prospect", "Reseller"}}},
+			want: ObjectDrift{Name: "Account", Fields: []FieldDrift{{
+				Name:                  "Type",
+				AddedPicklistValues:   []string{"Reseller"},
+				RemovedPicklistValues: []string{"Partner"},
+			}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DiffObject(object("Account", tt.old), object("Account", tt.new))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DiffObject() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
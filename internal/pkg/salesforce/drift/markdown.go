@@ -0,0 +1,65 @@
+package drift
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Markdown renders the report for reviewers
+func (r *Report) Markdown(title string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n", title)
+
+	if r.Empty() {
+		b.WriteString("\nNo schema changes.\n")
+		return b.String()
+	}
+
+	writeList(&b, "## Objects added", r.AddedObjects)
+	writeList(&b, "## Objects removed", r.RemovedObjects)
+
+	for _, od := range r.Objects {
+		fmt.Fprintf(&b, "\n## %s\n", od.Name)
+		writeList(&b, "### Fields added", od.AddedFields)
+		writeList(&b, "### Fields removed", od.RemovedFields)
+
+		if len(od.Fields) == 0 {
+			continue
+		}
+		b.WriteString("\n### Fields changed\n\n")
+		b.WriteString("| Field | Change | From | To |\n")
+		b.WriteString("| --- | --- | --- | --- |\n")
+		for _, fd := range od.Fields {
+			for _, c := range fd.Changes {
+				fmt.Fprintf(&b, "| `%s` | %s | %s | %s |\n", fd.Name, c.Attribute, c.From, c.To)
+			}
+			if len(fd.AddedPicklistValues) > 0 {
+				fmt.Fprintf(&b, "| `%s` | picklist values added | | %s |\n", fd.Name, codeList(fd.AddedPicklistValues))
+			}
+			if len(fd.RemovedPicklistValues) > 0 {
+				fmt.Fprintf(&b, "| `%s` | picklist values removed | %s | |\n", fd.Name, codeList(fd.RemovedPicklistValues))
+			}
+		}
+	}
+
+	return b.String()
+}
+
+func writeList(b *strings.Builder, heading string, items []string) {
+	if len(items) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "\n%s\n\n", heading)
+	for _, i := range items {
+		fmt.Fprintf(b, "- `%s`\n", i)
+	}
+}
+
+func codeList(values []string) string {
+	quoted := make([]string, 0, len(values))
+	for _, v := range values {
+		// pipes would split the table cell
+		quoted = append(quoted, "`"+strings.ReplaceAll(v, "|", "\\|")+"`")
+	}
+	return strings.Join(quoted, ", ")
+}
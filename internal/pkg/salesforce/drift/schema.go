@@ -0,0 +1,52 @@
+// Package drift compares snapshots of object schemas, reporting the changes between them
+package drift
+
+import (
+	"sort"
+
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/salesforce/api"
+)
+
+// ObjectSchema is the part of an object's describe that affects how its records are backed up and restored
+type ObjectSchema struct {
+	Name   string                 `json:"name"`
+	Fields map[string]FieldSchema `json:"fields"`
+}
+
+type FieldSchema struct {
+	Type      string `json:"type"`
+	Length    int    `json:"length,omitempty"`
+	Precision int    `json:"precision,omitempty"`
+	Scale     int    `json:"scale,omitempty"`
+	// Picklist are the active picklist values, sorted
+	Picklist []string `json:"picklist,omitempty"`
+}
+
+// NewObjectSchema snapshots the object's schema from its describe
+func NewObjectSchema(sobject api.SObject) ObjectSchema {
+	schema := ObjectSchema{
+		Name:   sobject.Name,
+		Fields: make(map[string]FieldSchema, len(sobject.Fields)),
+	}
+
+	for _, f := range sobject.Fields {
+		fs := FieldSchema{
+			Type:      f.Type,
+			Length:    f.Length,
+			Precision: f.Precision,
+			Scale:     f.Scale,
+		}
+		for _, p := range f.Picklistvalues {
+			if p.Active {
+				fs.Picklist = append(fs.Picklist, p.Value)
+			}
+		}
+		sort.Strings(fs.Picklist)
+		schema.Fields[f.Name] = fs
+	}
+
+	return schema
+}
+
+// Schema is a snapshot of the schemas of every object, by name
+type Schema map[string]ObjectSchema
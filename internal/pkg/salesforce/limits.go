@@ -0,0 +1,98 @@
+package salesforce
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Response header with the org's API usage, e.g. `api-usage=18/5000`
+	HEADER_LIMIT_INFO    = "Sforce-Limit-Info"
+	LIMIT_INFO_API_USAGE = "api-usage"
+
+	// Org limits, as named by the /limits resource
+	LIMIT_DAILY_API_REQUESTS       = "DailyApiRequests"
+	LIMIT_DAILY_BULK_V2_QUERY_JOBS = "DailyBulkV2QueryJobs"
+)
+
+// Limit is the allocation of one of the org's limits, and what's left of it
+type Limit struct {
+	Max       int64 `json:"Max"`
+	Remaining int64 `json:"Remaining"`
+}
+
+// Used is how much of the limit has been used
+func (l Limit) Used() int64 {
+	return l.Max - l.Remaining
+}
+
+// LimitTracker tracks the org's limits from the usage reported on every response, and polls of the /limits resource
+type LimitTracker struct {
+	mu      sync.Mutex
+	limits  map[string]Limit
+	updated map[string]time.Time
+}
+
+func NewLimitTracker() *LimitTracker {
+	return &LimitTracker{
+		limits:  make(map[string]Limit),
+		updated: make(map[string]time.Time),
+	}
+}
+
+// ObserveHeader records the API usage reported in a response's `Sforce-Limit-Info` header
+func (lt *LimitTracker) ObserveHeader(h http.Header) {
+	info := h.Get(HEADER_LIMIT_INFO)
+	if info == "" {
+		return
+	}
+
+	// e.g. `api-usage=25/5000, per-app-api-usage=17/250(appName=sample-app)`
+	for _, part := range strings.Split(info, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 || kv[0] != LIMIT_INFO_API_USAGE {
+			continue
+		}
+
+		usage := strings.SplitN(kv[1], "/", 2)
+		if len(usage) != 2 {
+			continue
+		}
+		used, err := strconv.ParseInt(usage[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		max, err := strconv.ParseInt(usage[1], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		lt.Update(map[string]Limit{
+			LIMIT_DAILY_API_REQUESTS: {Max: max, Remaining: max - used},
+		})
+	}
+}
+
+// Update records the limits, e.g. as polled from the /limits resource
+func (lt *LimitTracker) Update(limits map[string]Limit) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	now := time.Now()
+	for name, l := range limits {
+		lt.limits[name] = l
+		lt.updated[name] = now
+	}
+}
+
+// Get returns the limit as last reported, and when it was
+func (lt *LimitTracker) Get(name string) (Limit, time.Time, bool) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	l, ok := lt.limits[name]
+	return l, lt.updated[name], ok
+}
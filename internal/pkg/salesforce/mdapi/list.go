@@ -0,0 +1,66 @@
+package mdapi
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+const (
+	ACTION_LIST_METADATA = "listMetadata"
+
+	// listMetadata takes at most this many queries per call
+	MAX_LIST_QUERIES = 3
+)
+
+// ListMetadataQuery selects the components of a metadata type, in a folder for foldered types like Report
+type ListMetadataQuery struct {
+	Type   string `xml:"type"`
+	Folder string `xml:"folder,omitempty"`
+}
+
+// FileProperties describe a metadata component
+type FileProperties struct {
+	FullName           string    `xml:"fullName"`
+	Type               string    `xml:"type"`
+	FileName           string    `xml:"fileName"`
+	ID                 string    `xml:"id"`
+	NamespacePrefix    string    `xml:"namespacePrefix"`
+	ManageableState    string    `xml:"manageableState"`
+	LastModifiedDate   time.Time `xml:"lastModifiedDate"`
+	LastModifiedByName string    `xml:"lastModifiedByName"`
+}
+
+type listMetadataRequest struct {
+	XMLName     xml.Name            `xml:"http://soap.sforce.com/2006/04/metadata listMetadata"`
+	Queries     []ListMetadataQuery `xml:"queries"`
+	AsOfVersion string              `xml:"asOfVersion"`
+}
+
+type listMetadataResponse struct {
+	Results []FileProperties `xml:"result"`
+}
+
+// ListMetadata lists the components matching the queries, calling the API once per MAX_LIST_QUERIES queries
+func ListMetadata(queries []ListMetadataQuery, options ...MDAPIOption) ([]FileProperties, error) {
+	o := newOptions(options...)
+
+	results := make([]FileProperties, 0)
+	for start := 0; start < len(queries); start += MAX_LIST_QUERIES {
+		end := start + MAX_LIST_QUERIES
+		if end > len(queries) {
+			end = len(queries)
+		}
+
+		req := listMetadataRequest{
+			Queries:     queries[start:end],
+			AsOfVersion: o.version,
+		}
+		resp := listMetadataResponse{}
+		if err := doSOAPRequest(o, ACTION_LIST_METADATA, req, &resp); err != nil {
+			return nil, err
+		}
+		results = append(results, resp.Results...)
+	}
+
+	return results, nil
+}
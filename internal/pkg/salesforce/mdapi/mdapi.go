@@ -0,0 +1,189 @@
+// Package mdapi is a client for the parts of the Salesforce Metadata SOAP API used to back up org configuration
+package mdapi
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/client"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/tools"
+)
+
+const (
+	SOAP_BASE_PATH = "/services/Soap/m"
+	// API_VERSION is used with clients that haven't negotiated a version with their org
+	API_VERSION = "51.0"
+
+	NAMESPACE_SOAP     = "http://schemas.xmlsoap.org/soap/envelope/"
+	NAMESPACE_METADATA = "http://soap.sforce.com/2006/04/metadata"
+
+	HEADER_SOAP_ACTION = "SOAPAction"
+	// Marks a request as safe to retry, like the http package it's set nil so it isn't sent
+	HEADER_IDEMPOTENCY_KEY = "Idempotency-Key"
+	CONTENT_TYPE_XML       = "text/xml; charset=UTF-8"
+)
+
+// readOnlyActions only read from the org, they can be retried although every SOAP request is a POST
+var readOnlyActions = map[string]bool{
+	ACTION_LIST_METADATA:         true,
+	ACTION_CHECK_RETRIEVE_STATUS: true,
+}
+
+var ErrNoSession = errors.New("client has no session for the Metadata API")
+
+type MDAPIOption interface {
+	applyMDAPI(*MDAPIOptions)
+}
+
+type MDAPIOptions struct {
+	client  client.SessionClient
+	version string
+}
+
+func newOptions(options ...MDAPIOption) *MDAPIOptions {
+	o := &MDAPIOptions{}
+	for _, opt := range options {
+		opt.applyMDAPI(o)
+	}
+	if o.version == "" {
+		o.version = Version(o.client)
+	}
+	return o
+}
+
+// WithClient is a functional option to assign a client to a Metadata API call
+func WithClient(c client.SessionClient) MDAPIOption {
+	return withClient{c}
+}
+
+type withClient struct {
+	client client.SessionClient
+}
+
+func (wc withClient) applyMDAPI(o *MDAPIOptions) {
+	o.client = wc.client
+}
+
+// Version is the API version the client negotiated with its org, or API_VERSION
+func Version(c client.Client) string {
+	if vc, ok := c.(client.VersionedClient); ok && vc.GetAPIVersion() != "" {
+		return strings.TrimPrefix(vc.GetAPIVersion(), "v")
+	}
+	return API_VERSION
+}
+
+// WithVersion sets the API version of the call, e.g. `51.0`, instead of the client's version
+func WithVersion(v string) MDAPIOption {
+	return withVersion(v)
+}
+
+type withVersion string
+
+func (wv withVersion) applyMDAPI(o *MDAPIOptions) {
+	o.version = string(wv)
+}
+
+type envelope struct {
+	XMLName xml.Name `xml:"http://schemas.xmlsoap.org/soap/envelope/ Envelope"`
+	Header  header   `xml:"Header"`
+	Body    body     `xml:"Body"`
+}
+
+type header struct {
+	SessionHeader struct {
+		XMLName   xml.Name `xml:"http://soap.sforce.com/2006/04/metadata SessionHeader"`
+		SessionID string   `xml:"sessionId"`
+	}
+}
+
+type body struct {
+	Request interface{}
+}
+
+type responseEnvelope struct {
+	Body struct {
+		Fault *Fault `xml:"Fault"`
+		Inner []byte `xml:",innerxml"`
+	} `xml:"Body"`
+}
+
+// Fault is a SOAP fault returned by the Metadata API
+type Fault struct {
+	Code   string `xml:"faultcode"`
+	String string `xml:"faultstring"`
+}
+
+func (f Fault) Error() string {
+	return fmt.Sprintf("[Metadata API Fault] code: %s, message: %s", f.Code, f.String)
+}
+
+// doSOAPRequest calls the Metadata API, unmarshalling the body of the response into the response.
+// The request is sent again, once, if the session expired and was renewed.
+func doSOAPRequest(o *MDAPIOptions, action string, request interface{}, response interface{}) error {
+	err := sendSOAPRequest(o, action, request, response)
+	if errors.Is(err, client.ErrSessionRenewed) {
+		return sendSOAPRequest(o, action, request, response)
+	}
+	return err
+}
+
+func sendSOAPRequest(o *MDAPIOptions, action string, request interface{}, response interface{}) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("metadata API %s request failed: %v", action, e)
+		}
+	}()
+
+	if o.client == nil {
+		return ErrNoSession
+	}
+
+	env := envelope{Body: body{Request: request}}
+	env.Header.SessionHeader.SessionID = o.client.GetSessionID()
+
+	reqBody, err := xml.Marshal(env)
+	if err != nil {
+		return err
+	}
+
+	endPoint, err := tools.URLBuilder(SOAP_BASE_PATH, o.version)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, endPoint.String(), bytes.NewReader(append([]byte(xml.Header), reqBody...)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", CONTENT_TYPE_XML)
+	req.Header.Set(HEADER_SOAP_ACTION, action)
+	if readOnlyActions[action] {
+		req.Header[HEADER_IDEMPOTENCY_KEY] = nil
+	}
+
+	resp, err := o.client.DoClientRequest(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	respEnv := responseEnvelope{}
+	if err := xml.Unmarshal(respBody, &respEnv); err != nil {
+		return err
+	}
+	if respEnv.Body.Fault != nil {
+		return *respEnv.Body.Fault
+	}
+
+	return xml.Unmarshal(respEnv.Body.Inner, response)
+}
@@ -0,0 +1,213 @@
+package mdapi
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"sort"
+)
+
+const (
+	ACTION_RETRIEVE              = "retrieve"
+	ACTION_CHECK_RETRIEVE_STATUS = "checkRetrieveStatus"
+
+	// Retrieve statuses
+	STATUS_PENDING     = "Pending"
+	STATUS_IN_PROGRESS = "InProgress"
+	STATUS_SUCCEEDED   = "Succeeded"
+	STATUS_FAILED      = "Failed"
+
+	// Members wildcard, not supported by every type
+	MEMBERS_ALL = "*"
+
+	// A retrieve returns at most this many files, larger retrieves fail
+	MAX_RETRIEVE_FILES = 10000
+	// Name of the manifest in a retrieve's zip
+	PACKAGE_FILE = "package.xml"
+)
+
+// Package is a package.xml manifest of the components to retrieve
+type Package struct {
+	XMLName xml.Name      `xml:"http://soap.sforce.com/2006/04/metadata Package"`
+	Types   []PackageType `xml:"types"`
+	Version string        `xml:"version"`
+}
+
+type PackageType struct {
+	Members []string `xml:"members"`
+	Name    string   `xml:"name"`
+}
+
+// NewPackage builds a package of the listed components, grouped and sorted by type
+func NewPackage(version string, components []FileProperties) *Package {
+	members := make(map[string][]string)
+	seen := make(map[string]bool)
+	for _, c := range components {
+		key := c.Type + ":" + c.FullName
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		members[c.Type] = append(members[c.Type], c.FullName)
+	}
+
+	pkg := &Package{Version: version}
+	for name, m := range members {
+		sort.Strings(m)
+		pkg.Types = append(pkg.Types, PackageType{Members: m, Name: name})
+	}
+	sort.Slice(pkg.Types, func(i, j int) bool {
+		return pkg.Types[i].Name < pkg.Types[j].Name
+	})
+
+	return pkg
+}
+
+// NewPackages splits the listed components into packages of at most size components each, so retrieves stay under their limits.
+// Components are sorted by type, so each type is split across as few packages as possible.
+func NewPackages(version string, components []FileProperties, size int) []*Package {
+	if size <= 0 || size > MAX_RETRIEVE_FILES {
+		size = MAX_RETRIEVE_FILES
+	}
+
+	sorted := NewPackage(version, components)
+	pkgs := make([]*Package, 0)
+	pkg := &Package{Version: version}
+	n := 0
+	for _, t := range sorted.Types {
+		members := t.Members
+		for len(members) > 0 {
+			if n == size {
+				pkgs = append(pkgs, pkg)
+				pkg = &Package{Version: version}
+				n = 0
+			}
+			take := size - n
+			if take > len(members) {
+				take = len(members)
+			}
+			pkg.Types = append(pkg.Types, PackageType{Members: members[:take], Name: t.Name})
+			members = members[take:]
+			n += take
+		}
+	}
+	if n > 0 {
+		pkgs = append(pkgs, pkg)
+	}
+
+	return pkgs
+}
+
+// Size is the number of components in the package
+func (p *Package) Size() int {
+	n := 0
+	for _, t := range p.Types {
+		n += len(t.Members)
+	}
+	return n
+}
+
+// unpackaged is the package as the retrieve request's `unpackaged` element, without the Package namespace
+type unpackaged struct {
+	Types   []PackageType `xml:"types"`
+	Version string        `xml:"version"`
+}
+
+type retrieveRequest struct {
+	XMLName         xml.Name `xml:"http://soap.sforce.com/2006/04/metadata retrieve"`
+	RetrieveRequest struct {
+		APIVersion    string     `xml:"apiVersion"`
+		SinglePackage bool       `xml:"singlePackage"`
+		Unpackaged    unpackaged `xml:"unpackaged"`
+	} `xml:"retrieveRequest"`
+}
+
+// AsyncResult is the state of an asynchronous Metadata API call
+type AsyncResult struct {
+	ID    string `xml:"id"`
+	Done  bool   `xml:"done"`
+	State string `xml:"state"`
+}
+
+type retrieveResponse struct {
+	Result AsyncResult `xml:"result"`
+}
+
+// Retrieve starts retrieving the package's components, returning the ID to check its status with
+func Retrieve(pkg *Package, options ...MDAPIOption) (*AsyncResult, error) {
+	o := newOptions(options...)
+
+	req := retrieveRequest{}
+	req.RetrieveRequest.APIVersion = o.version
+	req.RetrieveRequest.SinglePackage = true
+	req.RetrieveRequest.Unpackaged = unpackaged{Types: pkg.Types, Version: pkg.Version}
+
+	resp := retrieveResponse{}
+	if err := doSOAPRequest(o, ACTION_RETRIEVE, req, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp.Result, nil
+}
+
+type checkRetrieveStatusRequest struct {
+	XMLName        xml.Name `xml:"http://soap.sforce.com/2006/04/metadata checkRetrieveStatus"`
+	AsyncProcessID string   `xml:"asyncProcessId"`
+	IncludeZip     bool     `xml:"includeZip"`
+}
+
+// RetrieveResult is the status of a retrieve, with the retrieved components zipped once it succeeds
+type RetrieveResult struct {
+	ID              string           `xml:"id"`
+	Done            bool             `xml:"done"`
+	Status          string           `xml:"status"`
+	Success         bool             `xml:"success"`
+	ErrorMessage    string           `xml:"errorMessage"`
+	ErrorStatusCode string           `xml:"errorStatusCode"`
+	FileProperties  []FileProperties `xml:"fileProperties"`
+	Messages        []struct {
+		FileName string `xml:"fileName"`
+		Problem  string `xml:"problem"`
+	} `xml:"messages"`
+	// ZipFile is base64 encoded
+	ZipFile string `xml:"zipFile"`
+}
+
+type checkRetrieveStatusResponse struct {
+	Result RetrieveResult `xml:"result"`
+}
+
+// CheckRetrieveStatus gets the status of the retrieve, including the zip of its components once it's done
+func CheckRetrieveStatus(id string, options ...MDAPIOption) (*RetrieveResult, error) {
+	o := newOptions(options...)
+
+	req := checkRetrieveStatusRequest{
+		AsyncProcessID: id,
+		IncludeZip:     true,
+	}
+	resp := checkRetrieveStatusResponse{}
+	if err := doSOAPRequest(o, ACTION_CHECK_RETRIEVE_STATUS, req, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp.Result, nil
+}
+
+// Err is the retrieve's error if it failed
+func (rr *RetrieveResult) Err() error {
+	if rr.Status != STATUS_FAILED {
+		return nil
+	}
+	return fmt.Errorf("metadata retrieve %s failed: %s %s", rr.ID, rr.ErrorStatusCode, rr.ErrorMessage)
+}
+
+// Zip opens the retrieved components
+func (rr *RetrieveResult) Zip() (*zip.Reader, error) {
+	data, err := base64.StdEncoding.DecodeString(rr.ZipFile)
+	if err != nil {
+		return nil, err
+	}
+	return zip.NewReader(bytes.NewReader(data), int64(len(data)))
+}
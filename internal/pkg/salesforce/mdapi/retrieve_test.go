@@ -0,0 +1,47 @@
+package mdapi
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewPackages(t *testing.T) {
+	components := []FileProperties{
+		{Type: "Flow", FullName: "Welcome"},
+		{Type: "CustomObject", FullName: "Account"},
+		{Type: "CustomField", FullName: "Account.Region__c"},
+		{Type: "CustomObject", FullName: "Contact"},
+		{Type: "CustomObject", FullName: "Account"},
+		{Type: "CustomField", FullName: "Account.Tier__c"},
+	}
+
+	pkgs := NewPackages("52.0", components, 2)
+	want := [][]PackageType{
+		{{Name: "CustomField", Members: []string{"Account.Region__c", "Account.Tier__c"}}},
+		{{Name: "CustomObject", Members: []string{"Account", "Contact"}}},
+		{{Name: "Flow", Members: []string{"Welcome"}}},
+	}
+	if len(pkgs) != len(want) {
+		t.Fatalf("got %d packages, want %d", len(pkgs), len(want))
+	}
+	for i, pkg := range pkgs {
+		if pkg.Version != "52.0" || !reflect.DeepEqual(pkg.Types, want[i]) {
+			t.Errorf("package %d is %+v, want %+v", i, pkg, want[i])
+		}
+	}
+
+	pkgs = NewPackages("52.0", components, 3)
+	if len(pkgs) != 2 || pkgs[0].Size() != 3 || pkgs[1].Size() != 2 {
+		t.Fatalf("unexpected split %+v", pkgs)
+	}
+	if !reflect.DeepEqual(pkgs[1].Types, []PackageType{{Name: "CustomObject", Members: []string{"Contact"}}, {Name: "Flow", Members: []string{"Welcome"}}}) {
+		t.Errorf("a type split across packages should continue in the next, got %+v", pkgs[1].Types)
+	}
+
+	if pkgs := NewPackages("52.0", components, 0); len(pkgs) != 1 || pkgs[0].Size() != 5 {
+		t.Errorf("packages should be capped at the retrieve limit, got %+v", pkgs)
+	}
+	if pkgs := NewPackages("52.0", nil, 2); len(pkgs) != 0 {
+		t.Errorf("got %d packages of no components", len(pkgs))
+	}
+}
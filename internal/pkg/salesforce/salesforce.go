@@ -1,9 +1,15 @@
 package salesforce
 
 import (
+	"bytes"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/spf13/viper"
 	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/logger"
@@ -18,19 +24,33 @@ const (
 	DEFAULT_API_VERSION = "51.0"
 
 	CONFIG_KEY = "salesforce"
+
+	// Error code of requests made with an expired session
+	ERROR_CODE_INVALID_SESSION = "INVALID_SESSION_ID"
+	// Error codes of requests that can succeed if retried later
+	ERROR_CODE_REQUEST_LIMIT_EXCEEDED = "REQUEST_LIMIT_EXCEEDED"
+	ERROR_CODE_SERVER_UNAVAILABLE     = "SERVER_UNAVAILABLE"
+
+	// Longest error body kept as a message, when it isn't a Salesforce error
+	MAX_ERROR_MESSAGE_LENGTH = 512
 )
 
 type SalesforceConfig struct {
 	URL  string                 `mapstructure:"url"`
 	Auth map[string]interface{} `mapstructure:"auth"`
+	// APIVersion pins the API version, e.g. `51.0`, instead of using the newest the org supports
+	APIVersion string `mapstructure:"api_version"`
 }
 
 type Salesforce struct {
 	URL  string                 `mapstructure:"url"`
 	Auth map[string]interface{} `mapstructure:"auth"`
 
-	accessToken client.AccessToken
-	userID      string
+	tokens     *auth.TokenSource
+	userID     string
+	apiVersion string
+	limits     *LimitTracker
+	httpClient *http.Client
 }
 
 func NewSession() (*Salesforce, error) {
@@ -38,16 +58,40 @@ func NewSession() (*Salesforce, error) {
 }
 
 func NewSessionFromConfig(key string) (*Salesforce, error) {
-	sf := &Salesforce{}
-	err := viper.UnmarshalKey(key, sf)
+	config := SalesforceConfig{}
+	err := viper.UnmarshalKey(key, &config)
 	logger.PanicCheck(err)
 
-	accessToken := auth.AttemptConnectAll(sf.URL, sf.Auth)
-	sf.accessToken = accessToken
+	return NewSessionWithConfig(config)
+}
+
+// NewSessionWithConfig authenticates a session with the org, e.g. one of several orgs in config
+func NewSessionWithConfig(config SalesforceConfig) (*Salesforce, error) {
+	sf := &Salesforce{
+		URL:    config.URL,
+		Auth:   config.Auth,
+		limits: NewLimitTracker(),
+		httpClient: &http.Client{
+			Transport: NewRetryTransport(),
+		},
+	}
+
+	tokens, err := auth.AttemptConnectAll(sf.URL, sf.Auth)
+	if err != nil {
+		return nil, err
+	}
+	sf.tokens = tokens
 
-	userID := accessToken.GetAuthID()
+	userID := tokens.Token().GetAuthID()
 	sf.userID = userID
 
+	apiVersion, err := sf.negotiateAPIVersion(config.APIVersion)
+	if err != nil {
+		return nil, err
+	}
+	sf.apiVersion = apiVersion
+	zap.S().Infow("Salesforce session connected", "instance_url", sf.instanceURL(tokens.Token()), "api_version", apiVersion)
+
 	return sf, nil
 }
 
@@ -55,66 +99,204 @@ func (s *Salesforce) GetUser() string {
 	return s.userID
 }
 
-func (s *Salesforce) DoClientRequest(req *http.Request) (resp *http.Response, err error){
+// GetSessionID is the access token without its type, as the Metadata API takes it in the SOAP session header
+func (s *Salesforce) GetSessionID() string {
+	parts := strings.SplitN(s.tokens.Token().GetAuthHeader(), " ", 2)
+	return parts[len(parts)-1]
+}
+
+// Limits tracks the org's limits, as reported on the session's responses
+func (s *Salesforce) Limits() *LimitTracker {
+	return s.limits
+}
+
+// GetAPIVersion is the API version negotiated with the org after login, e.g. `51.0`
+func (s *Salesforce) GetAPIVersion() string {
+	return s.apiVersion
+}
 
-	// Recover on Salesforce API error
-	// re-panic if error is not a SalesforceError
-	defer func ()  {
-		if e := recover(); e != nil {
-			err = e.(SalesforceError)
+// instanceURL is the instance the token was issued for, or the login URL if the token doesn't say
+func (s *Salesforce) instanceURL(token client.AccessToken) string {
+	if it, ok := token.(client.InstanceToken); ok && it.GetInstanceURL() != "" {
+		return it.GetInstanceURL()
+	}
+	return s.URL
+}
+
+// DoClientRequest sends the request to the org, retrying transient failures with the session's transport.
+// Responses with an error status are returned as a SalesforceError.
+func (s *Salesforce) DoClientRequest(req *http.Request) (*http.Response, error) {
+	// inject access token header, sending the request to the token's instance
+	token := s.tokens.Token()
+	path := req.URL.Path
+	u, err := s.requestURL(token, path, req.URL.RawQuery)
+	if err != nil {
+		return nil, err
+	}
+	req.URL = u
+	req.Header.Set("Authorization", token.GetAuthHeader())
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// renew an expired session and send the request again, once.
+	// The Metadata API reports it as a SOAP fault, with a server error
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusInternalServerError {
+		bodyBytes, err := tools.HTTPGetResponseBody(resp)
+		if err != nil {
+			return nil, err
 		}
-	}()
+		resp.Body = io.NopCloser(bytes.NewReader(bodyBytes))
 
-	// inject access token header
-	req.Header.Set("Authorization", s.accessToken.GetAuthHeader())
+		if se := NewSalesforceError(resp, bodyBytes); IsErrorCode(se, ERROR_CODE_INVALID_SESSION) {
+			token, err = s.tokens.Renew(token)
+			if err != nil {
+				return nil, err
+			}
 
-	url, err := tools.URLBuilder(s.URL, req.URL.String())
-	logger.PanicCheck(err)
+			// SOAP requests carry the session in their body, the caller has to build them again
+			if se.isSOAPFault {
+				return nil, fmt.Errorf("%w: %v", client.ErrSessionRenewed, se)
+			}
 
-	req.URL = url
+			if req.Body == nil || req.GetBody != nil {
+				if req.GetBody != nil {
+					req.Body, err = req.GetBody()
+					if err != nil {
+						return nil, err
+					}
+				}
+				req.URL, err = s.requestURL(token, path, req.URL.RawQuery)
+				if err != nil {
+					return nil, err
+				}
+				req.Header.Set("Authorization", token.GetAuthHeader())
 
-	resp, err = http.DefaultClient.Do(req)
-	logger.PanicCheck(err)
+				resp, err = s.httpClient.Do(req)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	s.limits.ObserveHeader(resp.Header)
 
 	if resp.StatusCode >= 400 {
 		bodyBytes, err := tools.HTTPGetResponseBody(resp)
-		logger.PanicCheck(err)
-		
-		sfErr := ParseSalesforceError(bodyBytes)
-		s.error(SalesforceError{
-			sfErr[0],
-			resp.Status,
-		})
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, NewSalesforceError(resp, bodyBytes)
 	}
 
 	return resp, nil
 }
 
-func (s *Salesforce) error(err SalesforceError) {
-	panic(SalesforceError(err))
+// requestURL joins the path to the token's instance URL
+func (s *Salesforce) requestURL(token client.AccessToken, path string, rawQuery string) (*url.URL, error) {
+	u, err := tools.URLBuilder(s.instanceURL(token), path)
+	if err != nil {
+		return nil, err
+	}
+
+	u.RawQuery = rawQuery
+	return u, nil
 }
 
 // Salesforce errors
 type SalesforceError struct {
 	sfError
 	HttpStatus string
+	StatusCode int
+
+	isSOAPFault bool
+}
+
+// NewSalesforceError maps an error response to a SalesforceError, using the first error in the body.
+// Bodies that aren't a Salesforce error list, e.g. a proxy's HTML error page, are kept as the message.
+func NewSalesforceError(resp *http.Response, body []byte) SalesforceError {
+	se := SalesforceError{
+		HttpStatus: resp.Status,
+		StatusCode: resp.StatusCode,
+	}
+
+	sfErr := ParseSalesforceError(body)
+	if len(sfErr) > 0 {
+		se.sfError = sfErr[0]
+		return se
+	}
+	if fault, ok := parseSOAPFault(body); ok {
+		se.sfError = fault
+		se.isSOAPFault = true
+		return se
+	}
+
+	se.Message = strings.TrimSpace(string(body))
+	if len(se.Message) > MAX_ERROR_MESSAGE_LENGTH {
+		se.Message = se.Message[:MAX_ERROR_MESSAGE_LENGTH] + "..."
+	}
+	return se
 }
 
 func (se SalesforceError) Error() string {
 	return fmt.Sprintf("[Salesforce Error] httpStatus: %v, errorCode: %v, message: %v, fields: %v", se.HttpStatus, se.ErrorCode, se.Message, se.Fields)
 }
 
+// IsErrorCode checks if the error is a SalesforceError with the error code, e.g. `INVALID_SESSION_ID`
+func IsErrorCode(err error, code string) bool {
+	var se SalesforceError
+	return errors.As(err, &se) && se.ErrorCode == code
+}
+
+// IsNotFound checks if the error is a SalesforceError for a resource that doesn't exist, e.g. a deleted Query Job
+func IsNotFound(err error) bool {
+	var se SalesforceError
+	return errors.As(err, &se) && se.StatusCode == http.StatusNotFound
+}
+
 type sfError struct {
 	Fields     []string `json:",omitempty"`
 	Message    string   `json:",omitempty"`
 	ErrorCode  string   `json:",omitempty"`
 }
 
+// parseSOAPFault parses the fault of a SOAP API error response, e.g. from the Metadata API
+func parseSOAPFault(body []byte) (sfError, bool) {
+	env := struct {
+		Fault struct {
+			Code   string `xml:"faultcode"`
+			String string `xml:"faultstring"`
+		} `xml:"Body>Fault"`
+	}{}
+	if err := xml.Unmarshal(body, &env); err != nil || env.Fault.Code == "" {
+		return sfError{}, false
+	}
+
+	// codes are namespaced, e.g. `sf:INVALID_SESSION_ID`
+	code := env.Fault.Code
+	if i := strings.LastIndex(code, ":"); i >= 0 {
+		code = code[i+1:]
+	}
+	return sfError{ErrorCode: code, Message: env.Fault.String}, true
+}
+
+// ParseSalesforceError parses the errors in an error response body, none if it isn't a Salesforce error list.
+// A single error object, as some resources respond with, is also parsed.
 func ParseSalesforceError(body []byte) []sfError {
 	zap.S().Debugw("parsing salesforce error", "body", string(body))
 	sfe := make([]sfError, 0)
-	err := json.Unmarshal(body, &sfe)
-	logger.PanicCheck(err)
+	if err := json.Unmarshal(body, &sfe); err == nil {
+		return sfe
+	}
+
+	single := sfError{}
+	if err := json.Unmarshal(body, &single); err == nil && (single.ErrorCode != "" || single.Message != "") {
+		return []sfError{single}
+	}
 
-	return sfe
+	return []sfError{}
 }
@@ -0,0 +1,117 @@
+package salesforce
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/client"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/salesforce/auth"
+)
+
+type testToken string
+
+func (t testToken) GetAuthHeader() string { return "Bearer " + string(t) }
+func (t testToken) GetAuthID() string     { return "005000000000001" }
+
+type testAuthenticator struct {
+	renewals int
+}
+
+func (a *testAuthenticator) Authenticate() (client.AccessToken, error) {
+	a.renewals++
+	return testToken("renewed"), nil
+}
+
+// newTestSession is a session with an expired token, against the handler
+func newTestSession(t *testing.T, handler http.HandlerFunc) (*Salesforce, *testAuthenticator) {
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	a := &testAuthenticator{}
+	return &Salesforce{
+		URL:        srv.URL,
+		tokens:     auth.NewTokenSource(a, testToken("expired")),
+		limits:     NewLimitTracker(),
+		httpClient: srv.Client(),
+	}, a
+}
+
+func TestDoClientRequestRenewsSession(t *testing.T) {
+	s, a := newTestSession(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer renewed" {
+			w.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(w, `[{"message":"Session expired or invalid","errorCode":"INVALID_SESSION_ID"}]`)
+			return
+		}
+		io.WriteString(w, `{}`)
+	})
+
+	req, err := http.NewRequest(http.MethodPost, "/services/data/v52.0/jobs/query", strings.NewReader(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := s.DoClientRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if a.renewals != 1 {
+		t.Errorf("renewed %d times, want 1", a.renewals)
+	}
+}
+
+func TestDoClientRequestRenewsSOAPSession(t *testing.T) {
+	s, a := newTestSession(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !strings.Contains(string(body), "<sessionId>renewed</sessionId>") {
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, `<?xml version="1.0" encoding="UTF-8"?><soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns:sf="http://soap.sforce.com/2006/04/metadata"><soapenv:Body><soapenv:Fault><faultcode>sf:INVALID_SESSION_ID</faultcode><faultstring>INVALID_SESSION_ID: Invalid Session ID found in SessionHeader</faultstring></soapenv:Fault></soapenv:Body></soapenv:Envelope>`)
+			return
+		}
+		io.WriteString(w, `<Envelope><Body/></Envelope>`)
+	})
+
+	soap := func() (*http.Response, error) {
+		req, err := http.NewRequest(http.MethodPost, "/services/Soap/m/52.0", strings.NewReader("<sessionId>"+s.GetSessionID()+"</sessionId>"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s.DoClientRequest(req)
+	}
+
+	// the session is in the body, so the caller has to send the request again
+	if _, err := soap(); !errors.Is(err, client.ErrSessionRenewed) {
+		t.Fatalf("got %v, want %v", err, client.ErrSessionRenewed)
+	}
+	if a.renewals != 1 {
+		t.Errorf("renewed %d times, want 1", a.renewals)
+	}
+
+	resp, err := soap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+}
+
+func TestDoClientRequestServerError(t *testing.T) {
+	s, a := newTestSession(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `[{"message":"unexpected error","errorCode":"UNKNOWN_EXCEPTION"}]`)
+	})
+
+	req, err := http.NewRequest(http.MethodGet, "/services/data/v52.0/limits", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.DoClientRequest(req); !IsErrorCode(err, "UNKNOWN_EXCEPTION") {
+		t.Errorf("got %v, want the server error", err)
+	}
+	if a.renewals != 0 {
+		t.Errorf("renewed %d times on a server error", a.renewals)
+	}
+}
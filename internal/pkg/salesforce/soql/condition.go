@@ -0,0 +1,144 @@
+package soql
+
+import (
+	"strings"
+)
+
+// Operator compares a field to a value in a WHERE clause
+type Operator string
+
+const (
+	EQ     Operator = "="
+	NE     Operator = "!="
+	LT     Operator = "<"
+	LE     Operator = "<="
+	GT     Operator = ">"
+	GE     Operator = ">="
+	LIKE   Operator = "LIKE"
+	IN     Operator = "IN"
+	NOT_IN Operator = "NOT IN"
+
+	LOGICAL_AND = "AND"
+	LOGICAL_OR  = "OR"
+)
+
+// Condition is a filter in a WHERE clause.
+// Conditions are combined with And and Or, which are grouped in parentheses when nested.
+type Condition interface {
+	String() string
+}
+
+// Comparison compares a field to a value, the value is written as a SOQL literal
+type Comparison struct {
+	Field    string
+	Operator Operator
+	Value    interface{}
+}
+
+func (c Comparison) String() string {
+	return c.Field + " " + string(c.Operator) + " " + Literal(c.Value)
+}
+
+// InList checks if a field is, or isn't, one of the values
+type InList struct {
+	Field  string
+	Not    bool
+	Values []interface{}
+}
+
+func (il InList) String() string {
+	values := make([]string, 0, len(il.Values))
+	for _, v := range il.Values {
+		values = append(values, Literal(v))
+	}
+
+	op := IN
+	if il.Not {
+		op = NOT_IN
+	}
+	return il.Field + " " + string(op) + " (" + strings.Join(values, ",") + ")"
+}
+
+// Group joins conditions with AND or OR. Nil and empty conditions are left out.
+type Group struct {
+	Operator   string
+	Conditions []Condition
+}
+
+func (g Group) String() string {
+	parts := make([]string, 0, len(g.Conditions))
+	for _, c := range g.Conditions {
+		if c == nil {
+			continue
+		}
+		s := c.String()
+		if s == "" {
+			continue
+		}
+		// nested groups are parenthesized, so AND and OR never depend on precedence
+		if ng, ok := c.(Group); ok && ng.len() > 1 {
+			s = "(" + s + ")"
+		}
+		parts = append(parts, s)
+	}
+
+	return strings.Join(parts, " "+g.Operator+" ")
+}
+
+// len is the number of conditions the group renders
+func (g Group) len() int {
+	n := 0
+	for _, c := range g.Conditions {
+		if c != nil && c.String() != "" {
+			n++
+		}
+	}
+	return n
+}
+
+func Eq(field string, value interface{}) Condition {
+	return Comparison{field, EQ, value}
+}
+
+func Ne(field string, value interface{}) Condition {
+	return Comparison{field, NE, value}
+}
+
+func Lt(field string, value interface{}) Condition {
+	return Comparison{field, LT, value}
+}
+
+func Le(field string, value interface{}) Condition {
+	return Comparison{field, LE, value}
+}
+
+func Gt(field string, value interface{}) Condition {
+	return Comparison{field, GT, value}
+}
+
+func Ge(field string, value interface{}) Condition {
+	return Comparison{field, GE, value}
+}
+
+// Like matches a field to a pattern, `%` matches any characters and `_` a single character
+func Like(field string, pattern string) Condition {
+	return Comparison{field, LIKE, pattern}
+}
+
+func In(field string, values ...interface{}) Condition {
+	return InList{Field: field, Values: values}
+}
+
+func NotIn(field string, values ...interface{}) Condition {
+	return InList{Field: field, Not: true, Values: values}
+}
+
+// And matches records matching every condition
+func And(conditions ...Condition) Condition {
+	return Group{LOGICAL_AND, conditions}
+}
+
+// Or matches records matching any condition
+func Or(conditions ...Condition) Condition {
+	return Group{LOGICAL_OR, conditions}
+}
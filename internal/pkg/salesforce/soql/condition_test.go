@@ -0,0 +1,43 @@
+package soql
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCondition(t *testing.T) {
+	tests := []struct {
+		name      string
+		condition Condition
+		want      string
+	}{
+		{"eq", Eq("Name", "Acme"), `Name = 'Acme'`},
+		{"ne null", Ne("ParentId", nil), `ParentId != null`},
+		{"lt", Lt("Id", "001000000000002"), `Id < '001000000000002'`},
+		{"le", Le("NumberOfEmployees", 10), `NumberOfEmployees <= 10`},
+		{"gt datetime", Gt("SystemModstamp", time.Date(2021, 10, 15, 0, 0, 0, 0, time.UTC)), `SystemModstamp > 2021-10-15T00:00:00Z`},
+		{"ge date literal", Ge("CreatedDate", LastNDays(7)), `CreatedDate >= LAST_N_DAYS:7`},
+		{"like", Like("Name", "Ac%"), `Name LIKE 'Ac%'`},
+		{"in", In("Type", "Customer", "Partner"), `Type IN ('Customer','Partner')`},
+		{"in escapes", In("Name", "O'Brien"), `Name IN ('O\'Brien')`},
+		{"in mixed", In("Rating", 1, nil, true), `Rating IN (1,null,true)`},
+		{"not in", NotIn("Id", "001A", "001B"), `Id NOT IN ('001A','001B')`},
+		{"and", And(Eq("A", 1), Eq("B", 2)), `A = 1 AND B = 2`},
+		{"or", Or(Eq("A", 1), Eq("B", 2)), `A = 1 OR B = 2`},
+		{"or in and", And(Eq("A", 1), Or(Eq("B", 2), Eq("C", 3))), `A = 1 AND (B = 2 OR C = 3)`},
+		{"and in or", Or(And(Eq("A", 1), Eq("B", 2)), Eq("C", 3)), `(A = 1 AND B = 2) OR C = 3`},
+		{"nested both ways", And(Or(Eq("A", 1), Eq("B", 2)), Or(Eq("C", 3), And(Eq("D", 4), Eq("E", 5)))), `(A = 1 OR B = 2) AND (C = 3 OR (D = 4 AND E = 5))`},
+		{"single nested group isn't parenthesized", And(Eq("A", 1), Or(Eq("B", 2))), `A = 1 AND B = 2`},
+		{"nil conditions are left out", And(nil, Eq("A", 1), nil, Eq("B", 2)), `A = 1 AND B = 2`},
+		{"empty groups are left out", And(Or(), Eq("A", 1), And(nil)), `A = 1`},
+		{"empty", And(), ``},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.condition.String(); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package soql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// SOQL dateTime literals are unquoted, and written here in UTC. SOQL doesn't accept fractional seconds.
+	DATETIME_FORMAT = "2006-01-02T15:04:05Z"
+	// SOQL date literals are unquoted
+	DATE_FORMAT = "2006-01-02"
+)
+
+// Date is a date field value, written without a time
+type Date time.Time
+
+// DateLiteral is a relative date, like TODAY or LAST_N_DAYS:30, written as-is
+type DateLiteral string
+
+const (
+	TODAY      DateLiteral = "TODAY"
+	YESTERDAY  DateLiteral = "YESTERDAY"
+	LAST_WEEK  DateLiteral = "LAST_WEEK"
+	THIS_WEEK  DateLiteral = "THIS_WEEK"
+	LAST_MONTH DateLiteral = "LAST_MONTH"
+	THIS_MONTH DateLiteral = "THIS_MONTH"
+)
+
+// LastNDays is the relative date literal for the last n days, including today
+func LastNDays(n int) DateLiteral {
+	return DateLiteral("LAST_N_DAYS:" + strconv.Itoa(n))
+}
+
+// string literal escapes, https://developer.salesforce.com/docs/atlas.en-us.soql_sosl.meta/soql_sosl/sforce_api_calls_soql_select_quotedstringescapes.htm
+var stringEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	`'`, `\'`,
+	`"`, `\"`,
+	"\n", `\n`,
+	"\r", `\r`,
+	"\t", `\t`,
+	"\b", `\b`,
+	"\f", `\f`,
+)
+
+// Literal writes a Go value as a SOQL literal. Strings are quoted and escaped,
+// times are dateTimes in UTC, and nil is null.
+func Literal(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "'" + stringEscaper.Replace(val) + "'"
+	case bool:
+		return strconv.FormatBool(val)
+	case int:
+		return strconv.Itoa(val)
+	case int64:
+		return strconv.FormatInt(val, 10)
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case time.Time:
+		return val.UTC().Format(DATETIME_FORMAT)
+	case Date:
+		return time.Time(val).Format(DATE_FORMAT)
+	case DateLiteral:
+		return string(val)
+	case fmt.Stringer:
+		return Literal(val.String())
+	default:
+		return Literal(fmt.Sprint(val))
+	}
+}
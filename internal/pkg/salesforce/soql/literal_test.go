@@ -0,0 +1,56 @@
+package soql
+
+import (
+	"testing"
+	"time"
+)
+
+type stringer string
+
+func (s stringer) String() string {
+	return string(s)
+}
+
+func TestLiteral(t *testing.T) {
+	est := time.FixedZone("EST", -5*60*60)
+
+	tests := []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		{"nil", nil, `null`},
+		{"string", "Acme", `'Acme'`},
+		{"empty string", "", `''`},
+		{"single quote", "O'Brien", `'O\'Brien'`},
+		{"double quote", `say "hi"`, `'say \"hi\"'`},
+		{"backslash", `C:\temp`, `'C:\\temp'`},
+		{"backslash before quote", `\'`, `'\\\''`},
+		{"whitespace escapes", "a\nb\rc\td", `'a\nb\rc\td'`},
+		{"control escapes", "a\bb\fc", `'a\bb\fc'`},
+		{"injection", "x' OR Name != '", `'x\' OR Name != \''`},
+		{"like wildcards are left", "Acme%_", `'Acme%_'`},
+		{"true", true, `true`},
+		{"false", false, `false`},
+		{"int", 42, `42`},
+		{"negative int64", int64(-7), `-7`},
+		{"float", 1.5, `1.5`},
+		{"whole float", float64(3), `3`},
+		{"datetime utc", time.Date(2021, 10, 15, 20, 4, 5, 0, time.UTC), `2021-10-15T20:04:05Z`},
+		{"datetime converted to utc", time.Date(2021, 10, 15, 20, 4, 5, 0, est), `2021-10-16T01:04:05Z`},
+		{"datetime drops fractional seconds", time.Date(2021, 10, 15, 20, 4, 5, 999000000, time.UTC), `2021-10-15T20:04:05Z`},
+		{"date", Date(time.Date(2021, 1, 2, 23, 59, 0, 0, time.UTC)), `2021-01-02`},
+		{"date literal", TODAY, `TODAY`},
+		{"last n days", LastNDays(30), `LAST_N_DAYS:30`},
+		{"stringer is quoted", stringer("it's"), `'it\'s'`},
+		{"other types are quoted", []int{1}, `'[1]'`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Literal(tt.value); got != tt.want {
+				t.Errorf("Literal(%#v) = %s, want %s", tt.value, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package soql
+
+import (
+	"strconv"
+	"strings"
+)
+
+const (
+	ORDER_ASC  = "ASC"
+	ORDER_DESC = "DESC"
+)
+
+// Query is a SOQL SELECT statement
+type Query struct {
+	Fields  []string
+	From    string
+	Where   Condition
+	OrderBy []Order
+	// Limit is the max number of records returned, no limit when 0
+	Limit int
+}
+
+// String renders the query, e.g. `SELECT Id,Name FROM Account WHERE Name = 'Acme' ORDER BY Id ASC LIMIT 10`
+func (q Query) String() string {
+	s := []string{
+		"SELECT",
+		strings.Join(q.Fields, ","),
+		"FROM",
+		q.From,
+	}
+
+	if q.Where != nil {
+		if where := q.Where.String(); where != "" {
+			s = append(s, "WHERE", where)
+		}
+	}
+
+	if len(q.OrderBy) > 0 {
+		orders := make([]string, 0, len(q.OrderBy))
+		for _, o := range q.OrderBy {
+			orders = append(orders, o.String())
+		}
+		s = append(s, "ORDER BY", strings.Join(orders, ","))
+	}
+
+	if q.Limit > 0 {
+		s = append(s, "LIMIT", strconv.Itoa(q.Limit))
+	}
+
+	return strings.Join(s, " ")
+}
+
+// Order sorts records by a field
+type Order struct {
+	Field string
+	Desc  bool
+	// NullsLast sorts records with an empty field last, SOQL sorts them first by default
+	NullsLast bool
+}
+
+func (o Order) String() string {
+	s := o.Field + " " + ORDER_ASC
+	if o.Desc {
+		s = o.Field + " " + ORDER_DESC
+	}
+	if o.NullsLast {
+		s += " NULLS LAST"
+	}
+	return s
+}
+
+// Asc sorts records by the field, smallest first
+func Asc(field string) Order {
+	return Order{Field: field}
+}
+
+// Desc sorts records by the field, largest first
+func Desc(field string) Order {
+	return Order{Field: field, Desc: true}
+}
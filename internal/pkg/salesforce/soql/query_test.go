@@ -0,0 +1,68 @@
+package soql
+
+import (
+	"testing"
+)
+
+func TestQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		query Query
+		want  string
+	}{
+		{
+			name:  "select",
+			query: Query{Fields: []string{"Id", "Name"}, From: "Account"},
+			want:  `SELECT Id,Name FROM Account`,
+		},
+		{
+			name:  "where",
+			query: Query{Fields: []string{"Id"}, From: "Account", Where: Eq("Name", "Acme")},
+			want:  `SELECT Id FROM Account WHERE Name = 'Acme'`,
+		},
+		{
+			name:  "empty where is left out",
+			query: Query{Fields: []string{"Id"}, From: "Account", Where: And()},
+			want:  `SELECT Id FROM Account`,
+		},
+		{
+			name:  "order by",
+			query: Query{Fields: []string{"Id"}, From: "Account", OrderBy: []Order{Asc("Name"), Desc("CreatedDate")}},
+			want:  `SELECT Id FROM Account ORDER BY Name ASC,CreatedDate DESC`,
+		},
+		{
+			name:  "order by nulls last",
+			query: Query{Fields: []string{"Id"}, From: "Account", OrderBy: []Order{{Field: "ParentId", Desc: true, NullsLast: true}}},
+			want:  `SELECT Id FROM Account ORDER BY ParentId DESC NULLS LAST`,
+		},
+		{
+			name:  "limit",
+			query: Query{Fields: []string{"Id"}, From: "Account", Limit: 10},
+			want:  `SELECT Id FROM Account LIMIT 10`,
+		},
+		{
+			name:  "no limit",
+			query: Query{Fields: []string{"Id"}, From: "Account", Limit: 0},
+			want:  `SELECT Id FROM Account`,
+		},
+		{
+			name: "every clause",
+			query: Query{
+				Fields:  []string{"Id", "Name"},
+				From:    "Account",
+				Where:   And(Eq("Type", "Customer"), Or(Gt("NumberOfEmployees", 100), In("Rating", "Hot", "Warm"))),
+				OrderBy: []Order{Asc("Id")},
+				Limit:   200,
+			},
+			want: `SELECT Id,Name FROM Account WHERE Type = 'Customer' AND (NumberOfEmployees > 100 OR Rating IN ('Hot','Warm')) ORDER BY Id ASC LIMIT 200`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.query.String(); got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
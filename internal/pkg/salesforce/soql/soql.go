@@ -1,80 +1,168 @@
 package soql
 
 import (
-	"strings"
 	"time"
 
 	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/salesforce/api"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/tools"
 )
 
 type SoqlOption func(o *SoqlOptions) error
 
 type SoqlOptions struct {
-	Fields string
-	From   string
-	Where  []string
+	Fields  []string
+	From    string
+	Where   []Condition
+	OrderBy []Order
+	Limit   int
 }
 
 const (
-	SOQL_FIELD_LAST_MODIFIED = "LastModifiedDate"
-	TIME_FORMAT              = time.RFC1123Z
+	SOQL_FIELD_LAST_MODIFIED   = "LastModifiedDate"
+	SOQL_FIELD_ID              = "Id"
+	SOQL_FIELD_SYSTEM_MODSTAMP = "SystemModstamp"
+	SOQL_FIELD_IS_DELETED      = "IsDeleted"
+
+	// Field types the Bulk API can't query
+	FIELD_TYPE_BASE64   = "base64"
+	FIELD_TYPE_ADDRESS  = "address"
+	FIELD_TYPE_LOCATION = "location"
 )
 
+var nonBulkQueryableTypes = []string{
+	FIELD_TYPE_BASE64,
+	FIELD_TYPE_ADDRESS,
+	FIELD_TYPE_LOCATION,
+}
+
+// SelectFrom builds a query of the object's records, selecting every Bulk API queryable field unless WithFields is given.
+// Where options are joined with AND.
 func SelectFrom(sobj api.SObject, options ...SoqlOption) string {
 	o := &SoqlOptions{
 		From:  sobj.Name,
-		Where: make([]string, 0),
+		Where: make([]Condition, 0),
 	}
 
 	for _, opt := range options {
 		opt(o)
 	}
 
-	if o.Fields == "" {
+	if len(o.Fields) == 0 {
 		o.Fields = getAllFields(sobj)
 	}
 
-	s := []string{
-		"SELECT",
-		o.Fields,
-		"FROM",
-		sobj.Name,
+	q := Query{
+		Fields:  o.Fields,
+		From:    o.From,
+		OrderBy: o.OrderBy,
+		Limit:   o.Limit,
 	}
-
 	if len(o.Where) > 0 {
-		where := strings.Join(o.Where, ",")
-		s = append(s, where)
+		q.Where = And(o.Where...)
 	}
 
-	return strings.Join(s, " ")
+	return q.String()
 }
 
 func WithFields(fields ...string) SoqlOption {
 	return func(o *SoqlOptions) error {
 		if len(fields) > 0 {
-			o.Fields = strings.Join(fields, ",")
+			o.Fields = fields
 		}
 		return nil
 	}
 }
 
-func getAllFields(sobj api.SObject) string {
+func getAllFields(sobj api.SObject) []string {
 
 	fields := make([]string, 0)
 
-	for _, field := range sobj.Fields {
+	for _, field := range BulkQueryableFields(sobj) {
 		fields = append(fields, field.Name)
 	}
 
-	return strings.Join(fields, ",")
+	return fields
+}
+
+// BulkQueryableFields are the object's fields the Bulk API can query.
+// Compound fields, like addresses, are left out in favour of their component fields, as are base64 fields.
+func BulkQueryableFields(sobj api.SObject) []api.SObjectFields {
+	compound := make(map[string]bool)
+	for _, field := range sobj.Fields {
+		if field.Compoundfieldname != "" {
+			compound[field.Compoundfieldname] = true
+		}
+	}
+
+	fields := make([]api.SObjectFields, 0, len(sobj.Fields))
+	for _, field := range sobj.Fields {
+		if compound[field.Name] || tools.StringSliceContaines(nonBulkQueryableTypes, field.Type) {
+			continue
+		}
+		fields = append(fields, field)
+	}
+
+	return fields
+}
+
+// Where limits records to those matching every condition
+func Where(conditions ...Condition) SoqlOption {
+	return func(o *SoqlOptions) error {
+		o.Where = append(o.Where, conditions...)
+		return nil
+	}
+}
+
+func OrderBy(orders ...Order) SoqlOption {
+	return func(o *SoqlOptions) error {
+		o.OrderBy = append(o.OrderBy, orders...)
+		return nil
+	}
+}
+
+func Limit(n int) SoqlOption {
+	return func(o *SoqlOptions) error {
+		o.Limit = n
+		return nil
+	}
 }
 
 func WhereLastModifiedAfter(t time.Time) SoqlOption {
 	return func(o *SoqlOptions) error {
 		if !t.IsZero() {
-			lm := SOQL_FIELD_LAST_MODIFIED + " >= " + t.Format(TIME_FORMAT)
-			o.Where = append(o.Where, lm)
+			o.Where = append(o.Where, Ge(SOQL_FIELD_LAST_MODIFIED, t))
+		}
+		return nil
+	}
+}
+
+// WhereIdRange limits records to Ids from start, up to but not including end. An empty end leaves the range open.
+func WhereIdRange(start string, end string) SoqlOption {
+	return func(o *SoqlOptions) error {
+		if start != "" {
+			o.Where = append(o.Where, Ge(SOQL_FIELD_ID, start))
+		}
+		if end != "" {
+			o.Where = append(o.Where, Lt(SOQL_FIELD_ID, end))
+		}
+		return nil
+	}
+}
+
+// WhereAfter limits records to those with the datetime field strictly after t
+func WhereAfter(field string, t time.Time) SoqlOption {
+	return func(o *SoqlOptions) error {
+		if !t.IsZero() {
+			o.Where = append(o.Where, Gt(field, t))
 		}
 		return nil
 	}
 }
+
+// WhereDeleted limits records to those in the recycle bin, or permanently deleted. Only a queryAll includes them.
+func WhereDeleted() SoqlOption {
+	return func(o *SoqlOptions) error {
+		o.Where = append(o.Where, Eq(SOQL_FIELD_IS_DELETED, true))
+		return nil
+	}
+}
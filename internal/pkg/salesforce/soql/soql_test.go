@@ -0,0 +1,93 @@
+package soql
+
+import (
+	"testing"
+	"time"
+
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/salesforce/api"
+)
+
+func TestSelectFrom(t *testing.T) {
+	account := api.SObject{
+		Name: "Account",
+		Fields: []api.SObjectFields{
+			{Name: "Id", Type: "id"},
+			{Name: "Name", Type: "string"},
+			{Name: "BillingAddress", Type: "address"},
+			{Name: "BillingStreet", Type: "textarea", Compoundfieldname: "BillingAddress"},
+			{Name: "BillingCity", Type: "string", Compoundfieldname: "BillingAddress"},
+			{Name: "Logo__c", Type: "base64"},
+			{Name: "SystemModstamp", Type: "datetime"},
+		},
+	}
+	watermark := time.Date(2021, 10, 15, 20, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		options []SoqlOption
+		want    string
+	}{
+		{
+			name: "bulk queryable fields",
+			want: `SELECT Id,Name,BillingStreet,BillingCity,SystemModstamp FROM Account`,
+		},
+		{
+			name:    "with fields",
+			options: []SoqlOption{WithFields("Id", "Name")},
+			want:    `SELECT Id,Name FROM Account`,
+		},
+		{
+			name:    "id range",
+			options: []SoqlOption{WithFields("Id"), WhereIdRange("001000000000000AAA", "001000000000100AAA")},
+			want:    `SELECT Id FROM Account WHERE Id >= '001000000000000AAA' AND Id < '001000000000100AAA'`,
+		},
+		{
+			name:    "open ended id range",
+			options: []SoqlOption{WithFields("Id"), WhereIdRange("001000000000100AAA", "")},
+			want:    `SELECT Id FROM Account WHERE Id >= '001000000000100AAA'`,
+		},
+		{
+			name:    "after watermark",
+			options: []SoqlOption{WithFields("Id"), WhereAfter("SystemModstamp", watermark)},
+			want:    `SELECT Id FROM Account WHERE SystemModstamp > 2021-10-15T20:04:05Z`,
+		},
+		{
+			name:    "no watermark",
+			options: []SoqlOption{WithFields("Id"), WhereAfter("SystemModstamp", time.Time{})},
+			want:    `SELECT Id FROM Account`,
+		},
+		{
+			name:    "id range after watermark",
+			options: []SoqlOption{WithFields("Id"), WhereAfter("SystemModstamp", watermark), WhereIdRange("001A", "001B")},
+			want:    `SELECT Id FROM Account WHERE SystemModstamp > 2021-10-15T20:04:05Z AND Id >= '001A' AND Id < '001B'`,
+		},
+		{
+			name:    "last modified after",
+			options: []SoqlOption{WithFields("Id"), WhereLastModifiedAfter(watermark)},
+			want:    `SELECT Id FROM Account WHERE LastModifiedDate >= 2021-10-15T20:04:05Z`,
+		},
+		{
+			name:    "tombstones",
+			options: []SoqlOption{WithFields("Id", "IsDeleted", "SystemModstamp"), WhereDeleted(), WhereAfter("SystemModstamp", watermark)},
+			want:    `SELECT Id,IsDeleted,SystemModstamp FROM Account WHERE IsDeleted = true AND SystemModstamp > 2021-10-15T20:04:05Z`,
+		},
+		{
+			name:    "or where",
+			options: []SoqlOption{WithFields("Id"), Where(Or(Eq("Type", "Customer"), Eq("Type", "Partner"))), WhereIdRange("001A", "")},
+			want:    `SELECT Id FROM Account WHERE (Type = 'Customer' OR Type = 'Partner') AND Id >= '001A'`,
+		},
+		{
+			name:    "order by and limit",
+			options: []SoqlOption{WithFields("Id"), OrderBy(Asc("Id")), Limit(1)},
+			want:    `SELECT Id FROM Account ORDER BY Id ASC LIMIT 1`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SelectFrom(account, tt.options...); got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package salesforce
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/spf13/viper"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/tools"
+	"go.uber.org/zap"
+)
+
+const (
+	TRANSPORT_MAX_ATTEMPTS     = 5
+	TRANSPORT_MIN_BACKOFF      = "1s"
+	TRANSPORT_MAX_BACKOFF      = "1m"
+	TRANSPORT_CONNECT_TIMEOUT  = "30s"
+	TRANSPORT_RESPONSE_TIMEOUT = "5m"
+
+	CONFIG_KEY_TRANSPORT_MAX_ATTEMPTS = "salesforce.transport.max_attempts"
+	CONFIG_KEY_TRANSPORT_MIN_BACKOFF  = "salesforce.transport.min_backoff"
+	// Longest wait between attempts, including waits asked for by a Retry-After header
+	CONFIG_KEY_TRANSPORT_MAX_BACKOFF = "salesforce.transport.max_backoff"
+	// Time to connect to Salesforce, including the TLS handshake
+	CONFIG_KEY_TRANSPORT_CONNECT_TIMEOUT = "salesforce.transport.connect_timeout"
+	// Time to wait for a response's headers once the request is sent, bodies like query results can take longer to read
+	CONFIG_KEY_TRANSPORT_RESPONSE_TIMEOUT = "salesforce.transport.response_timeout"
+
+	HEADER_RETRY_AFTER = "Retry-After"
+	// Marks requests that can be retried whatever their method, see isIdempotent
+	HEADER_IDEMPOTENCY_KEY = "Idempotency-Key"
+
+	// Error bodies are read to check their error code, up to this size
+	MAX_RETRY_BODY_SIZE = 64 * 1024
+)
+
+func init() {
+	viper.SetDefault(CONFIG_KEY_TRANSPORT_MAX_ATTEMPTS, TRANSPORT_MAX_ATTEMPTS)
+	viper.SetDefault(CONFIG_KEY_TRANSPORT_MIN_BACKOFF, TRANSPORT_MIN_BACKOFF)
+	viper.SetDefault(CONFIG_KEY_TRANSPORT_MAX_BACKOFF, TRANSPORT_MAX_BACKOFF)
+	viper.SetDefault(CONFIG_KEY_TRANSPORT_CONNECT_TIMEOUT, TRANSPORT_CONNECT_TIMEOUT)
+	viper.SetDefault(CONFIG_KEY_TRANSPORT_RESPONSE_TIMEOUT, TRANSPORT_RESPONSE_TIMEOUT)
+}
+
+// RetryTransport retries requests that failed transiently: connection resets and timeouts, 5xx responses,
+// and REQUEST_LIMIT_EXCEEDED or SERVER_UNAVAILABLE errors. It backs off exponentially with jitter,
+// or for as long as the response's Retry-After asks.
+// Requests with a body are only retried if it can be rewound with GetBody.
+// Requests that aren't idempotent, like creating a Query Job, are only retried if Salesforce didn't process them:
+// the connection was refused, or the request was rejected by the org's request limit.
+type RetryTransport struct {
+	Base http.RoundTripper
+
+	maxAttempts int
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+}
+
+// NewRetryTransport creates a transport with the timeouts and retries set in config
+func NewRetryTransport() *RetryTransport {
+	t := &RetryTransport{}
+	t.UpdateSettings()
+	return t
+}
+
+func (t *RetryTransport) UpdateSettings() {
+	t.maxAttempts = viper.GetInt(CONFIG_KEY_TRANSPORT_MAX_ATTEMPTS)
+	t.minBackoff = durationSetting(CONFIG_KEY_TRANSPORT_MIN_BACKOFF, TRANSPORT_MIN_BACKOFF)
+	t.maxBackoff = durationSetting(CONFIG_KEY_TRANSPORT_MAX_BACKOFF, TRANSPORT_MAX_BACKOFF)
+
+	connectTimeout := durationSetting(CONFIG_KEY_TRANSPORT_CONNECT_TIMEOUT, TRANSPORT_CONNECT_TIMEOUT)
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	base.DialContext = (&net.Dialer{
+		Timeout:   connectTimeout,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	base.TLSHandshakeTimeout = connectTimeout
+	base.ResponseHeaderTimeout = durationSetting(CONFIG_KEY_TRANSPORT_RESPONSE_TIMEOUT, TRANSPORT_RESPONSE_TIMEOUT)
+	t.Base = base
+}
+
+func durationSetting(key string, fallback string) time.Duration {
+	d, err := tools.ParseDuration(viper.GetString(key))
+	if err != nil {
+		zap.S().Errorf("unable to parse `%s` in Salesforce config", key)
+		d, _ = tools.ParseDuration(fallback)
+	}
+	return d
+}
+
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rewindable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	idempotent := isIdempotent(req)
+
+	for attempt := 1; ; attempt++ {
+		r := req
+		if attempt > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r = req.Clone(req.Context())
+			r.Body = body
+		}
+
+		resp, err := t.Base.RoundTrip(r)
+		retry, wait, reason := t.shouldRetry(resp, err, attempt, idempotent)
+		if !retry || !rewindable || attempt >= t.maxAttempts {
+			return resp, err
+		}
+		// give up now rather than wait past the request's deadline
+		if deadline, ok := req.Context().Deadline(); ok && time.Until(deadline) < wait {
+			zap.S().Warnw("not retrying Salesforce request, its deadline is before the retry", "method", req.Method, "path", req.URL.Path, "attempt", attempt, "wait", wait, "reason", reason)
+			return resp, err
+		}
+
+		if resp != nil {
+			resp.Body.Close()
+		}
+		zap.S().Warnw("retrying Salesforce request", "method", req.Method, "path", req.URL.Path, "attempt", attempt, "wait", wait, "reason", reason)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// isIdempotent checks if the request can be sent again safely, by its method or,
+// like the http package, by an `Idempotency-Key` header. A nil header marks the request without sending it
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	_, ok := req.Header[HEADER_IDEMPOTENCY_KEY]
+	return ok
+}
+
+// shouldRetry checks if the request failed transiently, returning how long to wait before retrying and why.
+// Requests that aren't idempotent are only retried if they weren't processed.
+func (t *RetryTransport) shouldRetry(resp *http.Response, err error, attempt int, idempotent bool) (bool, time.Duration, string) {
+	if err != nil {
+		if isTransientError(err) && (idempotent || isNotSent(err)) {
+			return true, t.backoff(attempt), err.Error()
+		}
+		return false, 0, ""
+	}
+
+	if resp.StatusCode < http.StatusInternalServerError && resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusForbidden {
+		return false, 0, ""
+	}
+	// a request that isn't idempotent could have been processed before the server error
+	if !idempotent && resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusForbidden {
+		return false, 0, ""
+	}
+
+	reason := resp.Status
+	se, ok := peekError(resp).(SalesforceError)
+	if ok && se.ErrorCode != "" {
+		reason = se.ErrorCode
+	}
+	// the org's request limit is reported as forbidden, like other forbidden requests that won't succeed if retried
+	if resp.StatusCode == http.StatusForbidden && (!ok || se.ErrorCode != ERROR_CODE_REQUEST_LIMIT_EXCEEDED) {
+		return false, 0, ""
+	}
+	// SOAP APIs respond to every fault with a server error, even invalid requests
+	if ok && se.isSOAPFault && !isRetryableCode(se.ErrorCode) {
+		return false, 0, ""
+	}
+
+	if wait, ok := retryAfter(resp); ok {
+		if wait > t.maxBackoff {
+			wait = t.maxBackoff
+		}
+		return true, wait, reason
+	}
+	return true, t.backoff(attempt), reason
+}
+
+// isRetryableCode checks if a request failing with the error code can succeed if retried later
+func isRetryableCode(code string) bool {
+	return code == ERROR_CODE_REQUEST_LIMIT_EXCEEDED || code == ERROR_CODE_SERVER_UNAVAILABLE
+}
+
+// backoff grows exponentially with the attempt, jittered so concurrent workers don't retry together
+func (t *RetryTransport) backoff(attempt int) time.Duration {
+	d := t.minBackoff << uint(attempt-1)
+	if d > t.maxBackoff || d <= 0 {
+		d = t.maxBackoff
+	}
+	half := int64(d / 2)
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+// isTransientError checks if the request failed on a connection reset or timeout
+func isTransientError(err error) bool {
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return true
+	}
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+// isNotSent checks if the request failed before it was sent, connecting to Salesforce
+func isNotSent(err error) bool {
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	var oe *net.OpError
+	return errors.As(err, &oe) && oe.Op == "dial"
+}
+
+// retryAfter is how long the response asks to wait before retrying, in seconds or until a date
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	v := resp.Header.Get(HEADER_RETRY_AFTER)
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if at, err := http.ParseTime(v); err == nil {
+		wait := time.Until(at)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	return 0, false
+}
+
+// peekError maps the error response, leaving its body to be read again
+func peekError(resp *http.Response) error {
+	body, err := io.ReadAll(io.LimitReader(resp.Body, MAX_RETRY_BODY_SIZE))
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+	if err != nil {
+		return err
+	}
+
+	return NewSalesforceError(resp, body)
+}
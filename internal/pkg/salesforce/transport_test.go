@@ -0,0 +1,130 @@
+package salesforce
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryTransport(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		header   http.Header
+		status   int
+		body     string
+		attempts int32
+	}{
+		{"get server error", http.MethodGet, nil, http.StatusServiceUnavailable, "", 3},
+		{"post server error", http.MethodPost, nil, http.StatusServiceUnavailable, "", 1},
+		{"post too many requests", http.MethodPost, nil, http.StatusTooManyRequests, "", 3},
+		{"post request limit", http.MethodPost, nil, http.StatusForbidden, `[{"errorCode":"REQUEST_LIMIT_EXCEEDED","message":"TotalRequests Limit exceeded."}]`, 3},
+		{"post forbidden", http.MethodPost, nil, http.StatusForbidden, `[{"errorCode":"INSUFFICIENT_ACCESS","message":"no access"}]`, 1},
+		{"idempotent post server error", http.MethodPost, http.Header{HEADER_IDEMPOTENCY_KEY: nil}, http.StatusServiceUnavailable, "", 3},
+		{"patch bad request", http.MethodPatch, nil, http.StatusBadRequest, "", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if _, ok := r.Header[HEADER_IDEMPOTENCY_KEY]; ok {
+					t.Error("idempotency marker was sent")
+				}
+				atomic.AddInt32(&attempts, 1)
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			rt := &RetryTransport{Base: http.DefaultTransport, maxAttempts: 3, minBackoff: time.Millisecond, maxBackoff: time.Millisecond}
+			req, err := http.NewRequest(tt.method, srv.URL, strings.NewReader("{}"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for k, v := range tt.header {
+				req.Header[k] = v
+			}
+
+			resp, err := rt.RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.status {
+				t.Errorf("got status %d, want %d", resp.StatusCode, tt.status)
+			}
+			if attempts != tt.attempts {
+				t.Errorf("sent %d times, want %d", attempts, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestRetryTransportRefused(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+
+	rt := &RetryTransport{Base: http.DefaultTransport, maxAttempts: 2, minBackoff: time.Millisecond, maxBackoff: time.Millisecond}
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rt.RoundTrip(req); err == nil || !isNotSent(err) {
+		t.Errorf("got %v, want the refused connection", err)
+	}
+}
+
+func TestRetryTransportRetryAfter(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxBackoff time.Duration
+		timeout    time.Duration
+		attempts   int32
+	}{
+		{"clamped to max backoff", time.Millisecond, time.Minute, 3},
+		{"past the deadline", time.Hour, time.Second, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&attempts, 1)
+				w.Header().Set(HEADER_RETRY_AFTER, "3600")
+				w.WriteHeader(http.StatusTooManyRequests)
+			}))
+			defer srv.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+
+			rt := &RetryTransport{Base: http.DefaultTransport, maxAttempts: 3, minBackoff: time.Millisecond, maxBackoff: tt.maxBackoff}
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			start := time.Now()
+			resp, err := rt.RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusTooManyRequests {
+				t.Errorf("got status %d, want %d", resp.StatusCode, http.StatusTooManyRequests)
+			}
+			if attempts != tt.attempts {
+				t.Errorf("sent %d times, want %d", attempts, tt.attempts)
+			}
+			if elapsed := time.Since(start); elapsed > tt.timeout/2 {
+				t.Errorf("waited %v for Retry-After", elapsed)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package salesforce
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/tools"
+	"go.uber.org/zap"
+)
+
+const (
+	// Lists the API versions the org supports, it isn't versioned itself
+	VERSIONS_PATH = "/services/data"
+)
+
+// APIVersion is an API version the org supports
+type APIVersion struct {
+	Label   string `json:"label"`
+	URL     string `json:"url"`
+	Version string `json:"version"`
+}
+
+// ListAPIVersions lists the API versions the org supports
+func (s *Salesforce) ListAPIVersions() (versions []APIVersion, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("unable to list API versions: %v", e)
+		}
+	}()
+
+	req, err := http.NewRequest(http.MethodGet, VERSIONS_PATH, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.DoClientRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	bodyBytes, err := tools.HTTPGetResponseBody(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	versions = make([]APIVersion, 0)
+	if err := json.Unmarshal(bodyBytes, &versions); err != nil {
+		return nil, fmt.Errorf("unable to read API versions: %w", err)
+	}
+
+	return versions, nil
+}
+
+// negotiateAPIVersion picks the newest API version the org supports, or checks the org supports the pinned version.
+// Falls back to the pin, or the default version, if the versions can't be listed.
+func (s *Salesforce) negotiateAPIVersion(pin string) (string, error) {
+	pin = strings.TrimPrefix(pin, "v")
+
+	versions, err := s.ListAPIVersions()
+	if err != nil || len(versions) == 0 {
+		fallback := pin
+		if fallback == "" {
+			fallback = DEFAULT_API_VERSION
+		}
+		zap.S().Warnw("unable to list Salesforce API versions, using fallback", "api_version", fallback, "error", err)
+		return fallback, nil
+	}
+
+	newest := ""
+	for _, v := range versions {
+		if pin != "" && compareVersions(v.Version, pin) == 0 {
+			return v.Version, nil
+		}
+		if newest == "" || compareVersions(v.Version, newest) > 0 {
+			newest = v.Version
+		}
+	}
+	if pin != "" {
+		return "", fmt.Errorf("org doesn't support pinned API version %s, newest supported is %s", pin, newest)
+	}
+
+	return newest, nil
+}
+
+// compareVersions compares versions like `51.0` part by part, returning -1, 0 or 1
+func compareVersions(a string, b string) int {
+	aParts := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	bParts := strings.Split(strings.TrimPrefix(b, "v"), ".")
+
+	for i := 0; i < len(aParts) || i < len(bParts); i++ {
+		var av, bv int
+		if i < len(aParts) {
+			av, _ = strconv.Atoi(aParts[i])
+		}
+		if i < len(bParts) {
+			bv, _ = strconv.Atoi(bParts[i])
+		}
+		if av != bv {
+			if av < bv {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	return 0
+}
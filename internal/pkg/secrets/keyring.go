@@ -0,0 +1,164 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	KEYRING_VERSION    = 1
+	KEYRING_FILE_MODE  = 0600
+	KEYRING_ITERATIONS = 210000
+	KEYRING_SALT_SIZE  = 16
+	KEYRING_KEY_SIZE   = 32
+)
+
+var ErrWrongPassphrase = errors.New("unable to decrypt keyring, wrong passphrase")
+
+// Keyring is a local file of named secrets, encrypted with AES-256-GCM by a key derived from a passphrase
+type Keyring struct {
+	path       string
+	passphrase string
+	secrets    map[string]string
+}
+
+// keyringFile is the keyring as stored, the secrets are encrypted as JSON
+type keyringFile struct {
+	Version    int    `json:"version"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Data       []byte `json:"data"`
+}
+
+// OpenKeyring decrypts the keyring at the path, a keyring that doesn't exist yet is empty
+func OpenKeyring(path string, passphrase string) (*Keyring, error) {
+	if passphrase == "" {
+		return nil, errors.New("keyring passphrase is empty")
+	}
+
+	k := &Keyring{
+		path:       path,
+		passphrase: passphrase,
+		secrets:    make(map[string]string),
+	}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return k, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	kf := keyringFile{}
+	if err := json.Unmarshal(b, &kf); err != nil {
+		return nil, fmt.Errorf("unable to read keyring: %w", err)
+	}
+	if kf.Version != KEYRING_VERSION {
+		return nil, fmt.Errorf("unsupported keyring version: %d", kf.Version)
+	}
+	if kf.Iterations < KEYRING_ITERATIONS {
+		return nil, fmt.Errorf("keyring key derivation iterations too low: %d, at least %d are required", kf.Iterations, KEYRING_ITERATIONS)
+	}
+
+	gcm, err := newGCM(passphrase, kf.Salt, kf.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	data, err := gcm.Open(nil, kf.Nonce, kf.Data, nil)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	if err := json.Unmarshal(data, &k.secrets); err != nil {
+		return nil, fmt.Errorf("unable to read keyring secrets: %w", err)
+	}
+
+	return k, nil
+}
+
+func (k *Keyring) Get(name string) (string, bool) {
+	s, ok := k.secrets[name]
+	return s, ok
+}
+
+// Set adds or replaces the secret, the keyring must be saved after
+func (k *Keyring) Set(name string, secret string) {
+	k.secrets[name] = secret
+}
+
+// Delete removes the secret, the keyring must be saved after
+func (k *Keyring) Delete(name string) bool {
+	_, ok := k.secrets[name]
+	delete(k.secrets, name)
+	return ok
+}
+
+// Names are the names of the secrets in the keyring, sorted
+func (k *Keyring) Names() []string {
+	names := make([]string, 0, len(k.secrets))
+	for name := range k.secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Save encrypts the keyring with a new salt and nonce, replacing the file
+func (k *Keyring) Save() error {
+	data, err := json.Marshal(k.secrets)
+	if err != nil {
+		return err
+	}
+
+	kf := keyringFile{
+		Version:    KEYRING_VERSION,
+		Iterations: KEYRING_ITERATIONS,
+		Salt:       make([]byte, KEYRING_SALT_SIZE),
+	}
+	if _, err := rand.Read(kf.Salt); err != nil {
+		return err
+	}
+
+	gcm, err := newGCM(k.passphrase, kf.Salt, kf.Iterations)
+	if err != nil {
+		return err
+	}
+	kf.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(kf.Nonce); err != nil {
+		return err
+	}
+	kf.Data = gcm.Seal(nil, kf.Nonce, data, nil)
+
+	b, err := json.Marshal(kf)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(k.path), 0700); err != nil {
+		return err
+	}
+	tmp := k.path + ".tmp"
+	if err := os.WriteFile(tmp, b, KEYRING_FILE_MODE); err != nil {
+		return err
+	}
+	return os.Rename(tmp, k.path)
+}
+
+func newGCM(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(pbkdf2.Key([]byte(passphrase), salt, iterations, KEYRING_KEY_SIZE, sha256.New))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
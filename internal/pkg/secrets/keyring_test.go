@@ -0,0 +1,112 @@
+package secrets
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestKeyringRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keyring", "secrets.json")
+
+	k, err := OpenKeyring(path, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(k.Names()) != 0 {
+		t.Fatalf("new keyring has secrets %v", k.Names())
+	}
+	k.Set("sf-prod", "s3cr3t")
+	k.Set("s3-backups", "k3y")
+	if err := k.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != KEYRING_FILE_MODE {
+		t.Errorf("keyring saved with mode %v, want %v", info.Mode().Perm(), os.FileMode(KEYRING_FILE_MODE))
+	}
+
+	k, err = OpenKeyring(path, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"s3-backups", "sf-prod"}; !reflect.DeepEqual(k.Names(), want) {
+		t.Errorf("names %v, want %v", k.Names(), want)
+	}
+	if s, ok := k.Get("sf-prod"); !ok || s != "s3cr3t" {
+		t.Errorf("got %q, %v, want the saved secret", s, ok)
+	}
+
+	if !k.Delete("sf-prod") || k.Delete("sf-prod") {
+		t.Error("delete should report only secrets in the keyring")
+	}
+	if err := k.Save(); err != nil {
+		t.Fatal(err)
+	}
+	k, err = OpenKeyring(path, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"s3-backups"}; !reflect.DeepEqual(k.Names(), want) {
+		t.Errorf("names after delete %v, want %v", k.Names(), want)
+	}
+}
+
+func TestKeyringWrongPassphrase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.json")
+
+	k, err := OpenKeyring(path, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.Set("sf-prod", "s3cr3t")
+	if err := k.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := OpenKeyring(path, "battery staple"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("got %v, want %v", err, ErrWrongPassphrase)
+	}
+	if _, err := OpenKeyring(path, ""); err == nil {
+		t.Error("opened the keyring with an empty passphrase")
+	}
+}
+
+func TestKeyringTooFewIterations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.json")
+
+	k, err := OpenKeyring(path, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := k.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kf := keyringFile{}
+	if err := json.Unmarshal(b, &kf); err != nil {
+		t.Fatal(err)
+	}
+	kf.Iterations = 1
+	if b, err = json.Marshal(kf); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, b, KEYRING_FILE_MODE); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := OpenKeyring(path, "correct horse"); err == nil {
+		t.Error("opened a keyring with too few key derivation iterations")
+	}
+}
@@ -0,0 +1,167 @@
+// Package secrets resolves secret references in config values, so credentials needn't be stored in plain text
+package secrets
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+const (
+	// Reference prefixes, values without one are used as-is
+	PREFIX_ENV     = "env:"
+	PREFIX_FILE    = "file:"
+	PREFIX_EXEC    = "exec:"
+	PREFIX_KEYRING = "keyring:"
+)
+
+var ErrNoKeyring = errors.New("no keyring to resolve secret from")
+
+// Resolver resolves secret references:
+//   - `env:NAME` is the environment variable
+//   - `file:/path/to/secret` is the file's contents, without a trailing newline
+//   - `exec:helper arg...` is the output of the helper command, without a trailing newline. It isn't run in a shell.
+//   - `keyring:name` is the secret in the encrypted keyring
+type Resolver struct {
+	// Keyring is opened when a keyring secret is first resolved
+	Keyring func() (*Keyring, error)
+
+	keyring *Keyring
+}
+
+// IsReference checks if the value refers to a secret
+func IsReference(value string) bool {
+	for _, p := range []string{PREFIX_ENV, PREFIX_FILE, PREFIX_EXEC, PREFIX_KEYRING} {
+		if strings.HasPrefix(value, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve returns the secret the value refers to, or the value if it isn't a reference
+func (r *Resolver) Resolve(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, PREFIX_ENV):
+		name := strings.TrimPrefix(value, PREFIX_ENV)
+		secret, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("secret env variable `%s` isn't set", name)
+		}
+		return secret, nil
+
+	case strings.HasPrefix(value, PREFIX_FILE):
+		path := strings.TrimPrefix(value, PREFIX_FILE)
+		secret, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("unable to read secret file: %w", err)
+		}
+		return trimNewline(string(secret)), nil
+
+	case strings.HasPrefix(value, PREFIX_EXEC):
+		args := strings.Fields(strings.TrimPrefix(value, PREFIX_EXEC))
+		if len(args) == 0 {
+			return "", errors.New("secret helper command is empty")
+		}
+		var stderr bytes.Buffer
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stderr = &stderr
+		secret, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("secret helper `%s` failed: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+		}
+		return trimNewline(string(secret)), nil
+
+	case strings.HasPrefix(value, PREFIX_KEYRING):
+		name := strings.TrimPrefix(value, PREFIX_KEYRING)
+		k, err := r.openKeyring()
+		if err != nil {
+			return "", err
+		}
+		secret, ok := k.Get(name)
+		if !ok {
+			return "", fmt.Errorf("secret `%s` isn't in the keyring", name)
+		}
+		return secret, nil
+	}
+
+	return value, nil
+}
+
+// ResolveAll resolves every reference in the value, recursing into maps and slices as decoded from config.
+// Returns the resolved copy, and whether anything was resolved.
+func (r *Resolver) ResolveAll(v interface{}) (interface{}, bool, error) {
+	switch val := v.(type) {
+	case string:
+		if !IsReference(val) {
+			return val, false, nil
+		}
+		secret, err := r.Resolve(val)
+		return secret, err == nil, err
+
+	case map[string]interface{}:
+		resolved := make(map[string]interface{}, len(val))
+		changed := false
+		for k, item := range val {
+			ri, c, err := r.ResolveAll(item)
+			if err != nil {
+				return nil, false, fmt.Errorf("%s: %w", k, err)
+			}
+			resolved[k] = ri
+			changed = changed || c
+		}
+		return resolved, changed, nil
+
+	case map[interface{}]interface{}:
+		resolved := make(map[interface{}]interface{}, len(val))
+		changed := false
+		for k, item := range val {
+			ri, c, err := r.ResolveAll(item)
+			if err != nil {
+				return nil, false, fmt.Errorf("%v: %w", k, err)
+			}
+			resolved[k] = ri
+			changed = changed || c
+		}
+		return resolved, changed, nil
+
+	case []interface{}:
+		resolved := make([]interface{}, len(val))
+		changed := false
+		for i, item := range val {
+			ri, c, err := r.ResolveAll(item)
+			if err != nil {
+				return nil, false, fmt.Errorf("%d: %w", i, err)
+			}
+			resolved[i] = ri
+			changed = changed || c
+		}
+		return resolved, changed, nil
+	}
+
+	return v, false, nil
+}
+
+func (r *Resolver) openKeyring() (*Keyring, error) {
+	if r.keyring != nil {
+		return r.keyring, nil
+	}
+	if r.Keyring == nil {
+		return nil, ErrNoKeyring
+	}
+
+	k, err := r.Keyring()
+	if err != nil {
+		return nil, err
+	}
+	r.keyring = k
+
+	return k, nil
+}
+
+func trimNewline(s string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(s, "\n"), "\r")
+}
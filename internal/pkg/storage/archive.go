@@ -0,0 +1,336 @@
+package storage
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"go.uber.org/zap"
+)
+
+const (
+	ARCHIVE_EXT          = ".tar.zst"
+	ARCHIVE_PARTIAL_EXT  = ".partial"
+	ARCHIVE_MANIFEST_EXT = ".json"
+	ARCHIVE_FILE_MODE    = 0755
+)
+
+type ArchiveConfig struct {
+	Dir string `mapstructure:"dir"`
+}
+
+// Archive stores each run as a zstd compressed tarball on the filesystem, e.g. `<dir>/20211015T200801Z.tar.zst`.
+// A JSON manifest is written beside the tarball when the run is closed. Tarballs without one are incomplete.
+type Archive struct {
+	config ArchiveConfig
+
+	mu       sync.Mutex
+	file     *os.File
+	zw       *zstd.Encoder
+	tw       *tar.Writer
+	manifest *Manifest
+}
+
+func NewArchive(config ArchiveConfig) *Archive {
+	return &Archive{
+		config: config,
+	}
+}
+
+func (a *Archive) Init() error {
+	if a.config.Dir == "" {
+		return errors.New("archive storage requires a dir")
+	}
+
+	a.manifest = newManifest(time.Now())
+	return os.MkdirAll(a.config.Dir, ARCHIVE_FILE_MODE)
+}
+
+func (a *Archive) archivePath(id string) string {
+	return filepath.Join(a.config.Dir, id+ARCHIVE_EXT)
+}
+
+func (a *Archive) manifestPath(id string) string {
+	return filepath.Join(a.config.Dir, id+ARCHIVE_MANIFEST_EXT)
+}
+
+// open lazily creates the tarball for the run on the first backup
+func (a *Archive) open() error {
+	if a.tw != nil {
+		return nil
+	}
+
+	f, err := os.Create(a.archivePath(a.manifest.ID) + ARCHIVE_PARTIAL_EXT)
+	if err != nil {
+		return err
+	}
+
+	zw, err := zstd.NewWriter(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	a.file = f
+	a.zw = zw
+	a.tw = tar.NewWriter(zw)
+	return nil
+}
+
+func (a *Archive) Backup(paths []string, tags ...string) (*BackupResult, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.manifest == nil {
+		return nil, errors.New("archive storage is closed")
+	}
+
+	if err := a.open(); err != nil {
+		return nil, err
+	}
+
+	result := &BackupResult{
+		SnapshotID: a.manifest.ID,
+	}
+	for _, p := range paths {
+		err := walkFiles(p, func(path string, info fs.FileInfo) error {
+			if err := a.addFile(path, info, p); err != nil {
+				return err
+			}
+			result.add(info.Size())
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	a.manifest.addTags(tags...)
+	return result, nil
+}
+
+func (a *Archive) addFile(path string, info fs.FileInfo, root string) error {
+	hdr, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	hdr.Name = storedName(path)
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := a.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if _, err := io.Copy(a.tw, f); err != nil {
+		return err
+	}
+
+	a.manifest.addFile(hdr.Name, info.Size(), storedName(root))
+	return nil
+}
+
+func (a *Archive) Snapshots(tags ...string) ([]Snapshot, error) {
+	entries, err := os.ReadDir(a.config.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := make([]Snapshot, 0)
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ARCHIVE_MANIFEST_EXT {
+			continue
+		}
+
+		m, err := a.readManifest(strings.TrimSuffix(e.Name(), ARCHIVE_MANIFEST_EXT))
+		if err != nil {
+			zap.S().Warnw("unable to read archive manifest, skipping", "manifest", e.Name(), "error", err)
+			continue
+		}
+		snapshots = append(snapshots, m.Snapshot)
+	}
+
+	return filterSnapshots(snapshots, tags...), nil
+}
+
+func (a *Archive) readManifest(id string) (*Manifest, error) {
+	data, err := os.ReadFile(a.manifestPath(id))
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manifest{}
+	err = json.Unmarshal(data, m)
+	return m, err
+}
+
+func (a *Archive) Restore(snapshotID string, target string, include ...string) error {
+	id, err := resolveSnapshot(a, snapshotID)
+	if err != nil {
+		return err
+	}
+
+	return a.read(id, func(hdr *tar.Header, r io.Reader) error {
+		if !MatchInclude(hdr.Name, include...) {
+			return nil
+		}
+
+		path, err := restorePath(target, hdr.Name)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), ARCHIVE_FILE_MODE); err != nil {
+			return err
+		}
+
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, hdr.FileInfo().Mode())
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.Copy(f, r)
+		return err
+	})
+}
+
+// read calls fn for every file in a snapshot's tarball
+func (a *Archive) read(id string, fn func(*tar.Header, io.Reader) error) error {
+	f, err := os.Open(a.archivePath(id))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	zr, err := zstd.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		if err := fn(hdr, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// Check reads every tarball through, comparing its files to the manifest.
+// zstd frames are checksummed, so corrupted data fails to decompress.
+func (a *Archive) Check() error {
+	snapshots, err := a.Snapshots()
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, s := range snapshots {
+		if err := a.checkSnapshot(s.ID); err != nil {
+			zap.S().Errorw("archive check failed", "snapshot", s.ID, "error", err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d archives failed the check", failed, len(snapshots))
+	}
+	return nil
+}
+
+func (a *Archive) checkSnapshot(id string) error {
+	m, err := a.readManifest(id)
+	if err != nil {
+		return err
+	}
+
+	found := make(map[string]int64, len(m.Files))
+	err = a.read(id, func(hdr *tar.Header, r io.Reader) error {
+		n, err := io.Copy(io.Discard, r)
+		found[hdr.Name] = n
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	for name, size := range m.Files {
+		if found[name] != size {
+			return fmt.Errorf("file %s has size %d, expected %d", name, found[name], size)
+		}
+	}
+
+	return nil
+}
+
+// Close finishes the run's tarball and writes its manifest
+func (a *Archive) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.tw == nil {
+		a.manifest = nil
+		return nil
+	}
+
+	for _, c := range []io.Closer{a.tw, a.zw, a.file} {
+		if err := c.Close(); err != nil {
+			return err
+		}
+	}
+	a.tw = nil
+
+	m := a.manifest
+	a.manifest = nil
+
+	path := a.archivePath(m.ID)
+	if err := os.Rename(path+ARCHIVE_PARTIAL_EXT, path); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	zap.S().Infow("archive stored", "archive", path, "files", len(m.Files))
+	return os.WriteFile(a.manifestPath(m.ID), data, ARCHIVE_FILE_MODE)
+}
+
+// Forget removes the tarballs and manifests of the runs. There is nothing to prune.
+func (a *Archive) Forget(snapshots []Snapshot, prune bool) error {
+	for _, s := range snapshots {
+		if err := os.Remove(a.manifestPath(s.ID)); err != nil {
+			return err
+		}
+		if err := os.Remove(a.archivePath(s.ID)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		zap.S().Infow("archive run removed", "snapshot", s.ID)
+	}
+
+	return nil
+}
@@ -0,0 +1,245 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// writeFiles writes the files, by path relative to the dir, returning their paths
+func writeFiles(t *testing.T, dir string, files map[string]string) map[string]string {
+	t.Helper()
+	paths := make(map[string]string, len(files))
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths[name] = p
+	}
+	return paths
+}
+
+// restored reads the files restored into the target, by their name relative to the dir they were backed up from
+func restored(t *testing.T, target string, dir string) map[string]string {
+	t.Helper()
+	root := filepath.Join(target, filepath.FromSlash(storedName(dir)))
+	files := make(map[string]string)
+	filepath.Walk(target, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[filepath.ToSlash(rel)] = string(data)
+		return nil
+	})
+	return files
+}
+
+func snapshotIDs(snapshots []Snapshot) []string {
+	ids := make([]string, 0, len(snapshots))
+	for _, s := range snapshots {
+		ids = append(ids, s.ID)
+	}
+	return ids
+}
+
+// newTestArchive starts a run at the time, so runs in a test have their own IDs
+func newTestArchive(t *testing.T, dir string, run time.Time) *Archive {
+	t.Helper()
+	a := NewArchive(ArchiveConfig{Dir: dir})
+	if err := a.Init(); err != nil {
+		t.Fatal(err)
+	}
+	a.manifest = newManifest(run)
+	return a
+}
+
+func TestArchiveBackupAndRestore(t *testing.T) {
+	src := t.TempDir()
+	dir := t.TempDir()
+	paths := writeFiles(t, src, map[string]string{
+		"Account/metadata.json": `{"name":"Account"}`,
+		"Account.0.csv":         "Id\n001A\n",
+		"Contact.0.csv":         "Id\n003A\n",
+	})
+
+	run := time.Date(2021, 10, 15, 20, 8, 1, 0, time.UTC)
+	a := newTestArchive(t, dir, run)
+
+	result, err := a.Backup([]string{paths["Account/metadata.json"], paths["Account.0.csv"]}, "object:Account")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.SnapshotID != "20211015T200801Z" || result.Files != 2 || result.Bytes != 26 {
+		t.Errorf("unexpected backup result %+v", result)
+	}
+	if _, err := a.Backup([]string{paths["Contact.0.csv"]}, "object:Contact"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the run is incomplete until closed
+	if _, err := os.Stat(filepath.Join(dir, "20211015T200801Z"+ARCHIVE_EXT+ARCHIVE_PARTIAL_EXT)); err != nil {
+		t.Errorf("partial tarball not written: %v", err)
+	}
+	snapshots, err := a.Snapshots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 0 {
+		t.Errorf("incomplete run listed: %v", snapshotIDs(snapshots))
+	}
+
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Backup([]string{paths["Contact.0.csv"]}); err == nil {
+		t.Error("backed up after close")
+	}
+
+	entries, _ := os.ReadDir(dir)
+	names := make([]string, 0)
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if want := []string{"20211015T200801Z.json", "20211015T200801Z.tar.zst"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("archive dir has %v, want %v", names, want)
+	}
+
+	snapshots, err = a.Snapshots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 1 {
+		t.Fatalf("got %d snapshots, want 1", len(snapshots))
+	}
+	tags := append([]string{}, snapshots[0].Tags...)
+	sort.Strings(tags)
+	if !reflect.DeepEqual(tags, []string{"object:Account", "object:Contact"}) || !snapshots[0].Time.Equal(run) {
+		t.Errorf("unexpected snapshot %+v", snapshots[0])
+	}
+	if filtered, _ := a.Snapshots("object:Lead"); len(filtered) != 0 {
+		t.Errorf("snapshots filtered by a missing tag: %v", snapshotIDs(filtered))
+	}
+
+	if err := a.Check(); err != nil {
+		t.Errorf("check failed: %v", err)
+	}
+
+	target := t.TempDir()
+	if err := a.Restore(SNAPSHOT_LATEST, target, "Account/*", "Account.*.csv"); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"Account/metadata.json": `{"name":"Account"}`,
+		"Account.0.csv":         "Id\n001A\n",
+	}
+	if got := restored(t, target, src); !reflect.DeepEqual(got, want) {
+		t.Errorf("restored %v, want %v", got, want)
+	}
+}
+
+func TestArchiveCloseWithoutBackups(t *testing.T) {
+	dir := t.TempDir()
+	a := newTestArchive(t, dir, time.Now())
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 0 {
+		t.Errorf("empty run wrote %d files", len(entries))
+	}
+}
+
+func TestArchiveCheckCorrupted(t *testing.T) {
+	src := t.TempDir()
+	dir := t.TempDir()
+	paths := writeFiles(t, src, map[string]string{"Account.0.csv": "Id\n001A\n001B\n001C\n"})
+
+	a := newTestArchive(t, dir, time.Date(2021, 10, 15, 20, 0, 0, 0, time.UTC))
+	if _, err := a.Backup([]string{paths["Account.0.csv"]}); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tarball := filepath.Join(dir, "20211015T200000Z"+ARCHIVE_EXT)
+	data, err := os.ReadFile(tarball)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(tarball, data[:len(data)/2], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.Check(); err == nil {
+		t.Error("check passed a truncated tarball")
+	}
+}
+
+func TestArchiveForget(t *testing.T) {
+	src := t.TempDir()
+	dir := t.TempDir()
+
+	runs := []time.Time{
+		time.Date(2021, 10, 14, 20, 0, 0, 0, time.UTC),
+		time.Date(2021, 10, 15, 20, 0, 0, 0, time.UTC),
+	}
+	for i, run := range runs {
+		paths := writeFiles(t, src, map[string]string{"Account.0.csv": "run " + string(rune('1'+i))})
+		a := newTestArchive(t, dir, run)
+		if _, err := a.Backup([]string{paths["Account.0.csv"]}, "object:Account"); err != nil {
+			t.Fatal(err)
+		}
+		if err := a.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	a := NewArchive(ArchiveConfig{Dir: dir})
+	snapshots, err := a.Snapshots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"20211014T200000Z", "20211015T200000Z"}; !reflect.DeepEqual(snapshotIDs(snapshots), want) {
+		t.Fatalf("snapshots %v, want %v oldest first", snapshotIDs(snapshots), want)
+	}
+
+	// latest restores the newest run
+	target := t.TempDir()
+	if err := a.Restore(SNAPSHOT_LATEST, target); err != nil {
+		t.Fatal(err)
+	}
+	if got := restored(t, target, src); got["Account.0.csv"] != "run 2" {
+		t.Errorf("latest restored %v", got)
+	}
+
+	if err := a.Forget(snapshots[:1], true); err != nil {
+		t.Fatal(err)
+	}
+	snapshots, err = a.Snapshots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"20211015T200000Z"}; !reflect.DeepEqual(snapshotIDs(snapshots), want) {
+		t.Errorf("snapshots left %v, want %v", snapshotIDs(snapshots), want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "20211014T200000Z"+ARCHIVE_EXT)); !os.IsNotExist(err) {
+		t.Errorf("forgotten tarball still exists: %v", err)
+	}
+}
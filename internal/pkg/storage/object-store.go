@@ -0,0 +1,299 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"go.uber.org/zap"
+)
+
+const (
+	OBJECT_STORE_MANIFEST = ".manifest.json"
+	OBJECT_STORE_META_TAG = "Cistern-Tags"
+)
+
+type ObjectStoreConfig struct {
+	Endpoint  string `mapstructure:"endpoint"`
+	Bucket    string `mapstructure:"bucket"`
+	Prefix    string `mapstructure:"prefix"`
+	Region    string `mapstructure:"region"`
+	AccessKey string `mapstructure:"access_key"`
+	Secret    string `mapstructure:"secret"`
+	UseSSL    bool   `mapstructure:"use_ssl"`
+}
+
+// ObjectStore stores each run's files as plain objects in an S3 compatible bucket, without restic.
+// Objects are keyed by `<prefix>/<run>/<path>`, with a manifest object written when the run is closed.
+// Runs without a manifest are incomplete.
+type ObjectStore struct {
+	config ObjectStoreConfig
+	client *minio.Client
+
+	mu       sync.Mutex
+	manifest *Manifest
+}
+
+func NewObjectStore(config ObjectStoreConfig) *ObjectStore {
+	return &ObjectStore{
+		config: config,
+	}
+}
+
+func (o *ObjectStore) Init() error {
+	if o.config.Endpoint == "" || o.config.Bucket == "" {
+		return errors.New("object store storage requires an endpoint and bucket")
+	}
+
+	client, err := minio.New(o.config.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(o.config.AccessKey, o.config.Secret, ""),
+		Secure: o.config.UseSSL,
+		Region: o.config.Region,
+	})
+	if err != nil {
+		return err
+	}
+	o.client = client
+
+	ctx := context.Background()
+	exists, err := client.BucketExists(ctx, o.config.Bucket)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		err = client.MakeBucket(ctx, o.config.Bucket, minio.MakeBucketOptions{Region: o.config.Region})
+		if err != nil {
+			return err
+		}
+		zap.S().Infof("Object store bucket created: %s", o.config.Bucket)
+	}
+
+	o.manifest = newManifest(time.Now())
+	return nil
+}
+
+func (o *ObjectStore) runPrefix(id string) string {
+	return path.Join(o.config.Prefix, id) + "/"
+}
+
+func (o *ObjectStore) Backup(paths []string, tags ...string) (*BackupResult, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.manifest == nil {
+		return nil, errors.New("object store storage is closed")
+	}
+
+	ctx := context.Background()
+	opts := minio.PutObjectOptions{
+		UserMetadata: map[string]string{
+			OBJECT_STORE_META_TAG: strings.Join(tags, ","),
+		},
+	}
+
+	result := &BackupResult{
+		SnapshotID: o.manifest.ID,
+	}
+	for _, p := range paths {
+		err := walkFiles(p, func(file string, info fs.FileInfo) error {
+			name := storedName(file)
+			_, err := o.client.FPutObject(ctx, o.config.Bucket, o.runPrefix(o.manifest.ID)+name, file, opts)
+			if err != nil {
+				return err
+			}
+			o.manifest.addFile(name, info.Size(), storedName(p))
+			result.add(info.Size())
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	o.manifest.addTags(tags...)
+	return result, nil
+}
+
+func (o *ObjectStore) Snapshots(tags ...string) ([]Snapshot, error) {
+	ctx := context.Background()
+	prefix := ""
+	if o.config.Prefix != "" {
+		prefix = strings.TrimSuffix(o.config.Prefix, "/") + "/"
+	}
+
+	snapshots := make([]Snapshot, 0)
+	for obj := range o.client.ListObjects(ctx, o.config.Bucket, minio.ListObjectsOptions{Prefix: prefix}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		// only run "directories" are listed without recursing
+		if !strings.HasSuffix(obj.Key, "/") {
+			continue
+		}
+
+		id := path.Base(strings.TrimSuffix(obj.Key, "/"))
+		m, err := o.readManifest(id)
+		if err != nil {
+			zap.S().Warnw("unable to read object store manifest, skipping", "run", id, "error", err)
+			continue
+		}
+		snapshots = append(snapshots, m.Snapshot)
+	}
+
+	return filterSnapshots(snapshots, tags...), nil
+}
+
+func (o *ObjectStore) readManifest(id string) (*Manifest, error) {
+	obj, err := o.client.GetObject(context.Background(), o.config.Bucket, o.runPrefix(id)+OBJECT_STORE_MANIFEST, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+
+	m := &Manifest{}
+	err = json.NewDecoder(obj).Decode(m)
+	return m, err
+}
+
+func (o *ObjectStore) Restore(snapshotID string, target string, include ...string) error {
+	id, err := resolveSnapshot(o, snapshotID)
+	if err != nil {
+		return err
+	}
+
+	m, err := o.readManifest(id)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	for name := range m.Files {
+		if !MatchInclude(name, include...) {
+			continue
+		}
+
+		p, err := restorePath(target, name)
+		if err != nil {
+			return err
+		}
+
+		err = o.client.FGetObject(ctx, o.config.Bucket, o.runPrefix(id)+name, p, minio.GetObjectOptions{})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Check compares the objects stored for every run to its manifest
+func (o *ObjectStore) Check() error {
+	snapshots, err := o.Snapshots()
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, s := range snapshots {
+		if err := o.checkSnapshot(s.ID); err != nil {
+			zap.S().Errorw("object store check failed", "snapshot", s.ID, "error", err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d runs failed the check", failed, len(snapshots))
+	}
+	return nil
+}
+
+func (o *ObjectStore) checkSnapshot(id string) error {
+	m, err := o.readManifest(id)
+	if err != nil {
+		return err
+	}
+
+	prefix := o.runPrefix(id)
+	found := make(map[string]int64, len(m.Files))
+	opts := minio.ListObjectsOptions{Prefix: prefix, Recursive: true}
+	for obj := range o.client.ListObjects(context.Background(), o.config.Bucket, opts) {
+		if obj.Err != nil {
+			return obj.Err
+		}
+		found[strings.TrimPrefix(obj.Key, prefix)] = obj.Size
+	}
+
+	for name, size := range m.Files {
+		if s, ok := found[name]; !ok || s != size {
+			return fmt.Errorf("object %s has size %d, expected %d", name, s, size)
+		}
+	}
+
+	return nil
+}
+
+// Close writes the run's manifest
+func (o *ObjectStore) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	m := o.manifest
+	o.manifest = nil
+	if m == nil || len(m.Files) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	_, err = o.client.PutObject(context.Background(), o.config.Bucket, o.runPrefix(m.ID)+OBJECT_STORE_MANIFEST, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{ContentType: "application/json"})
+	if err != nil {
+		return err
+	}
+
+	zap.S().Infow("object store run stored", "run", m.ID, "files", len(m.Files))
+	return nil
+}
+
+// Forget removes the objects of the runs. There is nothing to prune.
+func (o *ObjectStore) Forget(snapshots []Snapshot, prune bool) error {
+	for _, s := range snapshots {
+		if err := o.removeRun(s.ID); err != nil {
+			return err
+		}
+		zap.S().Infow("object store run removed", "snapshot", s.ID)
+	}
+
+	return nil
+}
+
+// removeRun removes the manifest first, so a partly removed run is treated as incomplete
+func (o *ObjectStore) removeRun(id string) error {
+	ctx := context.Background()
+	prefix := o.runPrefix(id)
+
+	err := o.client.RemoveObject(ctx, o.config.Bucket, prefix+OBJECT_STORE_MANIFEST, minio.RemoveObjectOptions{})
+	if err != nil {
+		return err
+	}
+
+	objects := o.client.ListObjects(ctx, o.config.Bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true})
+	for e := range o.client.RemoveObjects(ctx, o.config.Bucket, objects, minio.RemoveObjectsOptions{}) {
+		if e.Err != nil {
+			return e.Err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,191 @@
+package storage
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// newTestObjectStore starts a run at the time against the fake, so runs in a test have their own IDs
+func newTestObjectStore(t *testing.T, endpoint string, run time.Time) *ObjectStore {
+	t.Helper()
+	o := NewObjectStore(ObjectStoreConfig{
+		Endpoint:  endpoint,
+		Bucket:    "backups",
+		Prefix:    "salesforce",
+		Region:    "us-east-1",
+		AccessKey: "access",
+		Secret:    "secret",
+	})
+	if err := o.Init(); err != nil {
+		t.Fatal(err)
+	}
+	o.manifest = newManifest(run)
+	return o
+}
+
+func TestObjectStoreBackupAndRestore(t *testing.T) {
+	s3, endpoint := newFakeS3(t)
+	src := t.TempDir()
+	paths := writeFiles(t, src, map[string]string{
+		"Account/metadata.json": `{"name":"Account"}`,
+		"Account.0.csv":         "Id\n001A\n",
+		"Contact.0.csv":         "Id\n003A\n",
+	})
+
+	run := time.Date(2021, 10, 15, 20, 8, 1, 0, time.UTC)
+	o := newTestObjectStore(t, endpoint, run)
+
+	result, err := o.Backup([]string{paths["Account/metadata.json"], paths["Account.0.csv"]}, "object:Account")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.SnapshotID != "20211015T200801Z" || result.Files != 2 || result.Bytes != 26 {
+		t.Errorf("unexpected backup result %+v", result)
+	}
+	if _, err := o.Backup([]string{paths["Contact.0.csv"]}, "object:Contact"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the run is incomplete until its manifest is written on close
+	snapshots, err := o.Snapshots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 0 {
+		t.Errorf("incomplete run listed: %v", snapshotIDs(snapshots))
+	}
+
+	if err := o.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := o.Backup([]string{paths["Contact.0.csv"]}); err == nil {
+		t.Error("backed up after close")
+	}
+
+	keys := s3.keys("backups")
+	if len(keys) != 4 || keys[0] != "salesforce/20211015T200801Z/"+OBJECT_STORE_MANIFEST {
+		t.Errorf("bucket has %v, want the run's files and manifest", keys)
+	}
+
+	snapshots, err = o.Snapshots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 1 {
+		t.Fatalf("got %d snapshots, want 1", len(snapshots))
+	}
+	tags := append([]string{}, snapshots[0].Tags...)
+	sort.Strings(tags)
+	if !reflect.DeepEqual(tags, []string{"object:Account", "object:Contact"}) || !snapshots[0].Time.Equal(run) {
+		t.Errorf("unexpected snapshot %+v", snapshots[0])
+	}
+
+	if err := o.Check(); err != nil {
+		t.Errorf("check failed: %v", err)
+	}
+
+	target := t.TempDir()
+	if err := o.Restore(SNAPSHOT_LATEST, target, "Account/*", "Account.*.csv"); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"Account/metadata.json": `{"name":"Account"}`,
+		"Account.0.csv":         "Id\n001A\n",
+	}
+	if got := restored(t, target, src); !reflect.DeepEqual(got, want) {
+		t.Errorf("restored %v, want %v", got, want)
+	}
+}
+
+func TestObjectStoreCloseWithoutBackups(t *testing.T) {
+	s3, endpoint := newFakeS3(t)
+	o := newTestObjectStore(t, endpoint, time.Now())
+	if err := o.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if keys := s3.keys("backups"); len(keys) != 0 {
+		t.Errorf("empty run wrote %v", keys)
+	}
+}
+
+func TestObjectStoreCheckMissingObject(t *testing.T) {
+	s3, endpoint := newFakeS3(t)
+	paths := writeFiles(t, t.TempDir(), map[string]string{"Account.0.csv": "Id\n001A\n"})
+
+	o := newTestObjectStore(t, endpoint, time.Date(2021, 10, 15, 20, 0, 0, 0, time.UTC))
+	if _, err := o.Backup([]string{paths["Account.0.csv"]}); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s3.mu.Lock()
+	for k := range s3.buckets["backups"] {
+		if k != "salesforce/20211015T200000Z/"+OBJECT_STORE_MANIFEST {
+			delete(s3.buckets["backups"], k)
+		}
+	}
+	s3.mu.Unlock()
+
+	if err := o.Check(); err == nil {
+		t.Error("check passed a run missing its files")
+	}
+}
+
+func TestObjectStoreForget(t *testing.T) {
+	s3, endpoint := newFakeS3(t)
+	src := t.TempDir()
+
+	runs := []time.Time{
+		time.Date(2021, 10, 14, 20, 0, 0, 0, time.UTC),
+		time.Date(2021, 10, 15, 20, 0, 0, 0, time.UTC),
+	}
+	var o *ObjectStore
+	for i, run := range runs {
+		paths := writeFiles(t, src, map[string]string{"Account.0.csv": "run " + string(rune('1'+i))})
+		o = newTestObjectStore(t, endpoint, run)
+		if _, err := o.Backup([]string{paths["Account.0.csv"]}, "object:Account"); err != nil {
+			t.Fatal(err)
+		}
+		if err := o.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	snapshots, err := o.Snapshots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"20211014T200000Z", "20211015T200000Z"}; !reflect.DeepEqual(snapshotIDs(snapshots), want) {
+		t.Fatalf("snapshots %v, want %v oldest first", snapshotIDs(snapshots), want)
+	}
+
+	// latest restores the newest run
+	target := t.TempDir()
+	if err := o.Restore(SNAPSHOT_LATEST, target); err != nil {
+		t.Fatal(err)
+	}
+	if got := restored(t, target, src); got["Account.0.csv"] != "run 2" {
+		t.Errorf("latest restored %v", got)
+	}
+
+	if err := o.Forget(snapshots[:1], true); err != nil {
+		t.Fatal(err)
+	}
+	snapshots, err = o.Snapshots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"20211015T200000Z"}; !reflect.DeepEqual(snapshotIDs(snapshots), want) {
+		t.Errorf("snapshots left %v, want %v", snapshotIDs(snapshots), want)
+	}
+	for _, k := range s3.keys("backups") {
+		if k[:len("salesforce/20211014T200000Z")] == "salesforce/20211014T200000Z" {
+			t.Errorf("forgotten run's object still stored: %s", k)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/restic"
+)
+
+const (
+	// Snapshots forgotten per restic command, keeping the command line short
+	RESTIC_FORGET_BATCH_SIZE = 100
+)
+
+// Restic stores backups in a restic repository on any restic backend, e.g. local, sftp, rest-server or S3.
+// Each backup is a snapshot tagged with the run, so retention keeps or forgets the run's snapshots together.
+type Restic struct {
+	config *restic.RepositoryConfig
+	repo   *restic.Repository
+	runID  string
+}
+
+func NewRestic(config *restic.RepositoryConfig) *Restic {
+	return &Restic{
+		config: config,
+	}
+}
+
+func (r *Restic) Init() error {
+	repo, err := restic.NewRepository(r.config)
+	if err != nil {
+		return err
+	}
+
+	r.repo = repo
+	r.runID = time.Now().UTC().Format(RUN_ID_FORMAT)
+	return nil
+}
+
+func (r *Restic) Backup(paths []string, tags ...string) (*BackupResult, error) {
+	summary, err := r.repo.Backup(paths, append(append([]string{}, tags...), RunTag(r.runID))...)
+	if summary == nil {
+		return nil, err
+	}
+
+	result := &BackupResult{
+		SnapshotID: summary.SnapshotID,
+		Files:      summary.TotalFilesProcessed,
+		Bytes:      summary.TotalBytesProcessed,
+		BytesAdded: summary.DataAdded,
+	}
+
+	// An incomplete snapshot is still stored, the caller decides if it's a failure
+	return result, err
+}
+
+func (r *Restic) Snapshots(tags ...string) ([]Snapshot, error) {
+	rs, err := r.repo.Snapshots(tags...)
+	if err != nil {
+		return nil, err
+	}
+
+	return filterSnapshots(resticSnapshots(rs)), nil
+}
+
+func resticSnapshots(rs []restic.Snapshot) []Snapshot {
+	snapshots := make([]Snapshot, 0, len(rs))
+	for _, s := range rs {
+		snapshots = append(snapshots, Snapshot{
+			ID:       s.ID,
+			Time:     s.Time,
+			Hostname: s.Hostname,
+			Tags:     s.Tags,
+			Paths:    s.Paths,
+		})
+	}
+	return snapshots
+}
+
+func (r *Restic) Restore(snapshotID string, target string, include ...string) error {
+	return r.repo.Restore(snapshotID, target, include...)
+}
+
+func (r *Restic) Check() error {
+	summary, err := r.repo.Check()
+	if err != nil {
+		return err
+	}
+
+	if summary.NumErrors > 0 || len(summary.Errors) > 0 {
+		return fmt.Errorf("restic check found %d errors: %s", summary.NumErrors, strings.Join(summary.Errors, "; "))
+	}
+
+	return nil
+}
+
+// Forget forgets the snapshots, then removes the data no longer referenced if prune is set
+func (r *Restic) Forget(snapshots []Snapshot, prune bool) error {
+	ids := make([]string, 0, len(snapshots))
+	for _, s := range snapshots {
+		ids = append(ids, s.ID)
+	}
+
+	for len(ids) > 0 {
+		n := RESTIC_FORGET_BATCH_SIZE
+		if n > len(ids) {
+			n = len(ids)
+		}
+		var batch []string
+		batch, ids = ids[:n], ids[n:]
+
+		args := batch
+		// pruning once, after the last batch
+		if prune && len(ids) == 0 {
+			args = append(args, restic.CMD_ARG_PRUNE)
+		}
+		if _, err := r.repo.Forget(args...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *Restic) Close() error {
+	return nil
+}
@@ -0,0 +1,376 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/tools"
+)
+
+const (
+	// Tag prefix for the run a snapshot was stored by, for backends storing a run as several snapshots
+	TAG_PREFIX_RUN = "run:"
+	// Tag prefix for the object a snapshot holds the records of
+	TAG_PREFIX_OBJECT = "object:"
+	// Tag prefix for the org a snapshot is of, when backing up several orgs
+	TAG_PREFIX_ORG = "org:"
+)
+
+// RetentionPolicy decides which backups with all of the Tags are kept.
+// Each object of an org is kept separately: the policy is applied to the runs that backed the object up,
+// so runs backing up different objects don't leave every run in a group of its own.
+// Backups without an object, e.g. of metadata, are kept by their tags.
+type RetentionPolicy struct {
+	Tags        []string `mapstructure:"tags" json:"tags,omitempty"`
+	KeepLast    int      `mapstructure:"keep_last" json:"keep_last,omitempty"`
+	KeepHourly  int      `mapstructure:"keep_hourly" json:"keep_hourly,omitempty"`
+	KeepDaily   int      `mapstructure:"keep_daily" json:"keep_daily,omitempty"`
+	KeepWeekly  int      `mapstructure:"keep_weekly" json:"keep_weekly,omitempty"`
+	KeepMonthly int      `mapstructure:"keep_monthly" json:"keep_monthly,omitempty"`
+	KeepYearly  int      `mapstructure:"keep_yearly" json:"keep_yearly,omitempty"`
+	// KeepWithin keeps every run within the duration of the latest, in restic's format, e.g. `1y6m2d12h`
+	KeepWithin string `mapstructure:"keep_within" json:"keep_within,omitempty"`
+}
+
+// ForgetResult is a group of snapshots with the same tags the retention policies were applied to
+type ForgetResult struct {
+	Tags   []string   `json:"tags"`
+	Keep   []Snapshot `json:"keep"`
+	Remove []Snapshot `json:"remove"`
+}
+
+// Forgetter is storage that can forget snapshots.
+// Prune removes the data no longer referenced by any snapshot, for backends that deduplicate.
+type Forgetter interface {
+	Forget(snapshots []Snapshot, prune bool) error
+}
+
+// RunTag is the tag for snapshots stored by the run
+func RunTag(id string) string {
+	return TAG_PREFIX_RUN + id
+}
+
+// Run is the snapshots a backup run stored
+type Run struct {
+	ID string
+	// Time is when the run's first snapshot was stored
+	Time time.Time
+	// Tags of every snapshot in the run, without the run tag
+	Tags      []string
+	Snapshots []Snapshot
+}
+
+// GroupRuns groups the snapshots by the run that stored them, oldest run first.
+// Snapshots without a run tag, e.g. of backends storing a run as one snapshot, are a run of their own.
+func GroupRuns(snapshots []Snapshot) []Run {
+	runs := make(map[string]*Run)
+	order := make([]string, 0)
+	for _, s := range snapshots {
+		id := s.ID
+		for _, t := range s.Tags {
+			if strings.HasPrefix(t, TAG_PREFIX_RUN) {
+				id = strings.TrimPrefix(t, TAG_PREFIX_RUN)
+				break
+			}
+		}
+
+		r, ok := runs[id]
+		if !ok {
+			r = &Run{ID: id, Time: s.Time}
+			runs[id] = r
+			order = append(order, id)
+		}
+		if s.Time.Before(r.Time) {
+			r.Time = s.Time
+		}
+		for _, t := range s.Tags {
+			if !strings.HasPrefix(t, TAG_PREFIX_RUN) && !tools.StringSliceContaines(r.Tags, t) {
+				r.Tags = append(r.Tags, t)
+			}
+		}
+		r.Snapshots = append(r.Snapshots, s)
+	}
+
+	grouped := make([]Run, 0, len(order))
+	for _, id := range order {
+		r := runs[id]
+		sort.Strings(r.Tags)
+		grouped = append(grouped, *r)
+	}
+	sort.SliceStable(grouped, func(i, j int) bool {
+		return grouped[i].Time.Before(grouped[j].Time)
+	})
+
+	return grouped
+}
+
+var keepWithinRegexp = regexp.MustCompile(`^(?:(\d+)y)?(?:(\d+)m)?(?:(\d+)d)?(?:(\d+)h)?$`)
+
+// Empty checks if the policy doesn't keep anything, forgetting with it would remove every snapshot
+func (p RetentionPolicy) Empty() bool {
+	return p.KeepLast == 0 && p.KeepHourly == 0 && p.KeepDaily == 0 && p.KeepWeekly == 0 &&
+		p.KeepMonthly == 0 && p.KeepYearly == 0 && p.KeepWithin == ""
+}
+
+// Validate checks the policy keeps something and its keep within duration can be parsed
+func (p RetentionPolicy) Validate() error {
+	if p.Empty() {
+		return errors.New("retention policy doesn't keep any snapshots")
+	}
+	if p.KeepWithin != "" && !keepWithinRegexp.MatchString(p.KeepWithin) {
+		return fmt.Errorf("invalid keep_within duration: %s", p.KeepWithin)
+	}
+	return nil
+}
+
+// Matches checks if the tags include all of the policy's tags
+func (p RetentionPolicy) Matches(tags []string) bool {
+	for _, t := range p.Tags {
+		if !tools.StringSliceContaines(tags, t) {
+			return false
+		}
+	}
+	return true
+}
+
+// within returns the time snapshots are kept after, relative to the latest snapshot
+func (p RetentionPolicy) within(latest time.Time) time.Time {
+	m := keepWithinRegexp.FindStringSubmatch(p.KeepWithin)
+	if m == nil {
+		return latest
+	}
+
+	n := make([]int, 4)
+	for i := range n {
+		n[i], _ = strconv.Atoi(m[i+1])
+	}
+
+	return latest.AddDate(-n[0], -n[1], -n[2]).Add(-time.Duration(n[3]) * time.Hour)
+}
+
+// retentionPart is an object a snapshot holds the records of, policies keep or forget each object of a run separately.
+// A snapshot without objects is a part of its own.
+type retentionPart struct {
+	snapshot Snapshot
+	run      Run
+	// tags policies are matched against, the snapshot's tags without the run or its other objects
+	tags []string
+	// scope is the org and object, the part is kept along with the same object's parts of the org's other runs
+	scope string
+}
+
+// retentionParts splits the run's snapshot into its objects
+func retentionParts(s Snapshot, r Run) []retentionPart {
+	base := make([]string, 0, len(s.Tags))
+	orgs := make([]string, 0)
+	objects := make([]string, 0)
+	for _, t := range s.Tags {
+		switch {
+		case strings.HasPrefix(t, TAG_PREFIX_RUN):
+		case strings.HasPrefix(t, TAG_PREFIX_OBJECT):
+			objects = append(objects, t)
+		default:
+			if strings.HasPrefix(t, TAG_PREFIX_ORG) {
+				orgs = append(orgs, t)
+			}
+			base = append(base, t)
+		}
+	}
+
+	if len(objects) == 0 {
+		return []retentionPart{{snapshot: s, run: r, tags: base, scope: groupKey(base)}}
+	}
+
+	parts := make([]retentionPart, 0, len(objects))
+	for _, o := range objects {
+		parts = append(parts, retentionPart{
+			snapshot: s,
+			run:      r,
+			tags:     append(append([]string{}, base...), o),
+			scope:    groupKey(append(append([]string{}, orgs...), o)),
+		})
+	}
+	return parts
+}
+
+// PlanRetention applies every policy to the snapshots. Each policy is applied to the runs of every object of an org
+// it matches, keeping the object's snapshots in the runs it keeps. A part is kept if any policy keeps it,
+// so a broader policy never forgets what a narrower one keeps.
+// A snapshot is only removed if every object it holds is matched by a policy and none keeps it,
+// so a policy scoped to an object never forgets another object stored in the same snapshot.
+// Snapshots no policy matches are left alone. Results are grouped by the snapshots' tags.
+func PlanRetention(snapshots []Snapshot, policies []RetentionPolicy) []ForgetResult {
+	parts := make([]retentionPart, 0, len(snapshots))
+	for _, r := range GroupRuns(snapshots) {
+		for _, s := range r.Snapshots {
+			parts = append(parts, retentionParts(s, r)...)
+		}
+	}
+
+	matched := make([]bool, len(parts))
+	kept := make(map[string]bool)
+	for _, p := range policies {
+		groups := make(map[string][]Run)
+		grouped := make(map[string]bool)
+		for i, part := range parts {
+			if !p.Matches(part.tags) {
+				continue
+			}
+			matched[i] = true
+
+			key := part.scope + "|" + part.run.ID
+			if !grouped[key] {
+				grouped[key] = true
+				groups[part.scope] = append(groups[part.scope], part.run)
+			}
+		}
+
+		for scope, g := range groups {
+			for _, id := range keepRuns(g, p) {
+				kept[scope+"|"+id] = true
+			}
+		}
+	}
+
+	// snapshots are kept if any of their parts is, or isn't matched by a policy
+	inPlan := make(map[string]bool)
+	keep := make(map[string]bool)
+	for i, part := range parts {
+		id := part.snapshot.ID
+		if matched[i] {
+			inPlan[id] = true
+		}
+		if !matched[i] || kept[part.scope+"|"+part.run.ID] {
+			keep[id] = true
+		}
+	}
+
+	results := make(map[string]*ForgetResult)
+	keys := make([]string, 0)
+	added := make(map[string]bool)
+	for _, part := range parts {
+		s := part.snapshot
+		if !inPlan[s.ID] || added[s.ID] {
+			continue
+		}
+		added[s.ID] = true
+
+		tags := make([]string, 0, len(s.Tags))
+		for _, t := range s.Tags {
+			if !strings.HasPrefix(t, TAG_PREFIX_RUN) {
+				tags = append(tags, t)
+			}
+		}
+		sort.Strings(tags)
+
+		key := groupKey(tags)
+		result, ok := results[key]
+		if !ok {
+			result = &ForgetResult{
+				Tags:   tags,
+				Keep:   make([]Snapshot, 0),
+				Remove: make([]Snapshot, 0),
+			}
+			results[key] = result
+			keys = append(keys, key)
+		}
+
+		if keep[s.ID] {
+			result.Keep = append(result.Keep, s)
+		} else {
+			result.Remove = append(result.Remove, s)
+		}
+	}
+	sort.Strings(keys)
+
+	plan := make([]ForgetResult, 0, len(keys))
+	for _, k := range keys {
+		plan = append(plan, *results[k])
+	}
+
+	return plan
+}
+
+// Removed are the snapshots the plan removes
+func Removed(plan []ForgetResult) []Snapshot {
+	removed := make([]Snapshot, 0)
+	for _, r := range plan {
+		removed = append(removed, r.Remove...)
+	}
+	return removed
+}
+
+func groupKey(tags []string) string {
+	t := append([]string{}, tags...)
+	sort.Strings(t)
+	return strings.Join(t, ",")
+}
+
+type retentionBucket struct {
+	count  int
+	period func(time.Time) string
+	last   string
+}
+
+// keepRuns returns the IDs of the runs in the group the policy keeps
+func keepRuns(runs []Run, policy RetentionPolicy) []string {
+	// newest first
+	runs = append([]Run{}, runs...)
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].Time.After(runs[j].Time)
+	})
+
+	keep := make([]string, 0)
+	if len(runs) == 0 {
+		return keep
+	}
+
+	buckets := []*retentionBucket{
+		{count: policy.KeepLast, period: func(t time.Time) string { return t.String() }},
+		{count: policy.KeepHourly, period: func(t time.Time) string { return t.Format("2006010215") }},
+		{count: policy.KeepDaily, period: func(t time.Time) string { return t.Format("20060102") }},
+		{count: policy.KeepWeekly, period: func(t time.Time) string {
+			y, w := t.ISOWeek()
+			return fmt.Sprintf("%d-%02d", y, w)
+		}},
+		{count: policy.KeepMonthly, period: func(t time.Time) string { return t.Format("200601") }},
+		{count: policy.KeepYearly, period: func(t time.Time) string { return t.Format("2006") }},
+	}
+
+	var within time.Time
+	if policy.KeepWithin != "" {
+		within = policy.within(runs[0].Time)
+	}
+
+	for _, r := range runs {
+		k := false
+		if policy.KeepWithin != "" && !r.Time.Before(within) {
+			k = true
+		}
+
+		for _, b := range buckets {
+			if b.count == 0 {
+				continue
+			}
+			p := b.period(r.Time.Local())
+			if p != b.last {
+				b.last = p
+				k = true
+				if b.count > 0 {
+					b.count--
+				}
+			}
+		}
+
+		if k {
+			keep = append(keep, r.ID)
+		}
+	}
+
+	return keep
+}
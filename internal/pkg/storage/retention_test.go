@@ -0,0 +1,189 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+)
+
+func snapshot(id string, t time.Time, tags ...string) Snapshot {
+	return Snapshot{ID: id, Time: t, Tags: tags}
+}
+
+func ids(snapshots []Snapshot) []string {
+	ids := make([]string, 0, len(snapshots))
+	for _, s := range snapshots {
+		ids = append(ids, s.ID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func equal(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestGroupRuns(t *testing.T) {
+	day := time.Date(2021, 10, 15, 20, 0, 0, 0, time.UTC)
+	snapshots := []Snapshot{
+		snapshot("b", day.Add(time.Minute), "object:Account", RunTag("1")),
+		snapshot("a", day, "object:Account", RunTag("1")),
+		snapshot("c", day.Add(2*time.Minute), "object:Contact", RunTag("1")),
+		snapshot("d", day.Add(-time.Hour), "object:Account"),
+	}
+
+	runs := GroupRuns(snapshots)
+	if len(runs) != 2 {
+		t.Fatalf("expected 2 runs, got %d", len(runs))
+	}
+	if runs[0].ID != "d" || runs[1].ID != "1" {
+		t.Errorf("runs not oldest first: %s, %s", runs[0].ID, runs[1].ID)
+	}
+	if !runs[1].Time.Equal(day) {
+		t.Errorf("run time is %v, expected its first snapshot's %v", runs[1].Time, day)
+	}
+	if !equal(runs[1].Tags, []string{"object:Account", "object:Contact"}) {
+		t.Errorf("run tags are %v", runs[1].Tags)
+	}
+	if !equal(ids(runs[1].Snapshots), []string{"a", "b", "c"}) {
+		t.Errorf("run snapshots are %v", ids(runs[1].Snapshots))
+	}
+}
+
+func TestPlanRetentionKeepsWholeRuns(t *testing.T) {
+	day := time.Date(2021, 10, 15, 20, 0, 0, 0, time.UTC)
+	snapshots := make([]Snapshot, 0)
+	// two runs on the same day, each stored as several batches with the same tags
+	for i, id := range []string{"a1", "a2", "a3"} {
+		snapshots = append(snapshots, snapshot(id, day.Add(time.Duration(i)*time.Minute), "object:Account", RunTag("early")))
+	}
+	for i, id := range []string{"b1", "b2"} {
+		snapshots = append(snapshots, snapshot(id, day.Add(time.Hour+time.Duration(i)*time.Minute), "object:Account", RunTag("late")))
+	}
+
+	plan := PlanRetention(snapshots, []RetentionPolicy{{KeepDaily: 1}})
+	if len(plan) != 1 {
+		t.Fatalf("expected 1 group, got %d", len(plan))
+	}
+	if !equal(ids(plan[0].Keep), []string{"b1", "b2"}) {
+		t.Errorf("kept %v, expected every batch of the latest run", ids(plan[0].Keep))
+	}
+	if !equal(ids(plan[0].Remove), []string{"a1", "a2", "a3"}) {
+		t.Errorf("removed %v, expected every batch of the earlier run", ids(plan[0].Remove))
+	}
+}
+
+func TestPlanRetentionKeepsUnionOfPolicies(t *testing.T) {
+	day := time.Date(2021, 10, 15, 20, 0, 0, 0, time.UTC)
+	snapshots := make([]Snapshot, 0)
+	for i := 0; i < 5; i++ {
+		at := day.AddDate(0, 0, -i)
+		snapshots = append(snapshots, snapshot(at.Format("0102"), at, "org:prod", "object:Account"))
+	}
+
+	policies := []RetentionPolicy{
+		// broader policy keeps only the latest run
+		{KeepLast: 1},
+		// narrower policy keeps three days of Account
+		{Tags: []string{"object:Account"}, KeepDaily: 3},
+	}
+	plan := PlanRetention(snapshots, policies)
+
+	if !equal(ids(Removed(plan)), []string{"1011", "1012"}) {
+		t.Errorf("removed %v, expected only the runs neither policy keeps", ids(Removed(plan)))
+	}
+}
+
+func TestPlanRetentionLeavesUnmatchedRuns(t *testing.T) {
+	day := time.Date(2021, 10, 15, 20, 0, 0, 0, time.UTC)
+	snapshots := []Snapshot{
+		snapshot("a", day, "object:Account"),
+		snapshot("b", day.Add(-time.Hour), "object:Account"),
+		snapshot("c", day.Add(-2*time.Hour), "object:Contact"),
+	}
+
+	plan := PlanRetention(snapshots, []RetentionPolicy{{Tags: []string{"object:Account"}, KeepLast: 1}})
+	if !equal(ids(Removed(plan)), []string{"b"}) {
+		t.Errorf("removed %v, expected only the older Account run", ids(Removed(plan)))
+	}
+}
+
+func TestPlanRetentionKeepsEachObjectOfIncrementalRuns(t *testing.T) {
+	day := time.Date(2021, 10, 15, 20, 0, 0, 0, time.UTC)
+	// each run backs up the objects that changed, one snapshot per batch
+	runs := [][]string{
+		{"Account", "Contact"},
+		{"Account"},
+		{"Contact", "Lead"},
+		{"Account"},
+		{"Lead"},
+	}
+	snapshots := make([]Snapshot, 0)
+	for i, objects := range runs {
+		run := fmt.Sprintf("r%d", i+1)
+		for j, o := range objects {
+			at := day.AddDate(0, 0, i).Add(time.Duration(j) * time.Minute)
+			snapshots = append(snapshots, snapshot(run+"-"+o, at, "org:prod", "object:"+o, RunTag(run)))
+		}
+	}
+
+	plan := PlanRetention(snapshots, []RetentionPolicy{{KeepLast: 1}})
+	want := []string{"r1-Account", "r1-Contact", "r2-Account", "r3-Lead"}
+	if !equal(ids(Removed(plan)), want) {
+		t.Errorf("removed %v, expected %v, keeping each object's latest run", ids(Removed(plan)), want)
+	}
+	if len(plan) != 3 {
+		t.Errorf("expected a group per object, got %d", len(plan))
+	}
+}
+
+func TestPlanRetentionScopesObjectPolicies(t *testing.T) {
+	day := time.Date(2021, 10, 15, 20, 0, 0, 0, time.UTC)
+	snapshots := []Snapshot{
+		// runs stored as a snapshot per batch
+		snapshot("a1", day, "object:Account", RunTag("1")),
+		snapshot("c1", day, "object:Contact", RunTag("1")),
+		snapshot("a2", day.AddDate(0, 0, 1), "object:Account", RunTag("2")),
+		// runs stored as a single snapshot of every object
+		snapshot("s3", day.AddDate(0, 0, 2), "org:uat", "object:Account", "object:Contact"),
+		snapshot("s4", day.AddDate(0, 0, 3), "org:uat", "object:Account"),
+		snapshot("s5", day.AddDate(0, 0, 4), "org:uat", "object:Account"),
+	}
+
+	plan := PlanRetention(snapshots, []RetentionPolicy{{Tags: []string{"object:Account"}, KeepLast: 1}})
+	if !equal(ids(Removed(plan)), []string{"a1", "s4"}) {
+		t.Errorf("removed %v, expected only older snapshots holding nothing but Account", ids(Removed(plan)))
+	}
+	for _, g := range plan {
+		for _, s := range append(g.Keep, g.Remove...) {
+			if s.ID == "c1" {
+				t.Error("Contact snapshot planned by an Account policy")
+			}
+		}
+	}
+}
+
+func TestPlanRetentionKeepsOrgsSeparately(t *testing.T) {
+	day := time.Date(2021, 10, 15, 20, 0, 0, 0, time.UTC)
+	snapshots := []Snapshot{
+		snapshot("p1", day, "org:prod", "object:Account"),
+		snapshot("p2", day.AddDate(0, 0, 1), "org:prod", "object:Account"),
+		snapshot("u1", day.AddDate(0, 0, -1), "org:uat", "object:Account"),
+		snapshot("m1", day, "org:prod", "metadata-api"),
+		snapshot("m2", day.AddDate(0, 0, 1), "org:prod", "metadata-api"),
+	}
+
+	plan := PlanRetention(snapshots, []RetentionPolicy{{KeepLast: 1}})
+	if !equal(ids(Removed(plan)), []string{"m1", "p1"}) {
+		t.Errorf("removed %v, expected each org's and the metadata's older snapshots", ids(Removed(plan)))
+	}
+}
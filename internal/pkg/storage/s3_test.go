@@ -0,0 +1,263 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 is an in-memory S3 bucket store, with only what the object store backend uses
+type fakeS3 struct {
+	mu      sync.Mutex
+	buckets map[string]map[string]fakeObject
+}
+
+type fakeObject struct {
+	data     []byte
+	metadata http.Header
+	modified time.Time
+}
+
+func (o fakeObject) etag() string {
+	sum := md5.Sum(o.data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// newFakeS3 serves the fake, returning its endpoint
+func newFakeS3(t *testing.T) (*fakeS3, string) {
+	s := &fakeS3{buckets: make(map[string]map[string]fakeObject)}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	return s, strings.TrimPrefix(srv.URL, "http://")
+}
+
+// keys lists the object keys in the bucket
+func (s *fakeS3) keys(bucket string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0)
+	for k := range s.buckets[bucket] {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// requests are path style, `/<bucket>/<key>`
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	bucket := parts[0]
+	key := ""
+	if len(parts) > 1 {
+		key = parts[1]
+	}
+	objects, exists := s.buckets[bucket]
+
+	switch {
+	case key == "" && r.Method == http.MethodPut:
+		s.buckets[bucket] = make(map[string]fakeObject)
+	case !exists:
+		s3Error(w, r, http.StatusNotFound, "NoSuchBucket")
+	case key == "" && r.Method == http.MethodHead:
+	case key == "" && r.Method == http.MethodGet:
+		s.list(w, r, objects)
+	case key == "" && r.Method == http.MethodPost:
+		s.deleteObjects(w, r, objects)
+	case r.Method == http.MethodPut:
+		data, err := readBody(r)
+		if err != nil {
+			s3Error(w, r, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		o := fakeObject{data: data, metadata: http.Header{}, modified: time.Now().UTC()}
+		for k, v := range r.Header {
+			if strings.HasPrefix(strings.ToLower(k), "x-amz-meta-") {
+				o.metadata[k] = v
+			}
+		}
+		objects[key] = o
+		w.Header().Set("ETag", o.etag())
+	case r.Method == http.MethodDelete:
+		delete(objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		o, ok := objects[key]
+		if !ok {
+			s3Error(w, r, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		for k, v := range o.metadata {
+			w.Header()[k] = v
+		}
+		w.Header().Set("ETag", o.etag())
+		w.Header().Set("Last-Modified", o.modified.Format(http.TimeFormat))
+		w.Header().Set("Content-Length", strconv.Itoa(len(o.data)))
+		if r.Method == http.MethodGet {
+			w.Write(o.data)
+		}
+	default:
+		s3Error(w, r, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+// readBody reads an object upload, decoding the chunks of streaming signed uploads
+func readBody(r *http.Request) ([]byte, error) {
+	if r.Header.Get("X-Amz-Content-Sha256") != "STREAMING-AWS4-HMAC-SHA256-PAYLOAD" {
+		return ioutil.ReadAll(r.Body)
+	}
+
+	// each chunk is `<hex size>;chunk-signature=<signature>\r\n<data>\r\n`, ending with an empty chunk
+	br := bufio.NewReader(r.Body)
+	data := make([]byte, 0)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.ParseInt(strings.SplitN(line, ";", 2)[0], 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return data, nil
+		}
+		chunk := make([]byte, size+2)
+		if _, err := io.ReadFull(br, chunk); err != nil {
+			return nil, err
+		}
+		data = append(data, chunk[:size]...)
+	}
+}
+
+type fakeListResult struct {
+	XMLName        xml.Name `xml:"ListBucketResult"`
+	Prefix         string
+	Delimiter      string
+	KeyCount       int
+	MaxKeys        int
+	IsTruncated    bool
+	Contents       []fakeListObject
+	CommonPrefixes []fakeListPrefix
+}
+
+type fakeListObject struct {
+	Key          string
+	LastModified string
+	ETag         string
+	Size         int
+}
+
+type fakeListPrefix struct {
+	Prefix string
+}
+
+// list is ListObjectsV2, without paging
+func (s *fakeS3) list(w http.ResponseWriter, r *http.Request, objects map[string]fakeObject) {
+	prefix := r.URL.Query().Get("prefix")
+	delimiter := r.URL.Query().Get("delimiter")
+	result := fakeListResult{Prefix: prefix, Delimiter: delimiter, MaxKeys: 1000}
+
+	keys := make([]string, 0, len(objects))
+	for k := range objects {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	seen := make(map[string]bool)
+	for _, k := range keys {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		if delimiter != "" {
+			if i := strings.Index(k[len(prefix):], delimiter); i >= 0 {
+				p := k[:len(prefix)+i+len(delimiter)]
+				if !seen[p] {
+					seen[p] = true
+					result.CommonPrefixes = append(result.CommonPrefixes, fakeListPrefix{Prefix: p})
+				}
+				continue
+			}
+		}
+		o := objects[k]
+		result.Contents = append(result.Contents, fakeListObject{
+			Key:          k,
+			LastModified: o.modified.Format("2006-01-02T15:04:05.000Z"),
+			ETag:         o.etag(),
+			Size:         len(o.data),
+		})
+	}
+	result.KeyCount = len(result.Contents) + len(result.CommonPrefixes)
+
+	writeXML(w, result)
+}
+
+type fakeDelete struct {
+	Objects []struct {
+		Key string
+	} `xml:"Object"`
+}
+
+type fakeDeleteResult struct {
+	XMLName xml.Name `xml:"DeleteResult"`
+	Deleted []fakeDeleted
+}
+
+type fakeDeleted struct {
+	Key string
+}
+
+// deleteObjects is DeleteObjects, removing several objects at once
+func (s *fakeS3) deleteObjects(w http.ResponseWriter, r *http.Request, objects map[string]fakeObject) {
+	if _, ok := r.URL.Query()["delete"]; !ok {
+		s3Error(w, r, http.StatusNotImplemented, "NotImplemented")
+		return
+	}
+
+	req := fakeDelete{}
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+		s3Error(w, r, http.StatusBadRequest, "MalformedXML")
+		return
+	}
+
+	result := fakeDeleteResult{}
+	for _, o := range req.Objects {
+		delete(objects, o.Key)
+		result.Deleted = append(result.Deleted, fakeDeleted{Key: o.Key})
+	}
+	writeXML(w, result)
+}
+
+func writeXML(w http.ResponseWriter, v interface{}) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	if err := xml.NewEncoder(&buf).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write(buf.Bytes())
+}
+
+func s3Error(w http.ResponseWriter, r *http.Request, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		fmt.Fprintf(w, "%s<Error><Code>%s</Code><Message>%s</Message><Resource>%s</Resource></Error>", xml.Header, code, code, r.URL.Path)
+	}
+}
@@ -0,0 +1,205 @@
+package storage
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/pkg/restic"
+	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/tools"
+)
+
+const (
+	// Storage backend types
+	TYPE_RESTIC       = "restic"
+	TYPE_ARCHIVE      = "archive"
+	TYPE_OBJECT_STORE = "object_store"
+
+	SNAPSHOT_LATEST = restic.SNAPSHOT_LATEST
+
+	// Snapshot IDs are the UTC time a run started
+	RUN_ID_FORMAT = "20060102T150405Z"
+)
+
+// Storage is a backend that backups are stored in and restored from
+type Storage interface {
+	// Init connects to the storage, creating it if it doesn't exist
+	Init() error
+	// Backup stores the files (or directories) at the paths, tagged with the tags
+	Backup(paths []string, tags ...string) (*BackupResult, error)
+	// Snapshots lists the stored snapshots with any of the tags, or all snapshots if no tags are given
+	Snapshots(tags ...string) ([]Snapshot, error)
+	// Restore restores the paths in a snapshot matching the include patterns into the target directory
+	Restore(snapshotID string, target string, include ...string) error
+	// Check verifies the integrity of the stored snapshots
+	Check() error
+	// Close finishes the current run, no more backups can be stored after
+	Close() error
+}
+
+// Snapshot is a point in time backup in storage
+type Snapshot struct {
+	ID       string    `json:"id"`
+	Time     time.Time `json:"time"`
+	Hostname string    `json:"hostname,omitempty"`
+	Tags     []string  `json:"tags,omitempty"`
+	Paths    []string  `json:"paths,omitempty"`
+}
+
+// BackupResult describes what a backup stored
+type BackupResult struct {
+	SnapshotID string `json:"snapshot_id"`
+	Files      int64  `json:"files"`
+	Bytes      int64  `json:"bytes"`
+	// BytesAdded is the data new to storage, less than Bytes for deduplicating backends
+	BytesAdded int64 `json:"bytes_added"`
+}
+
+// add counts a file stored in full
+func (r *BackupResult) add(size int64) {
+	r.Files++
+	r.Bytes += size
+	r.BytesAdded += size
+}
+
+// Manifest records the files stored in a snapshot, for backends without their own snapshot index
+type Manifest struct {
+	Snapshot
+	Files map[string]int64 `json:"files"`
+}
+
+func newManifest(run time.Time) *Manifest {
+	hostname, _ := osHostname()
+	return &Manifest{
+		Snapshot: Snapshot{
+			ID:       run.UTC().Format(RUN_ID_FORMAT),
+			Time:     run,
+			Hostname: hostname,
+		},
+		Files: make(map[string]int64),
+	}
+}
+
+func (m *Manifest) addTags(tags ...string) {
+	for _, t := range tags {
+		if !tools.StringSliceContaines(m.Tags, t) {
+			m.Tags = append(m.Tags, t)
+		}
+	}
+}
+
+func (m *Manifest) addFile(name string, size int64, root string) {
+	m.Files[name] = size
+	if !tools.StringSliceContaines(m.Paths, root) {
+		m.Paths = append(m.Paths, root)
+	}
+}
+
+// Config selects and configures the storage backend
+type Config struct {
+	Type        string                  `mapstructure:"type"`
+	Restic      restic.RepositoryConfig `mapstructure:"restic"`
+	Archive     ArchiveConfig           `mapstructure:"archive"`
+	ObjectStore ObjectStoreConfig       `mapstructure:"object_store"`
+}
+
+// New creates and initializes the storage backend selected by config
+func New(config Config) (Storage, error) {
+	var s Storage
+
+	switch config.Type {
+	case TYPE_RESTIC, "":
+		s = NewRestic(&config.Restic)
+	case TYPE_ARCHIVE:
+		s = NewArchive(config.Archive)
+	case TYPE_OBJECT_STORE:
+		s = NewObjectStore(config.ObjectStore)
+	default:
+		return nil, fmt.Errorf("unknown storage type: %s", config.Type)
+	}
+
+	if err := s.Init(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// MatchInclude checks if a stored file name matches any of the include patterns.
+// Like restic, patterns match the whole name or any trailing part of it, e.g. `Account/*` matches `base/Account/metadata.json`.
+func MatchInclude(name string, patterns ...string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+
+	name = filepath.ToSlash(name)
+	parts := strings.Split(strings.TrimPrefix(name, "/"), "/")
+	for _, p := range patterns {
+		p = strings.TrimPrefix(filepath.ToSlash(p), "/")
+		for i := range parts {
+			if ok, _ := path.Match(p, strings.Join(parts[i:], "/")); ok {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// filterSnapshots returns the snapshots with any of the tags, oldest first
+func filterSnapshots(snapshots []Snapshot, tags ...string) []Snapshot {
+	filtered := make([]Snapshot, 0, len(snapshots))
+	for _, s := range snapshots {
+		if len(tags) == 0 {
+			filtered = append(filtered, s)
+			continue
+		}
+		for _, t := range tags {
+			if tools.StringSliceContaines(s.Tags, t) {
+				filtered = append(filtered, s)
+				break
+			}
+		}
+	}
+
+	sort.Slice(filtered, func(i, j int) bool {
+		return filtered[i].Time.Before(filtered[j].Time)
+	})
+
+	return filtered
+}
+
+// resolveSnapshot returns the ID of the latest snapshot if requested, otherwise the ID as-is
+func resolveSnapshot(s Storage, snapshotID string) (string, error) {
+	if snapshotID != "" && snapshotID != SNAPSHOT_LATEST {
+		return snapshotID, nil
+	}
+
+	snapshots, err := s.Snapshots()
+	if err != nil {
+		return "", err
+	}
+	if len(snapshots) == 0 {
+		return "", fmt.Errorf("no snapshots found")
+	}
+
+	return snapshots[len(snapshots)-1].ID, nil
+}
+
+// storedName is the name a file is stored under, relative and using `/` separators
+func storedName(p string) string {
+	return strings.TrimPrefix(filepath.ToSlash(filepath.Clean(p)), "/")
+}
+
+// restorePath joins the stored name to the target, refusing names that would escape it
+func restorePath(target string, name string) (string, error) {
+	p := filepath.Join(target, filepath.FromSlash(name))
+	rel, err := filepath.Rel(target, p)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("invalid stored file name: %s", name)
+	}
+	return p, nil
+}
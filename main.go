@@ -15,15 +15,8 @@ limitations under the License.
 */
 package main
 
-// import "gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/cmd"
-import (
-	"gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/app"
-)
-
-// "gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/internal/app"
+import "gitlab.com/heb-engineering/teams/spm-eng/appcloud/tools/salesforce-backups/cmd"
 
 func main() {
-	// cmd.Execute()
-
-	app.Start()
+	cmd.Execute()
 }